@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ConfigResponse is the effective configuration, with defaults filled in, that is safe to show. Secrets such as the
+// API key are deliberately left out rather than redacted so new ones can't leak by accident.
+type ConfigResponse struct {
+	Port                  string   `json:"port"`
+	LogLevel              string   `json:"log_level"`
+	LogFormat             string   `json:"log_format"`
+	APIPrefix             string   `json:"api_prefix"`
+	ClassCatalog          []string `json:"class_catalog"`
+	CancelCutoffHours     int      `json:"cancel_cutoff_hours"`
+	IDStrategy            string   `json:"id_strategy"`
+	MaxWaitlist           *int     `json:"max_waitlist"`
+	Timezone              string   `json:"timezone"`
+	MaxBookingWait        string   `json:"max_booking_wait"`
+	DefaultRangeDays      int      `json:"default_range_days"`
+	SeedDemo              bool     `json:"seed_demo"`
+	MaxSessionsPerDay     int      `json:"max_sessions_per_day"`
+	CooldownMinutes       int      `json:"cooldown_minutes"`
+	RejectTimeConflicts   bool     `json:"reject_time_conflicts"`
+	BookingWindowDays     int      `json:"booking_window_days"`
+	MinAdvanceMinutes     int      `json:"min_advance_minutes"`
+	HoldDuration          string   `json:"hold_duration"`
+	ReadHeaderTimeout     string   `json:"read_header_timeout"`
+	ReadTimeout           string   `json:"read_timeout"`
+	DataFile              string   `json:"data_file"`
+	StrictLoad            bool     `json:"strict_load"`
+	PersistFailurePolicy  string   `json:"persist_failure_policy"`
+	MaxBatchSize          int      `json:"max_batch_size"`
+	MaxConcurrentRequests int      `json:"max_concurrent_requests"`
+	CORSAllowedOrigins    []string `json:"cors_allowed_origins"`
+	CORSAllowedMethods    []string `json:"cors_allowed_methods"`
+	CORSAllowCredentials  bool     `json:"cors_allow_credentials"`
+	APIKeyRequired        bool     `json:"api_key_required"`
+	BearerTokenRequired   bool     `json:"bearer_token_required"`
+}
+
+// newConfigResponse fills in the defaults the handlers use for any unset settings
+func (server *Server) newConfigResponse() ConfigResponse {
+	httpServer := server.newHTTPServer(nil)
+	response := ConfigResponse{
+		Port:                  server.listenPort(),
+		LogLevel:              server.config.LogLevel,
+		LogFormat:             server.config.LogFormat,
+		APIPrefix:             server.apiPrefix(),
+		ClassCatalog:          server.config.ClassCatalog,
+		CancelCutoffHours:     server.config.CancelCutoffHours,
+		IDStrategy:            server.config.IDStrategy,
+		MaxWaitlist:           server.config.MaxWaitlist,
+		Timezone:              server.serverLocation().String(),
+		MaxBookingWait:        server.config.MaxBookingWait.String(),
+		DefaultRangeDays:      server.config.DefaultRangeDays,
+		SeedDemo:              server.config.SeedDemo,
+		MaxSessionsPerDay:     server.config.MaxSessionsPerDay,
+		CooldownMinutes:       server.config.CooldownMinutes,
+		RejectTimeConflicts:   server.config.RejectTimeConflicts,
+		BookingWindowDays:     server.config.BookingWindowDays,
+		MinAdvanceMinutes:     server.config.MinAdvanceMinutes,
+		HoldDuration:          server.config.HoldDuration.String(),
+		ReadHeaderTimeout:     httpServer.ReadHeaderTimeout.String(),
+		ReadTimeout:           httpServer.ReadTimeout.String(),
+		DataFile:              server.config.DataFile,
+		StrictLoad:            server.config.StrictLoad,
+		PersistFailurePolicy:  server.config.PersistFailurePolicy,
+		MaxBatchSize:          server.maxBatchSize(),
+		MaxConcurrentRequests: server.maxConcurrentRequests(),
+		CORSAllowedOrigins:    server.config.CORSAllowedOrigins,
+		CORSAllowedMethods:    server.config.CORSAllowedMethods,
+		CORSAllowCredentials:  server.config.CORSAllowCredentials,
+		APIKeyRequired:        server.config.APIKey != "",
+		BearerTokenRequired:   server.config.JWTSecret != "",
+	}
+	if response.LogLevel == "" {
+		response.LogLevel = "info"
+	}
+	if response.LogFormat == "" {
+		response.LogFormat = "text"
+	}
+	if response.ClassCatalog == nil {
+		response.ClassCatalog = []string{}
+	}
+	if response.CORSAllowedOrigins == nil {
+		response.CORSAllowedOrigins = []string{}
+	}
+	if response.CORSAllowedMethods == nil {
+		response.CORSAllowedMethods = defaultCORSAllowedMethods
+	}
+	if response.PersistFailurePolicy == "" {
+		response.PersistFailurePolicy = persistMemoryOnly
+	}
+	if response.IDStrategy == "" {
+		response.IDStrategy = "uuid"
+	}
+	if server.config.MaxBookingWait == 0 {
+		response.MaxBookingWait = defaultMaxBookingWait.String()
+	}
+	if server.config.DefaultRangeDays == 0 {
+		response.DefaultRangeDays = defaultRangeDays
+	}
+	if server.config.HoldDuration == 0 {
+		response.HoldDuration = defaultHoldDuration.String()
+	}
+	return response
+}
+
+// ReadOnlyState is whether the server is in read-only mode, for reading and changing it through `/admin/read-only`
+type ReadOnlyState struct {
+	ReadOnly bool `json:"read_only"`
+}
+
+// getReadOnly is the handler function for GET requests to `/admin/read-only`, it will write to ResponseWriter whether
+// the server is in read-only mode
+func (server *Server) getReadOnly(w http.ResponseWriter, r *http.Request) {
+	err := json.NewEncoder(w).Encode(ReadOnlyState{ReadOnly: server.readOnly.Load()})
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// setReadOnly is the handler function for PUT requests to `/admin/read-only`, it turns read-only mode on or off and
+// writes the new state to ResponseWriter
+func (server *Server) setReadOnly(w http.ResponseWriter, r *http.Request) {
+	var state ReadOnlyState
+	err := json.NewDecoder(r.Body).Decode(&state)
+	if err != nil {
+		err = errorResponse(w, CodeInvalidJSON, invalidJSON(err), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	server.readOnly.Store(state.ReadOnly)
+	logger.Info("changed read-only mode", "read_only", state.ReadOnly)
+	err = json.NewEncoder(w).Encode(state)
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// getConfig is the handler function for GET requests to `/admin/config`, it will write to ResponseWriter the
+// effective configuration of the server without any secrets
+func (server *Server) getConfig(w http.ResponseWriter, r *http.Request) {
+	err := json.NewEncoder(w).Encode(server.newConfigResponse())
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
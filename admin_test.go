@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_getConfig(t *testing.T) {
+	maxWaitlist := 3
+	testServer.config = Config{
+		Port:                "8080",
+		BookingWindowDays:   14,
+		CooldownMinutes:     15,
+		RejectTimeConflicts: true,
+		MaxWaitlist:         &maxWaitlist,
+		Timezone:            time.FixedZone("Gym", 3600),
+		AdminEnabled:        true,
+		APIKey:              "s3cret",
+	}
+	defer func() { testServer.config = Config{} }()
+	getAdminConfig := func(key string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/admin/config", nil)
+		r.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		testServer.newRouter().ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("get the effective configuration without secrets", func(t *testing.T) {
+		w := getAdminConfig("s3cret")
+
+		var response map[string]interface{}
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "8080", response["port"])
+		assert.Equal(t, "/v1", response["api_prefix"])
+		assert.Equal(t, float64(14), response["booking_window_days"])
+		assert.Equal(t, float64(15), response["cooldown_minutes"])
+		assert.Equal(t, true, response["reject_time_conflicts"])
+		assert.Equal(t, float64(3), response["max_waitlist"])
+		assert.Equal(t, "Gym", response["timezone"])
+		assert.Equal(t, "5s", response["max_booking_wait"])
+		assert.Equal(t, float64(defaultMaxBatchSize), response["max_batch_size"])
+		assert.Equal(t, true, response["api_key_required"])
+		assert.NotContains(t, string(respBody), "s3cret")
+	})
+	t.Run("try get the configuration without the API key", func(t *testing.T) {
+		w := getAdminConfig("guess")
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+	t.Run("admin routes aren't served unless enabled", func(t *testing.T) {
+		testServer.config.AdminEnabled = false
+
+		w := getAdminConfig("s3cret")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func Test_readOnlyMode(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	testServer.config = Config{AdminEnabled: true, APIKey: "s3cret"}
+	defer func() { testServer.config = Config{} }()
+	testServer.readOnly.Store(true)
+	defer testServer.readOnly.Store(false)
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 10},
+	}
+	testServer.markClassesChanged()
+	send := func(method, path, body string) (*httptest.ResponseRecorder, ErrorResponse) {
+		r, _ := http.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("X-API-Key", "s3cret")
+		w := httptest.NewRecorder()
+		testServer.newRouter().ServeHTTP(w, r)
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		return w, errorResponse
+	}
+
+	t.Run("try create a class in read-only mode", func(t *testing.T) {
+		w, errorResponse := send("POST", "/classes", `{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-01", "capacity": 20}`)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, ReadOnlyMode, errorResponse.Err)
+		assert.Equal(t, 1, len(testServer.DBClasses))
+	})
+	t.Run("try create a booking in read-only mode", func(t *testing.T) {
+		w, errorResponse := send("POST", "/bookings", `{"member_name": "David","class_name": "lifting","date": "2020-12-12"}`)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, CodeReadOnlyMode, errorResponse.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses[0].Bookings))
+	})
+	t.Run("validate a booking in read-only mode", func(t *testing.T) {
+		w, _ := send("POST", "/bookings/validate", `{"member_name": "David","class_name": "lifting","date": "2020-12-12"}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses[0].Bookings))
+	})
+	t.Run("list classes in read-only mode", func(t *testing.T) {
+		w, _ := send("GET", "/classes", "")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	t.Run("turn read-only mode off through the admin route", func(t *testing.T) {
+		w, _ := send("PUT", "/admin/read-only", `{"read_only": false}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.False(t, testServer.readOnly.Load())
+
+		w, _ = send("POST", "/bookings", `{"member_name": "David","class_name": "lifting","date": "2020-12-12"}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// tokenClaims are the claims read from a bearer token, the subject is the member's name
+type tokenClaims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt *int64 `json:"exp"`
+	NotBefore *int64 `json:"nbf"`
+}
+
+var errInvalidToken = errors.New("invalid token")
+
+// parseBearerToken checks token is a JWT signed with HS256 using secret, and that at now it has neither expired nor is
+// yet to become valid, returning the member it names
+func parseBearerToken(token string, secret []byte, now time.Time) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errInvalidToken
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	err := decodeTokenPart(parts[0], &header)
+	if err != nil || header.Algorithm != "HS256" {
+		return "", errInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errInvalidToken
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return "", errInvalidToken
+	}
+
+	var claims tokenClaims
+	err = decodeTokenPart(parts[1], &claims)
+	if err != nil || validateMemberName(claims.Subject) != nil {
+		return "", errInvalidToken
+	}
+	if claims.ExpiresAt != nil && !now.Before(time.Unix(*claims.ExpiresAt, 0)) {
+		return "", errInvalidToken
+	}
+	if claims.NotBefore != nil && now.Before(time.Unix(*claims.NotBefore, 0)) {
+		return "", errInvalidToken
+	}
+	return claims.Subject, nil
+}
+
+// decodeTokenPart decodes a base64url encoded JSON part of a token into v
+func decodeTokenPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// memberContextKey is the context key the authenticated member's name is stored under
+type memberContextKey struct{}
+
+// withMember returns a copy of ctx carrying the authenticated member's name
+func withMember(ctx context.Context, member string) context.Context {
+	return context.WithValue(ctx, memberContextKey{}, member)
+}
+
+// memberFromContext returns the name of the member the request was authenticated as, if any
+func memberFromContext(ctx context.Context) (string, bool) {
+	member, ok := ctx.Value(memberContextKey{}).(string)
+	return member, ok
+}
+
+// defaultMemberName fills in name from the authenticated member when the request left it empty
+func defaultMemberName(r *http.Request, name *string) {
+	if *name != "" {
+		return
+	}
+	if member, ok := memberFromContext(r.Context()); ok {
+		*name = member
+	}
+}
+
+// requireBearerToken wraps a handler so, when JWT_SECRET is configured, requests must carry a valid token in an
+// `Authorization: Bearer` header or be turned away with 401. The member the token names is put in the request context
+// for handlers to read, see memberFromContext. The health checks, metrics and preflight requests are let through
+// without a token, as are the `/admin` routes when API_KEY is set since they are then guarded by it instead.
+func (server *Server) requireBearerToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if server.config.JWTSecret == "" || r.Method == http.MethodOptions || unversionedPaths[r.URL.Path] ||
+			(server.config.APIKey != "" && strings.HasPrefix(r.URL.Path, "/admin/")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		member, err := parseBearerToken(token, []byte(server.config.JWTSecret), server.now())
+		if !found || err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="classes"`)
+			err = errorResponse(w, CodeInvalidBearerToken, InvalidBearerToken, http.StatusUnauthorized)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withMember(r.Context(), member)))
+	})
+}
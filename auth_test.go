@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// signToken returns a JWT holding claims signed with secret using alg
+func signToken(alg, secret string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func Test_parseBearerToken(t *testing.T) {
+	now := time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC)
+	secret := []byte("s3cret")
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"a signed token", signToken("HS256", "s3cret", map[string]interface{}{"sub": "David"}), true},
+		{"a token that expires later", signToken("HS256", "s3cret", map[string]interface{}{"sub": "David", "exp": now.Add(time.Minute).Unix()}), true},
+		{"a token signed with another secret", signToken("HS256", "guess", map[string]interface{}{"sub": "David"}), false},
+		{"a token with another algorithm", signToken("none", "s3cret", map[string]interface{}{"sub": "David"}), false},
+		{"an expired token", signToken("HS256", "s3cret", map[string]interface{}{"sub": "David", "exp": now.Unix()}), false},
+		{"a token that isn't valid yet", signToken("HS256", "s3cret", map[string]interface{}{"sub": "David", "nbf": now.Add(time.Minute).Unix()}), false},
+		{"a token without a subject", signToken("HS256", "s3cret", map[string]interface{}{}), false},
+		{"a malformed token", "not.a-token", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			member, err := parseBearerToken(test.token, secret, now)
+
+			if test.valid {
+				assert.Nil(t, err)
+				assert.Equal(t, "David", member)
+			} else {
+				assert.Equal(t, errInvalidToken, err)
+			}
+		})
+	}
+}
+
+func Test_requireBearerToken(t *testing.T) {
+	testServer.config.JWTSecret = "s3cret"
+	defer func() { testServer.config.JWTSecret = "" }()
+	var member string
+	handler := testServer.requireBearerToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		member, _ = memberFromContext(r.Context())
+	}))
+	send := func(path, authorization string) *httptest.ResponseRecorder {
+		member = ""
+		r, _ := http.NewRequest("GET", path, nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("a valid token puts the member in the context", func(t *testing.T) {
+		w := send("/classes", "Bearer "+signToken("HS256", "s3cret", map[string]interface{}{"sub": "David"}))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "David", member)
+	})
+	t.Run("try an invalid token", func(t *testing.T) {
+		w := send("/classes", "Bearer "+signToken("HS256", "guess", map[string]interface{}{"sub": "David"}))
+
+		var response ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, CodeInvalidBearerToken, response.Code)
+		assert.Equal(t, `Bearer realm="classes"`, w.Header().Get("WWW-Authenticate"))
+		assert.Equal(t, "", member)
+	})
+	t.Run("try without a token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, send("/classes", "").Code)
+	})
+	t.Run("try a token without the Bearer scheme", func(t *testing.T) {
+		w := send("/classes", signToken("HS256", "s3cret", map[string]interface{}{"sub": "David"}))
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+	t.Run("the health checks don't need a token", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send("/live", "").Code)
+	})
+	t.Run("the admin routes don't need a token when they have an API key", func(t *testing.T) {
+		testServer.config.APIKey = "adm1n"
+		defer func() { testServer.config.APIKey = "" }()
+
+		assert.Equal(t, http.StatusOK, send("/admin/config", "").Code)
+	})
+	t.Run("try the admin routes without a token or an API key", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, send("/admin/config", "").Code)
+	})
+	t.Run("tokens aren't needed without a secret", func(t *testing.T) {
+		testServer.config.JWTSecret = ""
+		defer func() { testServer.config.JWTSecret = "s3cret" }()
+
+		assert.Equal(t, http.StatusOK, send("/classes", "").Code)
+	})
+}
+
+func Test_createBookingMemberFromToken(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	testServer.config.JWTSecret = "s3cret"
+	defer func() { testServer.config.JWTSecret = "" }()
+	book := func(body string) *httptest.ResponseRecorder {
+		testServer.DBClasses = []Class{
+			{Id: "1", Name: "kayak", Date: time.Date(2006, 1, 1, 0, 0, 0, 0, time.UTC), Capacity: 20},
+		}
+		r, _ := http.NewRequest("POST", "/v1/bookings", bytes.NewReader([]byte(body)))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Authorization", "Bearer "+signToken("HS256", "s3cret", map[string]interface{}{"sub": "Sarah"}))
+		w := httptest.NewRecorder()
+		testServer.newRouter().ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("default member_name to the token's member", func(t *testing.T) {
+		w := book(`{"class_name": "kayak", "date": "2006-01-01"}`)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "Sarah", testServer.DBClasses[0].Bookings[0].MemberName)
+	})
+	t.Run("keep a member_name given in the request", func(t *testing.T) {
+		w := book(`{"member_name": "David", "class_name": "kayak", "date": "2006-01-01"}`)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "David", testServer.DBClasses[0].Bookings[0].MemberName)
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+)
+
+// BundleRequest books a member into several classes at once, by their ids
+type BundleRequest struct {
+	MemberName  string   `json:"member_name"`
+	MemberEmail string   `json:"member_email,omitempty"`
+	ClassIds    []string `json:"class_ids"`
+}
+
+// BundleFullResponse is the error written when a bundle isn't booked because some of its classes have no space,
+// FullClassIds lists them
+type BundleFullResponse struct {
+	Err          string   `json:"error"`
+	Code         string   `json:"code"`
+	FullClassIds []string `json:"full_class_ids"`
+}
+
+// createBundleBooking is the handler function for POST requests to `/bookings/bundle`, it books the member into every
+// class in the bundle or, if any of them is full or cancelled, none of them. Each class gets createBooking's checks,
+// see checkBooking, and every rejection is counted in bookingsRejected. The classes are checked and booked under one
+// lock so nothing can take a spot in between. The receipts are written to ResponseWriter in request order.
+func (server *Server) createBundleBooking(w http.ResponseWriter, r *http.Request) {
+	reqBody, _ := ioutil.ReadAll(r.Body)
+	var bundleRequest BundleRequest
+	err := json.Unmarshal(reqBody, &bundleRequest)
+	if err != nil {
+		err = errorResponse(w, CodeInvalidJSON, invalidJSON(err), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	defaultMemberName(r, &bundleRequest.MemberName)
+	err = validateMemberName(bundleRequest.MemberName)
+	if err == nil {
+		err = validateMemberEmail(bundleRequest.MemberEmail)
+	}
+	if err == nil && len(bundleRequest.ClassIds) == 0 {
+		err = newValidationError(CodeMissingClassIDs, MissingClassIDs)
+	}
+	if err == nil && len(bundleRequest.ClassIds) > server.maxBatchSize() {
+		err = newValidationError(CodeBatchTooLarge, BatchTooLarge)
+	}
+	for _, id := range bundleRequest.ClassIds {
+		if err == nil && !server.validID(id) {
+			err = newValidationError(CodeInvalidClassID, InvalidClassID)
+		}
+	}
+	if err != nil {
+		err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	server.dbLock.Lock()
+	defer server.dbLock.Unlock()
+	bookingRequest := BookingRequest{MemberName: bundleRequest.MemberName, MemberEmail: bundleRequest.MemberEmail}
+	classes := make([]*Class, 0, len(bundleRequest.ClassIds))
+	fullClassIds := make([]string, 0)
+	for _, id := range bundleRequest.ClassIds {
+		class, err := server.findClassByID(id)
+		if err != nil {
+			bookingsRejected.inc(rejectedClassNotFound)
+			err = errorResponse(w, CodeClassDoesNotExists, ClassDoesNotExists, http.StatusNotFound)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+		_, rejection := server.checkBooking(class, bookingRequest)
+		// a class listed twice would be a second booking for the member
+		if rejection == nil && containsClass(classes, class) {
+			rejection = &bookingRejection{http.StatusConflict, CodeMemberAlreadyBooked, MemberAlreadyBooked}
+		}
+		// nor can the member be booked into two classes of the bundle that run at the same time
+		if rejection == nil && server.config.RejectTimeConflicts && overlapsAny(classes, class) {
+			rejection = &bookingRejection{http.StatusConflict, CodeMemberTimeConflict, MemberTimeConflict}
+		}
+		if rejection != nil && rejection.code != CodeClassIsFull && rejection.code != CodeClassCancelled {
+			bookingsRejected.inc(rejectionReason(rejection))
+			err = errorResponse(w, rejection.code, rejection.reason, rejection.statusCode)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+		if rejection != nil {
+			fullClassIds = append(fullClassIds, class.Id)
+		}
+		classes = append(classes, class)
+	}
+	if len(fullClassIds) > 0 {
+		bookingsRejected.inc(rejectedClassFull)
+		w.WriteHeader(http.StatusConflict)
+		err = json.NewEncoder(w).Encode(BundleFullResponse{Err: ClassIsFull, Code: CodeClassIsFull, FullClassIds: fullClassIds})
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	snapshot := server.rollbackPoint()
+	receipts := make([]BookingReceipt, 0, len(classes))
+	for _, class := range classes {
+		// the member's hold has become their booking
+		class.releaseHold(bundleRequest.MemberName)
+		booking := Booking{
+			MemberName:  bundleRequest.MemberName,
+			MemberEmail: bundleRequest.MemberEmail,
+			Id:          server.ids.NewID(),
+			Status:      BookingConfirmed,
+			CreatedAt:   server.now(),
+		}
+		class.addBooking(booking)
+		receipts = append(receipts, newBookingReceipt(class, booking, server.now()))
+	}
+	if !changesKept(w, server.commitChanges(snapshot, classes...)) {
+		return
+	}
+
+	logger.Debug("booked bundle", "member", bundleRequest.MemberName, "classes", len(classes))
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(receipts)
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// overlapsAny reports whether the class runs at the same time as any of the classes
+func overlapsAny(classes []*Class, class *Class) bool {
+	for _, listed := range classes {
+		if listed.overlaps(class) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsClass reports whether the class is already in the list
+func containsClass(classes []*Class, class *Class) bool {
+	for _, listed := range classes {
+		if listed == class {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_createBundleBooking(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	testServer.config.IDStrategy = "sequential"
+	defer func() { testServer.config.IDStrategy = "" }()
+	newClasses := func() []Class {
+		return []Class{
+			{Id: "1", Name: "kayak", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10},
+			{Id: "2", Name: "kayak", Date: time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC), Capacity: 10},
+			{
+				Id: "3", Name: "kayak", Date: time.Date(2021, 1, 6, 0, 0, 0, 0, time.UTC), Capacity: 1,
+				Bookings: []Booking{{MemberName: "Sarah", Id: "a", Status: BookingConfirmed}},
+			},
+		}
+	}
+	bookBundle := func(classIds ...string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(BundleRequest{MemberName: "David", ClassIds: classIds})
+		r, _ := http.NewRequest("POST", "/bookings/bundle", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createBundleBooking(w, r)
+		return w
+	}
+
+	t.Run("book every class in a bundle", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+		testServer.DBClasses[2].Capacity = 2
+
+		w := bookBundle("1", "2", "3")
+
+		var receipts []BookingReceipt
+		json.Unmarshal(w.Body.Bytes(), &receipts)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 3, len(receipts))
+		assert.Equal(t, "3", receipts[2].ClassId)
+		assert.Equal(t, BookingConfirmed, receipts[2].Status)
+		for _, class := range testServer.DBClasses {
+			assert.True(t, class.hasActiveBooking("David", ""))
+		}
+	})
+	t.Run("a single full class blocks the whole bundle", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+
+		w := bookBundle("1", "2", "3")
+
+		var response BundleFullResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, CodeClassIsFull, response.Code)
+		assert.Equal(t, []string{"3"}, response.FullClassIds)
+		for _, class := range testServer.DBClasses {
+			assert.False(t, class.hasActiveBooking("David", ""))
+		}
+	})
+	t.Run("try book a bundle with an id the id strategy couldn't have created", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+
+		w := bookBundle("1", "{2}")
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, CodeInvalidClassID, errorResponse.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses[0].Bookings))
+	})
+	t.Run("try book a bundle listing a class twice", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+
+		w := bookBundle("1", "1")
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses[0].Bookings))
+	})
+	t.Run("a class that can't be booked on its own rejects the bundle", func(t *testing.T) {
+		bookingsRejected.reset()
+		defer bookingsRejected.reset()
+		testServer.DBClasses = newClasses()
+		testServer.DBClasses[1].Capacity = 0
+
+		w := bookBundle("1", "2")
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, CodeClassNotBookable, errorResponse.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses[0].Bookings))
+		assert.Equal(t, uint64(1), bookingsRejected.value(rejectedNotBookable))
+	})
+	t.Run("roll back the whole bundle when it can't be saved", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+		testServer.DBClasses[2].Capacity = 2
+		testServer.config = Config{DataFile: t.TempDir(), PersistFailurePolicy: persistRollback, IDStrategy: "sequential"}
+		defer func() { testServer.config = Config{IDStrategy: "sequential"} }()
+
+		w := bookBundle("1", "3")
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		for _, class := range testServer.DBClasses {
+			assert.False(t, class.hasActiveBooking("David", ""))
+		}
+	})
+	t.Run("try book a bundle of overlapping classes when conflicts are rejected", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+		testServer.DBClasses = append(testServer.DBClasses,
+			Class{Id: "4", Name: "yoga", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10, StartTime: "09:00", DurationMinutes: 60},
+			Class{Id: "5", Name: "spin", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10, StartTime: "09:30", DurationMinutes: 45},
+		)
+		testServer.config.RejectTimeConflicts = true
+		defer func() { testServer.config.RejectTimeConflicts = false }()
+
+		w := bookBundle("4", "5")
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, CodeMemberTimeConflict, errorResponse.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses[3].Bookings))
+	})
+	t.Run("try book a bundle class overlapping one the member is booked into", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+		testServer.DBClasses = append(testServer.DBClasses,
+			Class{
+				Id: "4", Name: "yoga", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10, StartTime: "09:00", DurationMinutes: 60,
+				Bookings: []Booking{{MemberName: "David", Id: "b", Status: BookingConfirmed}},
+			},
+			Class{Id: "5", Name: "spin", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10, StartTime: "09:30", DurationMinutes: 45},
+		)
+		testServer.config.RejectTimeConflicts = true
+		defer func() { testServer.config.RejectTimeConflicts = false }()
+
+		w := bookBundle("1", "5")
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, CodeMemberTimeConflict, errorResponse.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses[0].Bookings))
+	})
+	t.Run("try book an empty bundle", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+
+		w := bookBundle()
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, MissingClassIDs, errorResponse.Err)
+	})
+}
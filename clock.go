@@ -0,0 +1,34 @@
+package main
+
+import "time"
+
+// serverLocation is the timezone the gym runs in, set by SERVER_TIMEZONE and defaulting to UTC
+func (server *Server) serverLocation() *time.Location {
+	if server.config.Timezone == nil {
+		return time.UTC
+	}
+	return server.config.Timezone
+}
+
+// today returns the current date in the server's timezone, as midnight UTC so it compares directly with class dates
+func (server *Server) today() time.Time {
+	year, month, day := server.now().In(server.serverLocation()).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// bookingTooLate reports whether it is now less than MIN_ADVANCE_MINUTES before the class starts
+func (server *Server) bookingTooLate(class *Class) bool {
+	minAdvance := time.Duration(server.config.MinAdvanceMinutes) * time.Minute
+	return minAdvance > 0 && server.classStart(class).Sub(server.now()) < minAdvance
+}
+
+// classStart returns when a class starts in the server's timezone, at its StartTime if it has one and otherwise at the
+// start of its day
+func (server *Server) classStart(class *Class) time.Time {
+	year, month, day := class.Date.Date()
+	startTime, err := time.Parse(layoutTime, class.StartTime)
+	if err != nil {
+		return time.Date(year, month, day, 0, 0, 0, 0, server.serverLocation())
+	}
+	return time.Date(year, month, day, startTime.Hour(), startTime.Minute(), 0, 0, server.serverLocation())
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings read from the environment at startup
+type Config struct {
+	// Port is the port the server listens on, empty uses defaultPort
+	Port      string
+	LogLevel  string
+	LogFormat string
+	// APIPrefix is the path the routes are served under, empty uses defaultAPIPrefix and "/" serves them at the root
+	APIPrefix string
+	// ClassCatalog restricts class names to this list when it isn't empty, names are matched case-insensitively
+	ClassCatalog []string
+	// CancelCutoffHours is how long before a class starts bookings stop being cancellable, 0 allows cancelling any time
+	CancelCutoffHours int
+	// IDStrategy selects how ids are generated, either uuid or sequential
+	IDStrategy string
+	// MaxWaitlist is the default waitlist size for new classes, nil leaves waitlists unlimited and 0 disables them
+	MaxWaitlist *int
+	// Timezone is used to work out what "today" is for the gym, nil is UTC
+	Timezone *time.Location
+	// MaxBookingWait caps how long a booking can wait for a spot in a full class, 0 uses defaultMaxBookingWait
+	MaxBookingWait time.Duration
+	// DefaultRangeDays is how many days of classes are created when no end date is given, 0 uses defaultRangeDays
+	DefaultRangeDays int
+	// SeedDemo fills an empty store with sample classes and bookings at startup
+	SeedDemo bool
+	// MaxSessionsPerDay caps how many classes with the same name can be on one day, 0 is unlimited
+	MaxSessionsPerDay int
+	// CooldownMinutes is the gap there must be between classes in the same location, 0 only stops them overlapping
+	CooldownMinutes int
+	// RejectTimeConflicts stops a member booking a class that overlaps another class they are booked into
+	RejectTimeConflicts bool
+	// BookingWindowDays is how many days before a class bookings open, 0 lets classes be booked any time
+	BookingWindowDays int
+	// MinAdvanceMinutes is how long before a class starts bookings close, 0 lets classes be booked up to their start
+	MinAdvanceMinutes int
+	// HoldDuration is how long a held spot is kept for a member, 0 uses defaultHoldDuration
+	HoldDuration time.Duration
+	// ReadHeaderTimeout caps how long a client can take to send request headers, 0 uses defaultReadHeaderTimeout
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout caps how long a client can take to send a whole request, 0 uses defaultReadTimeout
+	ReadTimeout time.Duration
+	// DataFile is where classes and their bookings are saved so they survive a restart, empty keeps them in memory only
+	DataFile string
+	// PersistFailurePolicy is what happens to a change that can't be saved to the data file, either persistMemoryOnly
+	// or persistRollback. Empty is persistMemoryOnly.
+	PersistFailurePolicy string
+	// StrictLoad stops startup when the data file holds invalid classes, otherwise they are quarantined, see
+	// loadClasses
+	StrictLoad bool
+	// ReadOnly starts the server in read-only mode, see rejectWritesWhenReadOnly. It can be changed while running
+	// through `/admin/read-only`.
+	ReadOnly bool
+	// AdminEnabled serves the `/admin` routes, they aren't routed at all otherwise
+	AdminEnabled bool
+	// CORSAllowedOrigins are the origins browsers may call the API from, "*" allows any origin and empty disables CORS
+	CORSAllowedOrigins []string
+	// CORSAllowedMethods are the methods allowed in cross-origin requests, empty uses defaultCORSAllowedMethods
+	CORSAllowedMethods []string
+	// CORSAllowCredentials lets browsers send cookies and credentials with cross-origin requests, it can't be used
+	// with the "*" origin
+	CORSAllowCredentials bool
+	// MaxConcurrentRequests caps how many requests are handled at once, 0 uses defaultMaxConcurrentRequests
+	MaxConcurrentRequests int
+	// MaxBatchSize caps how many items a bulk request such as a CSV import can hold, 0 uses defaultMaxBatchSize
+	MaxBatchSize int
+	// APIKey, when set, must be sent in the X-API-Key header to use the `/admin` routes. It is a secret so it is never
+	// written out.
+	APIKey string
+	// JWTSecret, when set, is the HS256 secret bearer tokens must be signed with to use the API, see
+	// requireBearerToken. It is a secret so it is never written out.
+	JWTSecret string
+}
+
+// the policies for a change that can't be saved to the data file, PERSIST_FAILURE_POLICY. With memory-only it is kept
+// in memory and the response has an `X-Durability: memory-only` header, with rollback it is undone and 500 returned.
+// Every change goes through commitChanges so each is handled the same way.
+const (
+	persistMemoryOnly = "memory-only"
+	persistRollback   = "rollback"
+)
+
+// defaultPort is the port the server listens on when PORT isn't set
+const defaultPort = "10000"
+
+// defaultAPIPrefix is the path the routes are served under when API_PREFIX isn't set
+const defaultAPIPrefix = "/v1"
+
+// defaultMaxBookingWait is the longest a booking can wait for a spot when MAX_BOOKING_WAIT isn't set
+const defaultMaxBookingWait = 5 * time.Second
+
+// the longest a client can take to send a request's headers, READ_HEADER_TIMEOUT, and the whole request including its
+// body, READ_TIMEOUT, when they aren't set. These stop slow clients tying up the server.
+const (
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+)
+
+// defaultHoldDuration is how long a held spot is kept when HOLD_DURATION isn't set
+const defaultHoldDuration = 5 * time.Minute
+
+// defaultCORSAllowedMethods are the methods allowed in cross-origin requests when CORS_ALLOWED_METHODS isn't set
+var defaultCORSAllowedMethods = []string{"GET", "POST", "PUT", "PATCH"}
+
+// defaultMaxConcurrentRequests is the most requests handled at once when MAX_CONCURRENT_REQUESTS isn't set
+const defaultMaxConcurrentRequests = 100
+
+// defaultMaxBatchSize is the most items a bulk request can hold when MAX_BATCH_SIZE isn't set
+const defaultMaxBatchSize = 500
+
+// defaultRangeDays is how many days of classes an open ended range creates when DEFAULT_RANGE_DAYS isn't set
+const defaultRangeDays = 28
+
+// loadConfig reads the configuration from environment variables, unset variables keep their defaults
+func loadConfig() (Config, error) {
+	loaded := Config{
+		Port:         os.Getenv("PORT"),
+		APIPrefix:    os.Getenv("API_PREFIX"),
+		LogLevel:     os.Getenv("LOG_LEVEL"),
+		LogFormat:    os.Getenv("LOG_FORMAT"),
+		ClassCatalog: splitList(os.Getenv("CLASS_CATALOG")),
+		IDStrategy:   os.Getenv("ID_STRATEGY"),
+		APIKey:       os.Getenv("API_KEY"),
+		JWTSecret:    os.Getenv("JWT_SECRET"),
+		DataFile:     os.Getenv("DATA_FILE"),
+
+		CORSAllowedOrigins: splitList(os.Getenv("CORS_ALLOWED_ORIGINS")),
+		CORSAllowedMethods: splitList(os.Getenv("CORS_ALLOWED_METHODS")),
+	}
+
+	if loaded.APIPrefix != "" && !strings.HasPrefix(loaded.APIPrefix, "/") {
+		return Config{}, fmt.Errorf("API_PREFIX should start with /, got %q", loaded.APIPrefix)
+	}
+
+	var err error
+	loaded.CancelCutoffHours, err = intFromEnv("CANCEL_CUTOFF_HOURS", 0)
+	if err != nil {
+		return Config{}, err
+	}
+	loaded.DefaultRangeDays, err = intFromEnv("DEFAULT_RANGE_DAYS", 0)
+	if err != nil {
+		return Config{}, err
+	}
+	loaded.MaxSessionsPerDay, err = intFromEnv("MAX_SESSIONS_PER_DAY", 0)
+	if err != nil {
+		return Config{}, err
+	}
+	loaded.CooldownMinutes, err = intFromEnv("COOLDOWN_MINUTES", 0)
+	if err != nil {
+		return Config{}, err
+	}
+	loaded.BookingWindowDays, err = intFromEnv("BOOKING_WINDOW_DAYS", 0)
+	if err != nil {
+		return Config{}, err
+	}
+	loaded.MinAdvanceMinutes, err = intFromEnv("MIN_ADVANCE_MINUTES", 0)
+	if err != nil {
+		return Config{}, err
+	}
+	loaded.MaxConcurrentRequests, err = intFromEnv("MAX_CONCURRENT_REQUESTS", 0)
+	if err != nil {
+		return Config{}, err
+	}
+	loaded.MaxBatchSize, err = intFromEnv("MAX_BATCH_SIZE", 0)
+	if err != nil {
+		return Config{}, err
+	}
+	loaded.SeedDemo, err = boolFromEnv("SEED_DEMO")
+	if err != nil {
+		return Config{}, err
+	}
+	loaded.AdminEnabled, err = boolFromEnv("ENABLE_ADMIN")
+	if err != nil {
+		return Config{}, err
+	}
+	loaded.PersistFailurePolicy = os.Getenv("PERSIST_FAILURE_POLICY")
+	switch loaded.PersistFailurePolicy {
+	case "", persistMemoryOnly, persistRollback:
+	default:
+		return Config{}, fmt.Errorf("PERSIST_FAILURE_POLICY should be %s or %s, got %q", persistMemoryOnly, persistRollback, loaded.PersistFailurePolicy)
+	}
+	loaded.ReadOnly, err = boolFromEnv("READ_ONLY")
+	if err != nil {
+		return Config{}, err
+	}
+	loaded.RejectTimeConflicts, err = boolFromEnv("REJECT_TIME_CONFLICTS")
+	if err != nil {
+		return Config{}, err
+	}
+	loaded.StrictLoad, err = boolFromEnv("STRICT_LOAD")
+	if err != nil {
+		return Config{}, err
+	}
+	loaded.CORSAllowCredentials, err = boolFromEnv("CORS_ALLOW_CREDENTIALS")
+	if err != nil {
+		return Config{}, err
+	}
+	if loaded.CORSAllowCredentials && containsString(loaded.CORSAllowedOrigins, "*") {
+		return Config{}, fmt.Errorf("CORS_ALLOW_CREDENTIALS can't be used with the * origin, list the allowed origins in CORS_ALLOWED_ORIGINS instead")
+	}
+	if os.Getenv("MAX_WAITLIST") != "" {
+		maxWaitlist, err := intFromEnv("MAX_WAITLIST", 0)
+		if err != nil {
+			return Config{}, err
+		}
+		loaded.MaxWaitlist = &maxWaitlist
+	}
+	loaded.MaxBookingWait, err = durationFromEnv("MAX_BOOKING_WAIT")
+	if err != nil {
+		return Config{}, err
+	}
+	loaded.HoldDuration, err = durationFromEnv("HOLD_DURATION")
+	if err != nil {
+		return Config{}, err
+	}
+	loaded.ReadHeaderTimeout, err = durationFromEnv("READ_HEADER_TIMEOUT")
+	if err != nil {
+		return Config{}, err
+	}
+	loaded.ReadTimeout, err = durationFromEnv("READ_TIMEOUT")
+	if err != nil {
+		return Config{}, err
+	}
+	if name := os.Getenv("SERVER_TIMEZONE"); name != "" {
+		loaded.Timezone, err = time.LoadLocation(name)
+		if err != nil {
+			return Config{}, fmt.Errorf("SERVER_TIMEZONE should be an IANA timezone such as Europe/London: %w", err)
+		}
+	}
+	return loaded, nil
+}
+
+// intFromEnv reads a whole number of 0 or more from an environment variable, returning fallback when it's unset
+func intFromEnv(name string, fallback int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("%s should be a whole number of 0 or more, got %q", name, value)
+	}
+	return number, nil
+}
+
+// boolFromEnv reads true or false from an environment variable, returning false when it's unset
+func boolFromEnv(name string) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s should be true or false, got %q", name, value)
+	}
+	return enabled, nil
+}
+
+// durationFromEnv reads a duration of 0 or more such as 5s from an environment variable, returning 0 when it's unset
+func durationFromEnv(name string) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("%s should be a duration such as 5s, got %q", name, value)
+	}
+	return duration, nil
+}
+
+// containsString reports whether the list holds the value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma separated environment variable, dropping blank entries
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
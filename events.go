@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// subscriberBuffer is how many events a slow subscriber can fall behind by before further events are dropped for it
+const subscriberBuffer = 16
+
+// OccupancyEvent is sent to a class's subscribers whenever the class or its bookings and holds change
+type OccupancyEvent struct {
+	ClassId        string `json:"class_id"`
+	Capacity       int    `json:"capacity"`
+	Booked         int    `json:"booked"`
+	Waitlisted     int    `json:"waitlisted"`
+	SpotsAvailable int    `json:"spots_available"`
+	Cancelled      bool   `json:"cancelled"`
+}
+
+// newOccupancyEvent counts the bookings of the class, and its holds at now
+func newOccupancyEvent(class *Class, now time.Time) OccupancyEvent {
+	return OccupancyEvent{
+		ClassId:        class.Id,
+		Capacity:       class.Capacity,
+		Booked:         class.countBookings(BookingConfirmed),
+		Waitlisted:     class.countBookings(BookingWaitlisted),
+		SpotsAvailable: class.spotsAvailable(now),
+		Cancelled:      class.Cancelled,
+	}
+}
+
+// classEvents is the registry of who is subscribed to each class's occupancy events, it is safe for concurrent use
+type classEvents struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan OccupancyEvent]struct{}
+}
+
+// subscribe returns a channel the class's events are sent on until it is unsubscribed
+func (events *classEvents) subscribe(classID string) chan OccupancyEvent {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	if events.subscribers == nil {
+		events.subscribers = make(map[string]map[chan OccupancyEvent]struct{})
+	}
+	if events.subscribers[classID] == nil {
+		events.subscribers[classID] = make(map[chan OccupancyEvent]struct{})
+	}
+	subscriber := make(chan OccupancyEvent, subscriberBuffer)
+	events.subscribers[classID][subscriber] = struct{}{}
+	return subscriber
+}
+
+// unsubscribe stops sending the class's events on subscriber
+func (events *classEvents) unsubscribe(classID string, subscriber chan OccupancyEvent) {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	delete(events.subscribers[classID], subscriber)
+	if len(events.subscribers[classID]) == 0 {
+		delete(events.subscribers, classID)
+	}
+}
+
+// subscriberCount returns how many subscribers the class has
+func (events *classEvents) subscriberCount(classID string) int {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	return len(events.subscribers[classID])
+}
+
+// publish sends event to the class's subscribers without waiting, a subscriber whose buffer is full misses it
+func (events *classEvents) publish(event OccupancyEvent) {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	for subscriber := range events.subscribers[event.ClassId] {
+		select {
+		case subscriber <- event:
+		default:
+			logger.Warn("dropped occupancy event for a slow subscriber", "class", event.ClassId)
+		}
+	}
+}
+
+// occupancyChanged sends the class's subscribers its current counts, markClassesChanged calls it, with dbLock held,
+// for every class that changes
+func (server *Server) occupancyChanged(class *Class) {
+	server.events.publish(newOccupancyEvent(class, server.now()))
+}
+
+// getClassEvents is the handler function for GET requests to `/classes/{id}/events`, it holds the connection open as
+// a stream of server-sent events. The class's current occupancy is sent straight away and again as an `occupancy`
+// event whenever the class changes, until the client disconnects.
+func (server *Server) getClassEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		err := errorResponse(w, CodeInternalError, InternalError, http.StatusInternalServerError)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	server.dbLock.RLock()
+	class, err := server.findClassByID(mux.Vars(r)["id"])
+	if err != nil {
+		server.dbLock.RUnlock()
+		err = errorResponse(w, CodeClassDoesNotExists, ClassDoesNotExists, http.StatusNotFound)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	// subscribing under the lock means no change can slip in between the current occupancy and the first event
+	subscriber := server.events.subscribe(class.Id)
+	current := newOccupancyEvent(class, server.now())
+	server.dbLock.RUnlock()
+	defer server.events.unsubscribe(current.ClassId, subscriber)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	releaseConcurrencySlot(r)
+	logger.Debug("subscribed to class events", "class", current.ClassId)
+	for {
+		data, err := json.Marshal(current)
+		if err == nil {
+			_, err = fmt.Fprintf(w, "event: occupancy\ndata: %s\n\n", data)
+		}
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			logger.Debug("unsubscribed from class events", "class", current.ClassId)
+			return
+		case current = <-subscriber:
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// readOccupancyEvent reads the next server-sent event from stream
+func readOccupancyEvent(t *testing.T, stream *bufio.Reader) OccupancyEvent {
+	t.Helper()
+	var event OccupancyEvent
+	for {
+		line, err := stream.ReadString('\n')
+		if !assert.Nil(t, err) {
+			return event
+		}
+		if data, found := strings.CutPrefix(line, "data: "); found {
+			assert.Nil(t, json.Unmarshal([]byte(data), &event))
+		}
+		if line == "\n" {
+			return event
+		}
+	}
+}
+
+func Test_getClassEvents(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	testServer.config.IDStrategy = "sequential"
+	defer func() { testServer.config.IDStrategy = "" }()
+	t.Run("receive an event when the class is booked", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{Id: "7", Name: "kayak", Date: time.Date(2006, 1, 1, 0, 0, 0, 0, time.UTC), Capacity: 2},
+		}
+		server := httptest.NewServer(testServer.newRouter())
+		defer server.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		r, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/v1/classes/7/events", nil)
+		response, err := http.DefaultClient.Do(r)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+		stream := bufio.NewReader(response.Body)
+
+		assert.Equal(t, OccupancyEvent{ClassId: "7", Capacity: 2, SpotsAvailable: 2}, readOccupancyEvent(t, stream))
+
+		body, _ := json.Marshal(BookingRequest{MemberName: "David", ClassName: "kayak", Date: "2006-01-01"})
+		r, _ = http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createBooking(w, r)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		assert.Equal(t, OccupancyEvent{ClassId: "7", Capacity: 2, Booked: 1, SpotsAvailable: 1}, readOccupancyEvent(t, stream))
+
+		cancel()
+		assert.Eventually(t, func() bool {
+			return testServer.events.subscriberCount("7") == 0
+		}, time.Second, 10*time.Millisecond)
+	})
+	t.Run("try subscribe to a class that doesn't exist", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+		r, _ := http.NewRequest("GET", "/classes/7/events", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "7"})
+		w := httptest.NewRecorder()
+
+		testServer.getClassEvents(w, r)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, 0, testServer.events.subscriberCount("7"))
+	})
+}
+
+func Test_classEventsPublish(t *testing.T) {
+	var events classEvents
+	subscriber := events.subscribe("1")
+	other := events.subscribe("2")
+
+	for i := 0; i < subscriberBuffer+1; i++ {
+		events.publish(OccupancyEvent{ClassId: "1", Booked: i})
+	}
+
+	assert.Equal(t, subscriberBuffer, len(subscriber))
+	assert.Equal(t, 0, len(other))
+	events.unsubscribe("1", subscriber)
+	assert.Equal(t, 0, events.subscriberCount("1"))
+	assert.Equal(t, 1, events.subscriberCount("2"))
+}
+
+func Test_occupancyChangedOnEveryChange(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "kayak", Date: time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC), Capacity: 2, Version: 1},
+	}
+	subscriber := testServer.events.subscribe("1")
+	defer testServer.events.unsubscribe("1", subscriber)
+	send := func(handler http.HandlerFunc, method, body string, header ...string) int {
+		r, _ := http.NewRequest(method, "/classes/1", strings.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		if len(header) == 2 {
+			r.Header.Set(header[0], header[1])
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+	next := func() OccupancyEvent {
+		select {
+		case event := <-subscriber:
+			return event
+		default:
+			t.Fatal("no occupancy event was published")
+			return OccupancyEvent{}
+		}
+	}
+
+	t.Run("holding a spot", func(t *testing.T) {
+		assert.Equal(t, http.StatusCreated, send(testServer.createHold, "POST", `{"member_name": "Tom"}`))
+		assert.Equal(t, OccupancyEvent{ClassId: "1", Capacity: 2, SpotsAvailable: 1}, next())
+	})
+	t.Run("sweeping away the expired hold", func(t *testing.T) {
+		testServer.now = func() time.Time { return testClock().Add(time.Hour) }
+		defer func() { testServer.now = testClock }()
+
+		assert.Equal(t, 1, testServer.sweepExpiredHolds())
+		assert.Equal(t, OccupancyEvent{ClassId: "1", Capacity: 2, SpotsAvailable: 2}, next())
+	})
+	t.Run("changing the capacity", func(t *testing.T) {
+		code := send(testServer.updateClass, "PATCH", `{"capacity": 5}`, "If-Match", testServer.DBClasses[0].etag())
+
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, OccupancyEvent{ClassId: "1", Capacity: 5, SpotsAvailable: 5}, next())
+	})
+	t.Run("reopening a cancelled class", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send(testServer.cancelClass, "POST", ""))
+		assert.Equal(t, OccupancyEvent{ClassId: "1", Capacity: 5, SpotsAvailable: 5, Cancelled: true}, next())
+
+		assert.Equal(t, http.StatusOK, send(testServer.reopenClass, "POST", ""))
+		assert.Equal(t, OccupancyEvent{ClassId: "1", Capacity: 5, SpotsAvailable: 5}, next())
+	})
+}
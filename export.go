@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// bookingsCSVHeader is the header row of the bookings export
+var bookingsCSVHeader = []string{
+	"booking_id", "member_name", "member_email", "status", "created_at", "class_id", "class_name", "class_date",
+}
+
+// exportBookingsCSV is the handler function for GET requests to `/bookings.csv`, it writes every booking, one row
+// each alongside its class, as CSV ordered by class date. Only classes between the optional `from` and `to` dates,
+// inclusive, and with the optional `class_name`, ignoring case, are exported. Bookings of every status are included
+// so they can be reconciled.
+func (server *Server) exportBookingsCSV(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to, err := parseStatsRange(query)
+	if err != nil {
+		err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	className := query.Get("class_name")
+
+	server.dbLock.RLock()
+	classes := make([]Class, 0)
+	for _, class := range applyClassFilters(server.DBClasses, nil) {
+		if (!from.IsZero() && class.Date.Before(from)) || (!to.IsZero() && class.Date.After(to)) {
+			continue
+		}
+		if className != "" && !strings.EqualFold(class.Name, className) {
+			continue
+		}
+		class.Bookings = append([]Booking(nil), class.Bookings...)
+		classes = append(classes, class)
+	}
+	server.dbLock.RUnlock()
+	sort.SliceStable(classes, func(i, j int) bool {
+		return classes[i].Date.Before(classes[j].Date)
+	})
+
+	rows := 0
+	w.Header().Set("Content-Type", "text/csv")
+	writer := csv.NewWriter(w)
+	err = writer.Write(bookingsCSVHeader)
+	for _, class := range classes {
+		for _, booking := range class.Bookings {
+			if err != nil {
+				break
+			}
+			err = writer.Write([]string{
+				booking.Id,
+				booking.MemberName,
+				booking.MemberEmail,
+				booking.Status,
+				booking.CreatedAt.Format(time.RFC3339),
+				class.Id,
+				class.Name,
+				class.Date.Format(layoutISO),
+			})
+			rows++
+		}
+	}
+	writer.Flush()
+	if err == nil {
+		err = writer.Error()
+	}
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+		return
+	}
+	logger.Debug("exported bookings", "rows", rows)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_exportBookingsCSV(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	booked := time.Date(2021, 1, 1, 9, 0, 0, 0, time.UTC)
+	testServer.DBClasses = []Class{
+		{
+			Id:       "2",
+			Name:     "yoga",
+			Date:     time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC),
+			Bookings: []Booking{{MemberName: "Sarah", Id: "c", Status: BookingConfirmed, CreatedAt: booked}},
+		},
+		{
+			Id:   "1",
+			Name: "kayak",
+			Date: time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC),
+			Bookings: []Booking{
+				{MemberName: "David", MemberEmail: "david@example.com", Id: "a", Status: BookingConfirmed, CreatedAt: booked},
+				{MemberName: "Tom", Id: "b", Status: BookingCancelled, CreatedAt: booked},
+			},
+		},
+		{
+			Id:       "3",
+			Name:     "kayak",
+			Date:     time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC),
+			Bookings: []Booking{{MemberName: "Priya", Id: "d", Status: BookingWaitlisted, CreatedAt: booked}},
+		},
+		{
+			Id:       "4",
+			Name:     "kayak",
+			Date:     time.Date(2021, 1, 6, 0, 0, 0, 0, time.UTC),
+			Bookings: []Booking{{MemberName: "Alex", Id: "e", Status: BookingConfirmed, CreatedAt: booked}},
+			Deleted:  true,
+		},
+	}
+	export := func(query string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/bookings.csv"+query, nil)
+		w := httptest.NewRecorder()
+		testServer.exportBookingsCSV(w, r)
+		return w
+	}
+	header := "booking_id,member_name,member_email,status,created_at,class_id,class_name,class_date\n"
+
+	t.Run("export every booking in class date order", func(t *testing.T) {
+		w := export("")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+		assert.Equal(t, header+
+			"a,David,david@example.com,confirmed,2021-01-01T09:00:00Z,1,kayak,2021-01-05\n"+
+			"b,Tom,,cancelled,2021-01-01T09:00:00Z,1,kayak,2021-01-05\n"+
+			"c,Sarah,,confirmed,2021-01-01T09:00:00Z,2,yoga,2021-01-10\n"+
+			"d,Priya,,waitlisted,2021-01-01T09:00:00Z,3,kayak,2021-02-01\n", w.Body.String())
+	})
+	t.Run("export the bookings of classes in a date range", func(t *testing.T) {
+		w := export("?from=2021-01-06&to=2021-01-31")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, header+"c,Sarah,,confirmed,2021-01-01T09:00:00Z,2,yoga,2021-01-10\n", w.Body.String())
+	})
+	t.Run("export the bookings of classes with a name", func(t *testing.T) {
+		w := export("?class_name=KAYAK&to=2021-01-31")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, header+
+			"a,David,david@example.com,confirmed,2021-01-01T09:00:00Z,1,kayak,2021-01-05\n"+
+			"b,Tom,,cancelled,2021-01-01T09:00:00Z,1,kayak,2021-01-05\n", w.Body.String())
+	})
+	t.Run("try export with an invalid date", func(t *testing.T) {
+		w := export("?from=05-01-2021")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), CodeInvalidDate)
+	})
+	t.Run("try export with from after to", func(t *testing.T) {
+		w := export("?from=2021-02-01&to=2021-01-01")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), CodeInvalidDateRange)
+	})
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// classFilter reports whether a class should be included when listing classes
+type classFilter func(class Class) bool
+
+// parseClassFilters builds the filters asked for by the query parameters of a GET `/classes` request. Filters combine
+// with AND semantics, a class must match every filter to be listed, so `?name=kayak&available=true&upcoming=true` lists
+// only kayak classes from today on that still have a spot.
+func (server *Server) parseClassFilters(query url.Values) ([]classFilter, error) {
+	var filters []classFilter
+
+	if value := query.Get("day_of_week"); value != "" {
+		weekday, err := parseWeekday(value)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, func(class Class) bool {
+			return class.Date.Weekday() == weekday
+		})
+	}
+
+	for _, param := range []string{"upcoming", "past"} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		wanted, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, newValidationError(CodeInvalidBoolean, InvalidBoolean+param)
+		}
+		if !wanted {
+			continue
+		}
+		// today is worked out once per request so every class is compared against the same day
+		startOfToday := server.today()
+		if param == "upcoming" {
+			filters = append(filters, func(class Class) bool {
+				return !class.Date.Before(startOfToday)
+			})
+		} else {
+			filters = append(filters, func(class Class) bool {
+				return class.Date.Before(startOfToday)
+			})
+		}
+	}
+
+	if value := query.Get("name"); value != "" {
+		filters = append(filters, func(class Class) bool {
+			return strings.EqualFold(class.Name, value)
+		})
+	}
+
+	if value := query.Get("available"); value != "" {
+		available, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, newValidationError(CodeInvalidBoolean, InvalidBoolean+"available")
+		}
+		filters = append(filters, func(class Class) bool {
+			return (!class.isFull(server.now()) && !class.Cancelled) == available
+		})
+	}
+
+	if value := query.Get("location"); value != "" {
+		filters = append(filters, func(class Class) bool {
+			return strings.EqualFold(class.Location, value)
+		})
+	}
+
+	if value := query.Get("min_capacity"); value != "" {
+		minCapacity, err := strconv.Atoi(value)
+		if err != nil || minCapacity < 0 {
+			return nil, newValidationError(CodeInvalidMinCapacity, InvalidMinCapacity)
+		}
+		filters = append(filters, func(class Class) bool {
+			return class.Capacity >= minCapacity
+		})
+	}
+
+	// members waiting on a class show demand for more sessions of it
+	if value := query.Get("has_waitlist"); value != "" {
+		hasWaitlist, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, newValidationError(CodeInvalidBoolean, InvalidBoolean+"has_waitlist")
+		}
+		filters = append(filters, func(class Class) bool {
+			return (class.countBookings(BookingWaitlisted) > 0) == hasWaitlist
+		})
+	}
+
+	return filters, nil
+}
+
+// onDate is a filter matching the classes on the date
+func onDate(date time.Time) classFilter {
+	return func(class Class) bool {
+		return class.Date.Equal(date)
+	}
+}
+
+// withCreationKey is a filter matching the classes created by a request with the natural key, see classCreationKey
+func withCreationKey(key string) classFilter {
+	return func(class Class) bool {
+		return class.CreationKey == key
+	}
+}
+
+// applyClassFilters returns the classes matching all of the filters, deleted classes are always left out
+func applyClassFilters(classes []Class, filters []classFilter) []Class {
+	filtered := make([]Class, 0)
+classes:
+	for _, class := range classes {
+		if class.Deleted {
+			continue
+		}
+		for _, filter := range filters {
+			if !filter(class) {
+				continue classes
+			}
+		}
+		filtered = append(filtered, class)
+	}
+	return filtered
+}
+
+// parseWeekday parses a weekday from its short ("Mon") or long ("Monday") name, ignoring case
+func parseWeekday(value string) (time.Weekday, error) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(value, day.String()) || strings.EqualFold(value, day.String()[:3]) {
+			return day, nil
+		}
+	}
+	return 0, newValidationError(CodeInvalidDayOfWeek, InvalidDayOfWeek)
+}
+
+// defaultPageLimit is the page size used when only an offset is given
+const defaultPageLimit = 50
+
+// pagination is the page of a listing asked for with the limit and offset query parameters
+type pagination struct {
+	limit  int
+	offset int
+}
+
+// parsePagination reads the limit and offset query parameters, it returns nil when neither is present
+func parsePagination(query url.Values) (*pagination, error) {
+	if query.Get("limit") == "" && query.Get("offset") == "" {
+		return nil, nil
+	}
+
+	page := &pagination{limit: defaultPageLimit}
+	var err error
+	if value := query.Get("limit"); value != "" {
+		page.limit, err = strconv.Atoi(value)
+		if err != nil || page.limit < 1 {
+			return nil, newValidationError(CodeInvalidPagination, InvalidPagination)
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		page.offset, err = strconv.Atoi(value)
+		if err != nil || page.offset < 0 {
+			return nil, newValidationError(CodeInvalidPagination, InvalidPagination)
+		}
+	}
+	return page, nil
+}
+
+// slice returns the classes that fall within the page
+func (page *pagination) slice(classes []Class) []Class {
+	if page.offset >= len(classes) {
+		return []Class{}
+	}
+	end := page.offset + page.limit
+	if end > len(classes) {
+		end = len(classes)
+	}
+	return classes[page.offset:end]
+}
@@ -0,0 +1,703 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// listClasses calls getClasses with the given query string and returns the recorder and any classes in the body
+func listClasses(query string) (*httptest.ResponseRecorder, []Class) {
+	r, _ := http.NewRequest("GET", "/classes"+query, nil)
+	w := httptest.NewRecorder()
+	testServer.getClasses(w, r)
+
+	var response []Class
+	respBody, _ := ioutil.ReadAll(w.Body)
+	json.Unmarshal(respBody, &response)
+	return w, response
+}
+
+func classIDs(classes []Class) []string {
+	ids := make([]string, 0, len(classes))
+	for _, class := range classes {
+		ids = append(ids, class.Id)
+	}
+	return ids
+}
+
+func Test_getClassesDayOfWeek(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	testServer.DBClasses = []Class{
+		// 2021-01-04 is a Monday
+		{Id: "1", Name: "kayak", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		{Id: "2", Name: "kayak", Date: time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		{Id: "3", Name: "yoga", Date: time.Date(2021, 1, 11, 0, 0, 0, 0, time.UTC), Capacity: 10},
+	}
+	testServer.markClassesChanged()
+
+	t.Run("filter by a weekday with matching classes", func(t *testing.T) {
+		w, response := listClasses("?day_of_week=mon")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"1", "3"}, classIDs(response))
+
+		_, response = listClasses("?day_of_week=MONDAY")
+		assert.Equal(t, []string{"1", "3"}, classIDs(response))
+	})
+	t.Run("filter by a weekday with no classes", func(t *testing.T) {
+		w, response := listClasses("?day_of_week=Sunday")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotNil(t, response)
+		assert.Equal(t, []string{}, classIDs(response))
+	})
+	t.Run("try filter by an unknown weekday", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/classes?day_of_week=Funday", nil)
+		w := httptest.NewRecorder()
+		testServer.getClasses(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, InvalidDayOfWeek, errorResponse.Err)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func Test_getClassesTotals(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	confirmed := Booking{MemberName: "David", Id: "a", Status: BookingConfirmed}
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "kayak", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10,
+			Bookings: []Booking{confirmed, confirmed, {MemberName: "Sarah", Id: "b", Status: BookingCancelled}}},
+		{Id: "2", Name: "kayak", Date: time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC), Capacity: 5,
+			Bookings: []Booking{confirmed}},
+		{Id: "3", Name: "yoga", Date: time.Date(2021, 1, 11, 0, 0, 0, 0, time.UTC), Capacity: 20,
+			Bookings: []Booking{confirmed, {MemberName: "Tom", Id: "c", Status: BookingWaitlisted}}},
+	}
+	testServer.markClassesChanged()
+
+	t.Run("totals cover every class", func(t *testing.T) {
+		w, _ := listClasses("")
+
+		assert.Equal(t, "35", w.Header().Get("X-Total-Capacity"))
+		assert.Equal(t, "4", w.Header().Get("X-Total-Booked"))
+	})
+	t.Run("totals cover only the filtered classes", func(t *testing.T) {
+		w, response := listClasses("?day_of_week=Monday")
+
+		assert.Equal(t, []string{"1", "3"}, classIDs(response))
+		assert.Equal(t, "30", w.Header().Get("X-Total-Capacity"))
+		assert.Equal(t, "3", w.Header().Get("X-Total-Booked"))
+	})
+}
+
+func Test_getClassesPagination(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	testServer.DBClasses = []Class{}
+	for day := 1; day <= 5; day++ {
+		testServer.DBClasses = append(testServer.DBClasses, Class{
+			Id:       strconv.Itoa(day),
+			Name:     "kayak",
+			Date:     time.Date(2021, 1, day, 0, 0, 0, 0, time.UTC),
+			Capacity: 10,
+		})
+	}
+	testServer.markClassesChanged()
+
+	t.Run("get a middle page with its metadata", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/classes?limit=2&offset=2", nil)
+		w := httptest.NewRecorder()
+		testServer.getClasses(w, r)
+
+		var response PageResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"3", "4"}, classIDs(response.Data))
+		assert.Equal(t, 5, response.Total)
+		assert.Equal(t, 2, response.Limit)
+		assert.Equal(t, 2, response.Offset)
+	})
+	t.Run("total counts the filtered classes before paging", func(t *testing.T) {
+		// 2021-01-04 is the only Monday
+		r, _ := http.NewRequest("GET", "/classes?day_of_week=Mon&offset=0", nil)
+		w := httptest.NewRecorder()
+		testServer.getClasses(w, r)
+
+		var response PageResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, []string{"4"}, classIDs(response.Data))
+		assert.Equal(t, 1, response.Total)
+		assert.Equal(t, defaultPageLimit, response.Limit)
+	})
+	t.Run("without limit or offset the response is a plain array", func(t *testing.T) {
+		w, response := listClasses("")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 5, len(response))
+	})
+	t.Run("try get a page with a negative offset", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/classes?offset=-1", nil)
+		w := httptest.NewRecorder()
+		testServer.getClasses(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, InvalidPagination, errorResponse.Err)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func Test_getClassesLocation(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	t.Run("create a class with a location and filter by it", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{Id: "1", Name: "yoga", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10, Location: "Studio B"},
+			{Id: "2", Name: "yoga", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		}
+
+		body := []byte(`{"name": "kayak","start_date": "2021-01-04","end_date": "2021-01-04", "capacity": 8, "location": "Studio A"}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createClass(w, r)
+
+		var created []Class
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &created)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "Studio A", created[0].Location)
+		assert.Contains(t, string(respBody), `"location":"Studio A"`)
+
+		w, response := listClasses("?location=studio%20a")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 1, len(response))
+		assert.Equal(t, "kayak", response[0].Name)
+	})
+	t.Run("try create a class with an empty location", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		body := []byte(`{"name": "kayak","start_date": "2021-01-04","end_date": "2021-01-04", "capacity": 8, "location": " "}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createClass(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, InvalidLocation, errorResponse.Err)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses))
+	})
+	t.Run("try create a class with a location that is too long", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		location := strings.Repeat("a", maxLocationLength+1)
+		body := []byte(`{"name": "kayak","start_date": "2021-01-04","end_date": "2021-01-04", "capacity": 8, "location": "` + location + `"}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createClass(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses))
+	})
+}
+
+func Test_getClassesMinCapacity(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "kayak", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		{Id: "2", Name: "spin", Date: time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC), Capacity: 40},
+		{Id: "3", Name: "yoga", Date: time.Date(2021, 1, 6, 0, 0, 0, 0, time.UTC), Capacity: 25},
+	}
+	testServer.markClassesChanged()
+
+	t.Run("filter by a minimum capacity some classes meet", func(t *testing.T) {
+		w, response := listClasses("?min_capacity=25")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"2", "3"}, classIDs(response))
+	})
+	t.Run("filter by a minimum capacity no classes meet", func(t *testing.T) {
+		w, response := listClasses("?min_capacity=41")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{}, classIDs(response))
+	})
+	t.Run("try filter by a negative minimum capacity", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/classes?min_capacity=-1", nil)
+		w := httptest.NewRecorder()
+		testServer.getClasses(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, InvalidMinCapacity, errorResponse.Err)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func Test_getClassesHasWaitlist(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	testServer.DBClasses = []Class{
+		{
+			Id: "1", Name: "kayak", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 1,
+			Bookings: []Booking{
+				{Id: "1", MemberName: "David", Status: BookingConfirmed},
+				{Id: "2", MemberName: "Alex", Status: BookingWaitlisted},
+			},
+		},
+		{
+			Id: "2", Name: "spin", Date: time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC), Capacity: 10,
+			Bookings: []Booking{{Id: "3", MemberName: "Sam", Status: BookingConfirmed}},
+		},
+	}
+	testServer.markClassesChanged()
+
+	t.Run("filter to the classes with members waiting", func(t *testing.T) {
+		w, response := listClasses("?has_waitlist=true")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"1"}, classIDs(response))
+	})
+	t.Run("filter to the classes nobody is waiting for", func(t *testing.T) {
+		w, response := listClasses("?has_waitlist=false")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"2"}, classIDs(response))
+	})
+	t.Run("try filter with a has_waitlist that isn't a boolean", func(t *testing.T) {
+		w, _ := listClasses("?has_waitlist=maybe")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func Test_getClassesUpcoming(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "kayak", Date: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		{Id: "2", Name: "kayak", Date: time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		{Id: "3", Name: "kayak", Date: time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC), Capacity: 10},
+	}
+	// late on the 1st in UTC is already the 2nd in Auckland
+	testServer.now = func() time.Time {
+		return time.Date(2021, 1, 1, 23, 30, 0, 0, time.UTC)
+	}
+	defer func() {
+		testServer.now = testClock
+		testServer.config.Timezone = nil
+	}()
+
+	t.Run("today defaults to UTC", func(t *testing.T) {
+		testServer.config.Timezone = nil
+
+		_, upcoming := listClasses("?upcoming=true")
+		_, past := listClasses("?past=true")
+
+		assert.Equal(t, []string{"1", "2", "3"}, classIDs(upcoming))
+		assert.Equal(t, []string{}, classIDs(past))
+	})
+	t.Run("today follows the server timezone at the day boundary", func(t *testing.T) {
+		auckland, err := time.LoadLocation("Pacific/Auckland")
+		assert.Nil(t, err)
+		testServer.config.Timezone = auckland
+
+		_, upcoming := listClasses("?upcoming=true")
+		_, past := listClasses("?past=true")
+
+		assert.Equal(t, []string{"2", "3"}, classIDs(upcoming))
+		assert.Equal(t, []string{"1"}, classIDs(past))
+	})
+	t.Run("try filter with a value that isn't a boolean", func(t *testing.T) {
+		w, _ := listClasses("?upcoming=soon")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func Test_getClassesCombinedFilters(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	testServer.now = func() time.Time {
+		return time.Date(2021, 1, 6, 12, 0, 0, 0, time.UTC)
+	}
+	defer func() {
+		testServer.now = testClock
+	}()
+	full := []Booking{{MemberName: "David", Id: "a", Status: BookingConfirmed}}
+	testServer.DBClasses = []Class{
+		{Id: "past-open", Name: "kayak", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		{Id: "future-full", Name: "kayak", Date: time.Date(2021, 1, 7, 0, 0, 0, 0, time.UTC), Capacity: 1, Bookings: full},
+		{Id: "future-open", Name: "Kayak", Date: time.Date(2021, 1, 8, 0, 0, 0, 0, time.UTC), Capacity: 10, Bookings: full},
+		{Id: "yoga-open", Name: "yoga", Date: time.Date(2021, 1, 8, 0, 0, 0, 0, time.UTC), Capacity: 10},
+	}
+	testServer.markClassesChanged()
+
+	t.Run("name, available and upcoming must all match", func(t *testing.T) {
+		w, response := listClasses("?name=kayak&available=true&upcoming=true")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"future-open"}, classIDs(response))
+	})
+	t.Run("each filter on its own matches more classes", func(t *testing.T) {
+		_, response := listClasses("?name=kayak")
+		assert.Equal(t, []string{"past-open", "future-full", "future-open"}, classIDs(response))
+
+		_, response = listClasses("?available=true")
+		assert.Equal(t, []string{"past-open", "future-open", "yoga-open"}, classIDs(response))
+
+		_, response = listClasses("?available=false")
+		assert.Equal(t, []string{"future-full"}, classIDs(response))
+	})
+	t.Run("try filter by availability with something other than a boolean", func(t *testing.T) {
+		w, _ := listClasses("?available=maybe")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func Test_getClassesByIDs(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	first := "6f9619ff-8b86-4d11-b42d-00c04fc964ff"
+	second := "7c9e6679-7425-40de-944b-e07fc1f90ae7"
+	unknown := "9b2e1a4c-1f0e-4b6a-9d0c-2b7f3e8a5c11"
+	testServer.DBClasses = []Class{
+		{Id: first, Name: "kayak", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		{Id: second, Name: "yoga", Date: time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC), Capacity: 5},
+	}
+
+	t.Run("get known ids in the requested order and report unknown ones", func(t *testing.T) {
+		w, response := listClasses("?ids=" + second + "," + unknown + "," + first)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{second, first}, classIDs(response))
+		assert.Equal(t, unknown, w.Header().Get("X-Missing-IDs"))
+	})
+	t.Run("no missing header when every id is known", func(t *testing.T) {
+		w, response := listClasses("?ids=" + first)
+
+		assert.Equal(t, []string{first}, classIDs(response))
+		assert.Equal(t, "", w.Header().Get("X-Missing-IDs"))
+	})
+	t.Run("try get classes with an id that isn't a uuid", func(t *testing.T) {
+		w, _ := listClasses("?ids=" + first + ",not-a-uuid")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	t.Run("try get classes with a uuid that isn't in the canonical form", func(t *testing.T) {
+		for _, id := range []string{"{" + first + "}", "urn:uuid:" + first} {
+			w, _ := listClasses("?ids=" + id)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, id)
+		}
+	})
+	t.Run("try use a path id that isn't a uuid", func(t *testing.T) {
+		tests := []struct {
+			method, path, code string
+		}{
+			{"GET", "/classes/{" + first + "}", CodeInvalidClassID},
+			{"GET", "/classes/urn:uuid:" + first + "/events", CodeInvalidClassID},
+			{"POST", "/bookings/a/cancel", CodeInvalidBookingID},
+		}
+		for _, test := range tests {
+			r, _ := http.NewRequest(test.method, test.path, nil)
+			w := httptest.NewRecorder()
+			testServer.newRouter().ServeHTTP(w, r)
+
+			var errorResponse ErrorResponse
+			json.Unmarshal(w.Body.Bytes(), &errorResponse)
+			assert.Equal(t, http.StatusBadRequest, w.Code, test.path)
+			assert.Equal(t, test.code, errorResponse.Code, test.path)
+		}
+	})
+}
+
+func Test_getTodaysClasses(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "kayak", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		{Id: "2", Name: "yoga", Date: time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		{Id: "3", Name: "spin", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10},
+	}
+	getToday := func(now time.Time) (*httptest.ResponseRecorder, []Class) {
+		testServer.now = func() time.Time { return now }
+		defer func() { testServer.now = testClock }()
+		r, _ := http.NewRequest("GET", "/classes/today", nil)
+		w := httptest.NewRecorder()
+		testServer.getTodaysClasses(w, r)
+
+		var response []Class
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+		return w, response
+	}
+
+	t.Run("get the classes on a day with two classes", func(t *testing.T) {
+		w, response := getToday(time.Date(2021, 1, 4, 18, 0, 0, 0, time.UTC))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"1", "3"}, classIDs(response))
+	})
+	t.Run("get the classes on a day in the order they start", func(t *testing.T) {
+		classes := testServer.DBClasses
+		defer func() { testServer.DBClasses = classes }()
+		testServer.DBClasses = []Class{
+			{Id: "1", Name: "kayak", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10, StartTime: "18:00"},
+			{Id: "2", Name: "yoga", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10, StartTime: "07:30"},
+			{Id: "3", Name: "spin", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10, StartTime: "12:00"},
+		}
+
+		w, response := getToday(time.Date(2021, 1, 4, 6, 0, 0, 0, time.UTC))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"2", "3", "1"}, classIDs(response))
+	})
+	t.Run("get the classes on a day with none", func(t *testing.T) {
+		w, response := getToday(time.Date(2021, 1, 6, 9, 0, 0, 0, time.UTC))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotNil(t, response)
+		assert.Equal(t, []string{}, classIDs(response))
+	})
+}
+
+func Test_getClassesGroupByDate(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	day := func(d int) time.Time { return time.Date(2021, 3, d, 0, 0, 0, 0, time.UTC) }
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "yoga", Date: day(3), Capacity: 10},
+		{Id: "2", Name: "kayak", Date: day(1), Capacity: 10},
+		{Id: "3", Name: "lifting", Date: day(2), Capacity: 5},
+		{Id: "4", Name: "pilates", Date: day(1), Capacity: 10},
+		{Id: "5", Name: "kayak", Date: day(3), Capacity: 8},
+	}
+	testServer.markClassesChanged()
+	listGrouped := func(query string) (*httptest.ResponseRecorder, map[string][]Class) {
+		r, _ := http.NewRequest("GET", "/classes"+query, nil)
+		w := httptest.NewRecorder()
+		testServer.getClasses(w, r)
+
+		var response map[string][]Class
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response
+	}
+
+	t.Run("group classes spanning three days by date", func(t *testing.T) {
+		w, response := listGrouped("?group_by=date")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 3, len(response))
+		assert.Equal(t, []string{"2", "4"}, classIDs(response["2021-03-01"]))
+		assert.Equal(t, []string{"3"}, classIDs(response["2021-03-02"]))
+		assert.Equal(t, []string{"1", "5"}, classIDs(response["2021-03-03"]))
+		assert.Equal(t, "43", w.Header().Get("X-Total-Capacity"))
+	})
+	t.Run("group filtered classes by date", func(t *testing.T) {
+		w, response := listGrouped("?group_by=date&name=kayak")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 2, len(response))
+		assert.Equal(t, []string{"2"}, classIDs(response["2021-03-01"]))
+		assert.Equal(t, []string{"5"}, classIDs(response["2021-03-03"]))
+	})
+	t.Run("try group classes by an unknown field", func(t *testing.T) {
+		w, _ := listGrouped("?group_by=name")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	t.Run("try group a page of classes", func(t *testing.T) {
+		w, _ := listGrouped("?group_by=date&limit=2")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func Test_getNextClass(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	full := []Booking{{MemberName: "David", Id: "a", Status: BookingConfirmed}}
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "kayak", Date: time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		{Id: "2", Name: "kayak", Date: time.Date(2021, 1, 9, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		{Id: "3", Name: "kayak", Date: time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC), Capacity: 1, Bookings: full},
+		{Id: "4", Name: "kayak", Date: time.Date(2021, 1, 7, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		{Id: "5", Name: "yoga", Date: time.Date(2021, 1, 6, 0, 0, 0, 0, time.UTC), Capacity: 1, Bookings: full},
+		{Id: "6", Name: "spin", Date: time.Date(2021, 1, 6, 0, 0, 0, 0, time.UTC), Capacity: 10, StartTime: "19:00"},
+		{Id: "7", Name: "spin", Date: time.Date(2021, 1, 6, 0, 0, 0, 0, time.UTC), Capacity: 10, StartTime: "08:00"},
+	}
+	testServer.now = func() time.Time { return time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC) }
+	defer func() { testServer.now = testClock }()
+	getNext := func(name string) (*httptest.ResponseRecorder, Class, ErrorResponse) {
+		r, _ := http.NewRequest("GET", "/classes/next?name="+name, nil)
+		w := httptest.NewRecorder()
+		testServer.getNextClass(w, r)
+
+		var class Class
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &class)
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		return w, class, errorResponse
+	}
+
+	t.Run("get the soonest upcoming class with space", func(t *testing.T) {
+		w, class, _ := getNext("Kayak")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "4", class.Id)
+	})
+	t.Run("get the earlier of two classes on the same day", func(t *testing.T) {
+		w, class, _ := getNext("spin")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "7", class.Id)
+	})
+	t.Run("try get the next class when all are full or past", func(t *testing.T) {
+		w, _, errorResponse := getNext("yoga")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, NoUpcomingClass, errorResponse.Err)
+	})
+	t.Run("try get the next class without a name", func(t *testing.T) {
+		w, _, errorResponse := getNext("")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, MissingClassName, errorResponse.Err)
+	})
+}
+
+func Test_getMemberAvailableClasses(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "kayak", Date: time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		{Id: "2", Name: "kayak", Date: time.Date(2021, 1, 9, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		{
+			Id: "3", Name: "yoga", Date: time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC), Capacity: 10,
+			Bookings: []Booking{{MemberName: "David", Id: "a", Status: BookingConfirmed}},
+		},
+		{
+			Id: "4", Name: "spin", Date: time.Date(2021, 1, 7, 0, 0, 0, 0, time.UTC), Capacity: 10,
+			Bookings: []Booking{{MemberName: "David", Id: "b", Status: BookingCancelled}},
+		},
+	}
+	testServer.now = func() time.Time { return time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC) }
+	defer func() { testServer.now = testClock }()
+
+	t.Run("list the upcoming classes a member isn't booked into", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/members/david/available", nil)
+		r = mux.SetURLVars(r, map[string]string{"name": "david"})
+		w := httptest.NewRecorder()
+
+		testServer.getMemberAvailableClasses(w, r)
+
+		var response []Class
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"4", "2"}, classIDs(response))
+	})
+}
+
+func Test_lookupClass(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "kayak", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		{Id: "2", Name: "kayak", Date: time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC), Capacity: 8},
+	}
+	lookup := func(query string) (*httptest.ResponseRecorder, ClassDetail, ErrorResponse) {
+		r, _ := http.NewRequest("GET", "/classes/lookup"+query, nil)
+		w := httptest.NewRecorder()
+		testServer.lookupClass(w, r)
+
+		var detail ClassDetail
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &detail)
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		return w, detail, errorResponse
+	}
+
+	t.Run("look up a class by name and date", func(t *testing.T) {
+		w, detail, _ := lookup("?name=kayak&date=2021-01-05")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", detail.Id)
+		assert.Equal(t, 8, detail.SpotsAvailable)
+		assert.NotEmpty(t, w.Header().Get("ETag"))
+	})
+	t.Run("try look up a class on a date it isn't on", func(t *testing.T) {
+		w, _, errorResponse := lookup("?name=kayak&date=2021-01-06")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, ClassDoesNotExists, errorResponse.Err)
+	})
+	t.Run("try look up a class with a malformed date", func(t *testing.T) {
+		w, _, errorResponse := lookup("?name=kayak&date=05/01/2021")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, InvalidDate, errorResponse.Err)
+	})
+}
+
+func Test_getClassesDateFormat(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "yoga", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10},
+	}
+	testServer.markClassesChanged()
+	list := func(query string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/classes"+query, nil)
+		w := httptest.NewRecorder()
+		testServer.getClasses(w, r)
+		return w
+	}
+
+	t.Run("list classes with rfc3339 dates by default", func(t *testing.T) {
+		w := list("")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"date":"2021-01-04T00:00:00Z"`)
+	})
+	t.Run("list classes with date only dates", func(t *testing.T) {
+		w := list("?date_format=date")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"date":"2021-01-04"`)
+		assert.Contains(t, w.Body.String(), `"id":"1"`)
+	})
+	t.Run("list a page of classes with date only dates", func(t *testing.T) {
+		w := list("?date_format=date&limit=1")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"date":"2021-01-04"`)
+		assert.Contains(t, w.Body.String(), `"total":1`)
+	})
+	t.Run("list classes grouped by date with date only dates", func(t *testing.T) {
+		w := list("?date_format=date&group_by=date")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"2021-01-04":[{`)
+		assert.Contains(t, w.Body.String(), `"date":"2021-01-04"`)
+	})
+	t.Run("try list classes with an unknown date format", func(t *testing.T) {
+		w := list("?date_format=unix")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), CodeInvalidDateFormat)
+	})
+}
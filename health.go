@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// HealthResponse is written by the liveness and readiness checks
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+// live is the handler function for GET requests to `/live`, it always succeeds while the process is up
+func live(w http.ResponseWriter, r *http.Request) {
+	err := json.NewEncoder(w).Encode(HealthResponse{Status: "ok"})
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// readiness is the handler function for GET requests to `/ready`, it fails with a 503 until startup has completed or
+// when persistence is enabled and the data file can't be written
+func (server *Server) readiness(w http.ResponseWriter, r *http.Request) {
+	if !server.ready.Load() {
+		err := errorResponse(w, CodeNotReady, NotReady, http.StatusServiceUnavailable)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if server.config.DataFile != "" {
+		if err := probeDataFile(server.config.DataFile); err != nil {
+			logger.Warn("data file isn't writable", "path", server.config.DataFile, "err", err)
+			err = errorResponse(w, CodeDataFileNotWritable, DataFileNotWritable, http.StatusServiceUnavailable)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+	}
+
+	err := json.NewEncoder(w).Encode(HealthResponse{Status: "ready"})
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_live(t *testing.T) {
+	t.Run("live is always ok", func(t *testing.T) {
+		defer testServer.ready.Store(false)
+
+		for _, isReady := range []bool{false, true} {
+			testServer.ready.Store(isReady)
+			r, _ := http.NewRequest("GET", "/live", nil)
+			w := httptest.NewRecorder()
+
+			live(w, r)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, `{"status":"ok"}`+"\n", w.Body.String())
+		}
+	})
+}
+
+func Test_readiness(t *testing.T) {
+	t.Run("ready flips from 503 to 200 once started", func(t *testing.T) {
+		defer testServer.ready.Store(false)
+		testServer.ready.Store(false)
+
+		r, _ := http.NewRequest("GET", "/ready", nil)
+		w := httptest.NewRecorder()
+		testServer.readiness(w, r)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+		testServer.ready.Store(true)
+		w = httptest.NewRecorder()
+		testServer.readiness(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `{"status":"ready"}`+"\n", w.Body.String())
+	})
+	t.Run("ready with a writable data file", func(t *testing.T) {
+		defer testServer.ready.Store(false)
+		testServer.ready.Store(true)
+		testServer.config.DataFile = filepath.Join(t.TempDir(), "classes.json")
+		defer func() { testServer.config.DataFile = "" }()
+
+		r, _ := http.NewRequest("GET", "/ready", nil)
+		w := httptest.NewRecorder()
+		testServer.readiness(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	t.Run("not ready when the data file can't be written", func(t *testing.T) {
+		defer testServer.ready.Store(false)
+		testServer.ready.Store(true)
+		// a data file inside a regular file can never be written, even by root
+		notADirectory := filepath.Join(t.TempDir(), "file")
+		os.WriteFile(notADirectory, nil, 0o444)
+		testServer.config.DataFile = filepath.Join(notADirectory, "classes.json")
+		defer func() { testServer.config.DataFile = "" }()
+
+		r, _ := http.NewRequest("GET", "/ready", nil)
+		w := httptest.NewRecorder()
+		testServer.readiness(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, DataFileNotWritable, errorResponse.Err)
+	})
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Hold sets a spot in a class aside for a member until it expires or they book it
+type Hold struct {
+	Id         string    `json:"id"`
+	MemberName string    `json:"member_name"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// HoldRequest is the member a spot should be held for
+type HoldRequest struct {
+	MemberName string `json:"member_name"`
+}
+
+// holdSweepInterval is how often expired holds are removed from classes
+var holdSweepInterval = 30 * time.Second
+
+// activeHolds counts the holds on the class that haven't expired by now
+func (class *Class) activeHolds(now time.Time) int {
+	count := 0
+	for _, hold := range class.Holds {
+		if hold.ExpiresAt.After(now) {
+			count++
+		}
+	}
+	return count
+}
+
+// isFullFor is isFull for the member, matched case-insensitively, their own holds are spots kept for them so don't
+// count against them
+func (class *Class) isFullFor(memberName string, now time.Time) bool {
+	held := 0
+	for _, hold := range class.Holds {
+		if hold.ExpiresAt.After(now) && !strings.EqualFold(hold.MemberName, memberName) {
+			held++
+		}
+	}
+	return class.countBookings(BookingConfirmed)+held >= class.Capacity
+}
+
+// releaseHold removes any holds the member, matched case-insensitively, has on the class
+func (class *Class) releaseHold(memberName string) {
+	kept := class.Holds[:0]
+	for _, hold := range class.Holds {
+		if !strings.EqualFold(hold.MemberName, memberName) {
+			kept = append(kept, hold)
+		}
+	}
+	class.Holds = kept
+}
+
+// sweepExpiredHolds removes expired holds from every class and confirms waitlisted bookings into the spots they free.
+// It returns how many holds were removed. Nothing is swept while the server is in read-only mode, holds that expire
+// meanwhile are removed once it's turned off.
+func (server *Server) sweepExpiredHolds() int {
+	if server.readOnly.Load() {
+		return 0
+	}
+	server.dbLock.Lock()
+	defer server.dbLock.Unlock()
+	now := server.now()
+	snapshot := server.rollbackPoint()
+	removed := 0
+	var changed []*Class
+	for index := range server.DBClasses {
+		class := &server.DBClasses[index]
+		kept := class.Holds[:0]
+		for _, hold := range class.Holds {
+			if hold.ExpiresAt.After(now) {
+				kept = append(kept, hold)
+			}
+		}
+		if len(kept) == len(class.Holds) {
+			continue
+		}
+		removed += len(class.Holds) - len(kept)
+		class.Holds = kept
+		changed = append(changed, class)
+		for !class.isFull(now) {
+			if !class.promoteWaitlisted(now) {
+				break
+			}
+		}
+	}
+	if removed > 0 && server.commitChanges(snapshot, changed...) == errNotSaved {
+		return 0
+	}
+	if removed > 0 {
+		logger.Debug("swept expired holds", "count", removed)
+	}
+	return removed
+}
+
+// sweepHolds removes expired holds every interval until ctx is done
+func (server *Server) sweepHolds(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			server.sweepExpiredHolds()
+		}
+	}
+}
+
+// createHold is the handler function for POST requests to `/classes/{id}/holds`, it sets a spot in the class aside for
+// the member for HOLD_DURATION. Held spots count against the capacity until they expire or the member books.
+func (server *Server) createHold(w http.ResponseWriter, r *http.Request) {
+	reqBody, _ := ioutil.ReadAll(r.Body)
+	var holdRequest HoldRequest
+	err := json.Unmarshal(reqBody, &holdRequest)
+	if err != nil {
+		err = errorResponse(w, CodeInvalidJSON, invalidJSON(err), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	defaultMemberName(r, &holdRequest.MemberName)
+	err = validateMemberName(holdRequest.MemberName)
+	if err != nil {
+		err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	server.dbLock.Lock()
+	defer server.dbLock.Unlock()
+	class, err := server.findClassByID(mux.Vars(r)["id"])
+	if err != nil {
+		err = errorResponse(w, CodeClassDoesNotExists, ClassDoesNotExists, http.StatusNotFound)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if class.Cancelled {
+		err = errorResponse(w, CodeClassCancelled, ClassCancelled, http.StatusConflict)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if class.hasActiveBooking(holdRequest.MemberName, "") {
+		err = errorResponse(w, CodeMemberAlreadyBooked, MemberAlreadyBooked, http.StatusConflict)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if class.isFullFor(holdRequest.MemberName, server.now()) {
+		err = errorResponse(w, CodeClassHasNoSpace, ClassHasNoSpace, http.StatusConflict)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	snapshot := server.rollbackPoint()
+	class.releaseHold(holdRequest.MemberName)
+
+	duration := server.config.HoldDuration
+	if duration == 0 {
+		duration = defaultHoldDuration
+	}
+	hold := Hold{Id: server.ids.NewID(), MemberName: holdRequest.MemberName, ExpiresAt: server.now().Add(duration)}
+	class.Holds = append(class.Holds, hold)
+	if !changesKept(w, server.commitChanges(snapshot, class)) {
+		return
+	}
+
+	logger.Debug("held spot", "id", hold.Id, "class", class.Id)
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(hold)
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
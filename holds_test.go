@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_holdsCountAgainstCapacity(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	now := time.Date(2020, 12, 1, 9, 0, 0, 0, time.UTC)
+	testServer.now = func() time.Time { return now }
+	defer func() { testServer.now = testClock }()
+	testServer.DBClasses = []Class{
+		{
+			Id:       "1",
+			Name:     "lifting",
+			Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+			Capacity: 3,
+			Bookings: []Booking{{MemberName: "David", Id: "a", Status: BookingConfirmed}},
+			Holds: []Hold{
+				{Id: "h1", MemberName: "Sarah", ExpiresAt: now.Add(time.Minute)},
+				{Id: "h2", MemberName: "Tom", ExpiresAt: now.Add(time.Hour)},
+			},
+		},
+	}
+	book := func(member string) *httptest.ResponseRecorder {
+		body := []byte(`{"member_name":"` + member + `","class_name":"lifting","date":"2020-12-12"}`)
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createBooking(w, r)
+		return w
+	}
+
+	t.Run("try book a class whose spots are booked or held", func(t *testing.T) {
+		w := book("Priya")
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, ClassIsFull, errorResponse.Err)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+	t.Run("book the spot freed by an expired hold", func(t *testing.T) {
+		now = now.Add(2 * time.Minute)
+
+		testServer.readOnly.Store(true)
+		assert.Equal(t, 0, testServer.sweepExpiredHolds())
+		testServer.readOnly.Store(false)
+		assert.Equal(t, 1, testServer.sweepExpiredHolds())
+		w := book("Priya")
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 2, testServer.DBClasses[0].countBookings(BookingConfirmed))
+		assert.Equal(t, []Hold{{Id: "h2", MemberName: "Tom", ExpiresAt: time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)}}, testServer.DBClasses[0].Holds)
+	})
+	t.Run("a member can book the spot they hold", func(t *testing.T) {
+		w := book("tom")
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 3, testServer.DBClasses[0].countBookings(BookingConfirmed))
+		assert.Equal(t, 0, len(testServer.DBClasses[0].Holds))
+	})
+}
+
+func Test_createHold(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	now := time.Date(2020, 12, 1, 9, 0, 0, 0, time.UTC)
+	testServer.now = func() time.Time { return now }
+	defer func() { testServer.now = testClock }()
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 1},
+	}
+	hold := func(member string) *httptest.ResponseRecorder {
+		body := []byte(`{"member_name":"` + member + `"}`)
+		r, _ := http.NewRequest("POST", "/classes/1/holds", bytes.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+		testServer.createHold(w, r)
+		return w
+	}
+
+	t.Run("hold a spot", func(t *testing.T) {
+		w := hold("David")
+
+		var response Hold
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, Hold{Id: "1", MemberName: "David", ExpiresAt: now.Add(defaultHoldDuration)}, response)
+	})
+	t.Run("try hold a spot when every spot is held", func(t *testing.T) {
+		w := hold("Sarah")
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, ClassHasNoSpace, errorResponse.Err)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+	t.Run("try renew a hold when the class has filled up keeps the hold", func(t *testing.T) {
+		testServer.DBClasses[0].Bookings = []Booking{{MemberName: "Sarah", Id: "a", Status: BookingConfirmed}}
+
+		w := hold("David")
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, []Hold{{Id: "1", MemberName: "David", ExpiresAt: now.Add(defaultHoldDuration)}}, testServer.DBClasses[0].Holds)
+	})
+}
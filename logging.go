@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// logger is used by the handlers, main replaces it with one built from LOG_LEVEL and LOG_FORMAT
+var logger = slog.Default()
+
+// newLogger builds a logger writing to w that drops records below level, format selects between json and text output
+func newLogger(level, format string, w io.Writer) (*slog.Logger, error) {
+	var slogLevel slog.Level
+	switch strings.ToLower(level) {
+	case "debug":
+		slogLevel = slog.LevelDebug
+	case "", "info":
+		slogLevel = slog.LevelInfo
+	case "warn":
+		slogLevel = slog.LevelWarn
+	case "error":
+		slogLevel = slog.LevelError
+	default:
+		return nil, fmt.Errorf("unknown log level %q, should be one of debug, info, warn or error", level)
+	}
+
+	options := &slog.HandlerOptions{Level: slogLevel}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q, should be one of json or text", format)
+	}
+}
+
+// spanTimer records how long the named steps of a handler take and logs them as a single debug line. When debug
+// logging is off it doesn't read the clock at all so it costs next to nothing. It reads the real clock rather than
+// the Server's clock as it measures how long the work actually took.
+type spanTimer struct {
+	handler string
+	enabled bool
+	start   time.Time
+	last    time.Time
+	spans   []any
+	// routed timers are started by timeHandlers, which logs them once the handler returns
+	routed bool
+}
+
+// spansContextKey is the request context key timeHandlers stores the request's spanTimer under
+type spansContextKey struct{}
+
+// newSpanTimer starts timing handler
+func newSpanTimer(ctx context.Context, handler string) *spanTimer {
+	spans := &spanTimer{handler: handler, enabled: logger.Enabled(ctx, slog.LevelDebug)}
+	if spans.enabled {
+		spans.start = time.Now()
+		spans.last = spans.start
+	}
+	return spans
+}
+
+// startSpans starts timing the steps of handler. A request routed through timeHandlers already has a timer, it's
+// renamed to handler and returned so the steps are logged with the request's total.
+func startSpans(ctx context.Context, handler string) *spanTimer {
+	if spans, ok := ctx.Value(spansContextKey{}).(*spanTimer); ok {
+		spans.handler = handler
+		return spans
+	}
+	return newSpanTimer(ctx, handler)
+}
+
+// timeHandlers is mux middleware timing every routed request, the handler's total time, along with any steps it
+// marked, is logged at debug level under its route, like `GET /classes/{id}`, unless the handler names itself
+func timeHandlers(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler := r.URL.Path
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				handler = template
+			}
+		}
+		spans := newSpanTimer(r.Context(), r.Method+" "+handler)
+		spans.routed = true
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), spansContextKey{}, spans)))
+		spans.routed = false
+		spans.log()
+	})
+}
+
+// mark records the time since the previous mark, or since the timer started, as the span called name
+func (spans *spanTimer) mark(name string) {
+	if !spans.enabled {
+		return
+	}
+	now := time.Now()
+	spans.spans = append(spans.spans, slog.Duration(name, now.Sub(spans.last)))
+	spans.last = now
+}
+
+// log writes the recorded spans and the total time, it's meant to be deferred so spans are logged however the handler
+// returns. Routed timers are left for timeHandlers to log.
+func (spans *spanTimer) log() {
+	if !spans.enabled || spans.routed {
+		return
+	}
+	attrs := append([]any{"handler", spans.handler}, spans.spans...)
+	attrs = append(attrs, slog.Duration("total", time.Since(spans.start)))
+	logger.Debug("handler timings", attrs...)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newLogger(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	t.Run("warn level suppresses debug lines", func(t *testing.T) {
+		var buf bytes.Buffer
+		testLogger, err := newLogger("warn", "text", &buf)
+		assert.Nil(t, err)
+
+		testLogger.Debug("debug line")
+		testLogger.Warn("warn line")
+
+		assert.NotContains(t, buf.String(), "debug line")
+		assert.Contains(t, buf.String(), "warn line")
+	})
+	t.Run("handlers log successful requests at debug level", func(t *testing.T) {
+		var buf bytes.Buffer
+		testLogger, err := newLogger("debug", "json", &buf)
+		assert.Nil(t, err)
+		defaultLogger := logger
+		logger = testLogger
+		defer func() { logger = defaultLogger }()
+
+		testServer.DBClasses = []Class{}
+		r, _ := http.NewRequest("GET", "/classes", nil)
+		w := httptest.NewRecorder()
+		testServer.getClasses(w, r)
+
+		assert.True(t, strings.HasPrefix(buf.String(), `{"time":`))
+		assert.Contains(t, buf.String(), `"level":"DEBUG","msg":"listed classes"`)
+	})
+	t.Run("handler spans are logged at debug level", func(t *testing.T) {
+		var buf bytes.Buffer
+		testLogger, err := newLogger("debug", "text", &buf)
+		assert.Nil(t, err)
+		defaultLogger := logger
+		logger = testLogger
+		defer func() { logger = defaultLogger }()
+
+		testServer.DBClasses = []Class{}
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-03", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		testServer.createClass(httptest.NewRecorder(), r)
+
+		assert.Contains(t, buf.String(), "msg=\"handler timings\" handler=createClass decode=")
+		for _, span := range []string{"decode", "validate", "generate", "store", "encode"} {
+			assert.Contains(t, buf.String(), " "+span+"=")
+		}
+	})
+	t.Run("every routed handler is timed", func(t *testing.T) {
+		var buf bytes.Buffer
+		testLogger, err := newLogger("debug", "text", &buf)
+		assert.Nil(t, err)
+		defaultLogger := logger
+		logger = testLogger
+		defer func() { logger = defaultLogger }()
+
+		testServer.DBClasses = []Class{}
+		router := testServer.newRouter()
+		r, _ := http.NewRequest("GET", "/v1/classes/1", nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-03", "capacity": 20}`)
+		r, _ = http.NewRequest("POST", "/v1/classes", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(httptest.NewRecorder(), r)
+
+		assert.Contains(t, buf.String(), "msg=\"handler timings\" handler=\"GET /classes/{id}\" total=")
+		assert.Equal(t, 1, strings.Count(buf.String(), "handler=createClass"))
+		assert.Contains(t, buf.String(), " encode=")
+	})
+	t.Run("handler spans are skipped when debug is off", func(t *testing.T) {
+		var buf bytes.Buffer
+		testLogger, err := newLogger("info", "text", &buf)
+		assert.Nil(t, err)
+		defaultLogger := logger
+		logger = testLogger
+		defer func() { logger = defaultLogger }()
+
+		spans := startSpans(context.Background(), "test")
+		spans.mark("step")
+		spans.log()
+
+		assert.False(t, spans.enabled)
+		assert.Nil(t, spans.spans)
+		assert.Equal(t, "", buf.String())
+	})
+	t.Run("unknown level is rejected", func(t *testing.T) {
+		_, err := newLogger("verbose", "text", &bytes.Buffer{})
+		assert.NotNil(t, err)
+	})
+}
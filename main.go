@@ -1,203 +1,3148 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
 const (
-	layoutISO          = "2006-01-02"
-	InvalidJSON        = "JSON parse error"
-	InternalError      = "Internal error please try again"
-	InvalidDate        = "Could not parse date, format should be YYYY-MM-DD"
-	ClassDoesNotExists = "Requested class does not exist"
+	layoutISO               = "2006-01-02"
+	InvalidJSON             = "JSON parse error"
+	InternalError           = "Internal error please try again"
+	InvalidDate             = "Could not parse date, format should be YYYY-MM-DD"
+	ClassDoesNotExists      = "Requested class does not exist"
+	ClassIsFull             = "Requested class is full"
+	BookingDoesNotExist     = "Requested booking does not exist"
+	BookingAlreadyCancelled = "Requested booking has already been cancelled"
+	InvalidStatus           = "Status should be one of confirmed, waitlisted or cancelled"
+	MissingIfMatch          = "An If-Match header with the class's ETag is required to update it"
+	VersionMismatch         = "Class has been modified since it was fetched, please fetch it again"
+	InvalidCSV              = "CSV parse error"
+	InvalidCSVRow           = "Row should have the columns name,date,capacity"
+	InvalidCapacity         = "Could not parse capacity, should be a whole number of 0 or more"
+	UnsupportedContentType  = "Unsupported Content-Type, this endpoint accepts "
+	MissingClassName        = "Class name must not be empty"
+	UnknownClassName        = "Class name is not in the class catalog"
+	CancellationTooLate     = "Bookings can no longer be cancelled this close to the class"
+	InvalidDayOfWeek        = "Could not parse day_of_week, should be a day such as Mon or Monday"
+	InvalidPagination       = "Could not parse limit or offset, limit should be a whole number of 1 or more and offset of 0 or more"
+	WaitlistFull            = "Requested class and its waitlist are full"
+	InvalidMaxWaitlist      = "max_waitlist should be a whole number of 0 or more"
+	InvalidLocation         = "Location must not be empty and at most 100 characters"
+	ClassAlreadyExists      = "A class with this name already exists on one of the requested dates"
+	InvalidOnConflict       = "on_conflict should be one of skip or reject"
+	RequestCancelled        = "Request was cancelled before it completed"
+	NotReady                = "Server is still starting up"
+	InvalidBoolean          = "Query parameter should be true or false: "
+	InvalidWait             = "Could not parse wait, should be a duration such as 2s"
+	InvalidClassID          = "Class ids should be valid ids for the server's id strategy"
+	CapacityBelowBookings   = "Capacity can't go below the confirmed bookings as the waitlist has no room for the excess"
+	InvalidGroupBy          = "group_by should be name"
+	InvalidDateRange        = "from should not be after to"
+	InvalidNaming           = "naming should be one of snake or camel"
+	InvalidDateFormat       = "date_format should be one of rfc3339 or date"
+	ClassCancelled          = "Requested class has been cancelled"
+	InvalidRRule            = "Could not parse rrule, should be an RFC 5545 rule with FREQ of DAILY, WEEKLY or MONTHLY"
+	TooManyClasses          = "Request would create too many classes, use a shorter date range or a COUNT"
+	DataFileNotWritable     = "Data file can't be written, changes wouldn't be saved"
+	InvalidAPIKey           = "A valid X-API-Key header is required"
+	BookingNotYetOpen       = "Bookings for this class haven't opened yet"
+	ClassHasNoSpace         = "Requested class has no spots left to hold"
+	InvalidMinCapacity      = "Could not parse min_capacity, should be a whole number of 0 or more"
+	TooManySessions         = "There are already as many classes with this name as allowed on one of the requested dates"
+	InvalidResponseMode     = "response should be one of full or ids"
+	InvalidBookingID        = "Booking ids should be valid ids for the server's id strategy"
+	ClassInPast             = "the class would be in the past, date should be today or later"
+	OriginNotAllowed        = "WebSocket connections aren't allowed from this Origin"
+	UnsupportedRRule        = "rrule uses a part that is valid RFC 5545 but not supported, only FREQ of DAILY, WEEKLY or MONTHLY with INTERVAL, BYDAY for WEEKLY, COUNT and UNTIL are: "
+	InvalidSince            = "since should be a change sequence number of 0 or more"
+	ClassNotBookable        = "Requested class has no capacity so can't be booked"
+	InvalidShiftDays        = "shift_days should be a whole number of days other than 0"
+	BookingTooLate          = "It is too close to the start of this class to book it"
+	WebSocketRequired       = "This endpoint needs a WebSocket upgrade request"
+	InvalidBearerToken      = "A valid Authorization: Bearer token is required"
+	RangeInPast             = "the classes would all be in the past, end_date should be today or later"
+	InvalidCancelReason     = "reason should be printable and at most 200 characters"
+	InvalidThreshold        = "threshold should be a number between 0 and 1"
+	MemberTimeConflict      = "Member is already booked into a class at the same time"
+	InvalidSessionTime      = "start_time should be a time of day as HH:MM and duration_minutes can't be negative"
+	RoomDoubleBooked        = "Another class is already in this location at that time"
+	CooldownViolation       = "Classes in the same location need at least COOLDOWN_MINUTES between them"
+	NotSaved                = "Change couldn't be saved so it hasn't been made, please try again"
+	InvalidReportRange      = "from and to are both required and can be at most 366 days apart"
+	ClassNotCancelled       = "Requested class isn't cancelled"
+	MissingClassIDs         = "class_ids must list at least one class"
+	ReadOnlyMode            = "Server is in read-only mode for maintenance, changes can't be made right now"
+	InvalidCredits          = "credits should be a whole number of 0 or more"
+	NoUpcomingClass         = "No upcoming class with this name has space"
+	ServerBusy              = "Too many requests in progress, try again shortly"
+	ClassDeleted            = "Requested class has been deleted"
+	InvalidClassGroupBy     = "group_by should be date and can't be combined with limit or offset"
+	BatchTooLarge           = "Too many items in one request, split them across several requests"
+	CapacitiesMismatch      = "capacities should have one capacity for each class being created"
+	InvalidEmail            = "member_email should be an email address such as david@example.com"
+	InvalidCharacters       = "Names must not contain control characters such as newlines"
+	MemberAlreadyBooked     = "Member already has a booking for this class"
+	MissingMemberName       = "Member name must not be empty"
 )
 
-// instead of reading and writing to a database im just going to keep track of classes in this global slice
-var DBClasses = make([]Class, 0)
+// machine readable codes sent alongside each error message above, clients can branch on these
+const (
+	CodeInvalidJSON             = "invalid_json"
+	CodeInternalError           = "internal_error"
+	CodeInvalidDate             = "invalid_date"
+	CodeClassDoesNotExists      = "class_not_found"
+	CodeClassIsFull             = "class_full"
+	CodeBookingDoesNotExist     = "booking_not_found"
+	CodeBookingAlreadyCancelled = "booking_already_cancelled"
+	CodeInvalidStatus           = "invalid_status"
+	CodeMissingIfMatch          = "missing_if_match"
+	CodeVersionMismatch         = "version_mismatch"
+	CodeInvalidCSV              = "invalid_csv"
+	CodeInvalidCSVRow           = "invalid_csv_row"
+	CodeInvalidCapacity         = "invalid_capacity"
+	CodeUnsupportedContentType  = "unsupported_content_type"
+	CodeMissingClassName        = "missing_class_name"
+	CodeUnknownClassName        = "unknown_class_name"
+	CodeCancellationTooLate     = "cancellation_too_late"
+	CodeInvalidDayOfWeek        = "invalid_day_of_week"
+	CodeInvalidPagination       = "invalid_pagination"
+	CodeWaitlistFull            = "waitlist_full"
+	CodeInvalidMaxWaitlist      = "invalid_max_waitlist"
+	CodeInvalidLocation         = "invalid_location"
+	CodeClassAlreadyExists      = "class_already_exists"
+	CodeInvalidOnConflict       = "invalid_on_conflict"
+	CodeRequestCancelled        = "request_cancelled"
+	CodeNotReady                = "not_ready"
+	CodeInvalidBoolean          = "invalid_boolean"
+	CodeInvalidWait             = "invalid_wait"
+	CodeInvalidClassID          = "invalid_class_id"
+	CodeCapacityBelowBookings   = "capacity_below_bookings"
+	CodeInvalidGroupBy          = "invalid_group_by"
+	CodeInvalidDateRange        = "invalid_date_range"
+	CodeInvalidNaming           = "invalid_naming"
+	CodeInvalidDateFormat       = "invalid_date_format"
+	CodeClassCancelled          = "class_cancelled"
+	CodeInvalidRRule            = "invalid_rrule"
+	CodeTooManyClasses          = "too_many_classes"
+	CodeDataFileNotWritable     = "data_file_not_writable"
+	CodeInvalidAPIKey           = "invalid_api_key"
+	CodeBookingNotYetOpen       = "booking_not_yet_open"
+	CodeClassHasNoSpace         = "class_has_no_space"
+	CodeInvalidMinCapacity      = "invalid_min_capacity"
+	CodeInvalidBookingID        = "invalid_booking_id"
+	CodeClassInPast             = "class_in_past"
+	CodeOriginNotAllowed        = "websocket_origin_not_allowed"
+	CodeUnsupportedRRule        = "unsupported_rrule"
+	CodeInvalidSince            = "invalid_since"
+	CodeClassNotBookable        = "class_not_bookable"
+	CodeInvalidShiftDays        = "invalid_shift_days"
+	CodeBookingTooLate          = "booking_too_late"
+	CodeWebSocketRequired       = "websocket_upgrade_required"
+	CodeInvalidBearerToken      = "invalid_bearer_token"
+	CodeRangeInPast             = "range_in_past"
+	CodeInvalidCancelReason     = "invalid_cancel_reason"
+	CodeInvalidThreshold        = "invalid_threshold"
+	CodeTooManySessions         = "too_many_sessions"
+	CodeInvalidResponseMode     = "invalid_response_mode"
+	CodeMemberTimeConflict      = "member_time_conflict"
+	CodeInvalidSessionTime      = "invalid_session_time"
+	CodeRoomDoubleBooked        = "room_double_booked"
+	CodeCooldownViolation       = "cooldown_violation"
+	CodeNotSaved                = "not_saved"
+	CodeInvalidReportRange      = "invalid_report_range"
+	CodeClassNotCancelled       = "class_not_cancelled"
+	CodeMissingClassIDs         = "missing_class_ids"
+	CodeReadOnlyMode            = "read_only_mode"
+	CodeInvalidCredits          = "invalid_credits"
+	CodeNoUpcomingClass         = "no_upcoming_class"
+	CodeServerBusy              = "server_busy"
+	CodeClassDeleted            = "class_deleted"
+	CodeInvalidClassGroupBy     = "invalid_group_by"
+	CodeBatchTooLarge           = "batch_too_large"
+	CodeCapacitiesMismatch      = "capacities_mismatch"
+	CodeInvalidEmail            = "invalid_email"
+	CodeInvalidCharacters       = "invalid_characters"
+	CodeMemberAlreadyBooked     = "member_already_booked"
+	CodeMissingMemberName       = "missing_member_name"
+)
+
+// the lifecycle states a Booking can be in, bookings are never removed from a class so their history is kept
+const (
+	BookingConfirmed  = "confirmed"
+	BookingWaitlisted = "waitlisted"
+	BookingCancelled  = "cancelled"
+)
+
+// the actions recorded in a class's audit log
+const (
+	AuditBooked      = "booked"
+	AuditCancelled   = "cancelled"
+	AuditTransferred = "transferred"
+	AuditPromoted    = "promoted"
+	AuditDemoted     = "demoted"
+	AuditRenamed     = "renamed"
+)
+
+// classList is a serialized list of classes along with the totals getClasses reports in its headers. The classes are
+// encoded up front so an encoding failure can still be reported as a clean 500 rather than a truncated 200.
+type classList struct {
+	body          []byte
+	totalCapacity int
+	totalBooked   int
+	// classes is the DBClasses the list was built from, a list built from a slice DBClasses has since been replaced
+	// with is out of date even if markClassesChanged wasn't called
+	classes []Class
+}
+
+// builtFrom reports whether the list was built from classes, the same slice rather than an equal one
+func (list *classList) builtFrom(classes []Class) bool {
+	if len(list.classes) != len(classes) || cap(list.classes) != cap(classes) {
+		return false
+	}
+	return len(classes) == 0 || &list.classes[0] == &classes[0]
+}
+
+// PageResponse is the envelope a page of classes is written in, Total is the number of classes before paging
+type PageResponse struct {
+	Data   []Class `json:"data"`
+	Total  int     `json:"total"`
+	Limit  int     `json:"limit"`
+	Offset int     `json:"offset"`
+}
+
+// newClassList serializes classes and totals their capacity and confirmed bookings. If page isn't nil only that page
+// of the classes is included, wrapped in a PageResponse. naming and dateOnly pick how the classes are written, see
+// formatClasses.
+func newClassList(classes []Class, page *pagination, naming string, dateOnly bool) (*classList, error) {
+	body := formatClasses(classes, naming, dateOnly)
+	if page != nil {
+		total := len(classes)
+		classes = page.slice(classes)
+		pageResponse := PageResponse{Data: classes, Total: total, Limit: page.limit, Offset: page.offset}
+		body = formattedPageResponse{PageResponse: pageResponse, Data: formatClasses(classes, naming, dateOnly)}
+	}
+
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(body)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &classList{body: buf.Bytes()}
+	for index := range classes {
+		list.totalCapacity += classes[index].Capacity
+		list.totalBooked += classes[index].countBookings(BookingConfirmed)
+	}
+	return list, nil
+}
+
+// newClassListByDate is newClassList with the classes grouped into an object keyed by their YYYY-MM-DD date, classes
+// within a day are in the order they start
+func (server *Server) newClassListByDate(classes []Class, naming string, dateOnly bool) (*classList, error) {
+	server.sortClassesByStart(classes)
+	days := make(map[string][]Class)
+	list := &classList{}
+	for _, class := range classes {
+		day := class.Date.Format(layoutISO)
+		days[day] = append(days[day], class)
+		list.totalCapacity += class.Capacity
+		list.totalBooked += class.countBookings(BookingConfirmed)
+	}
+	body := make(map[string]interface{}, len(days))
+	for day, dayClasses := range days {
+		body[day] = formatClasses(dayClasses, naming, dateOnly)
+	}
+
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(body)
+	if err != nil {
+		return nil, err
+	}
+	list.body = buf.Bytes()
+	return list, nil
+}
+
+// markClassesChanged must be called, with dbLock held for writing, after any change to a class or its bookings. The
+// changed classes are stamped with the next change sequence. It saves the classes to the data file when persistence
+// is enabled, returning the error if they couldn't be saved, lets the classes websockets know there is a new list to
+// send and sends each changed class's subscribers its occupancy.
+func (server *Server) markClassesChanged(changed ...*Class) error {
+	if len(changed) > 0 {
+		server.changeSeq++
+		for _, class := range changed {
+			class.ChangeSeq = server.changeSeq
+		}
+	}
+	server.classesCache = nil
+	server.classListChanges.notify()
+	var err error
+	if server.config.DataFile != "" {
+		err = saveClasses(server.config.DataFile, server.DBClasses)
+		if err != nil {
+			logger.Error("failed to save classes", "path", server.config.DataFile, "err", err)
+		}
+	}
+	// a change commitChanges is about to roll back never happened as far as subscribers are concerned
+	if err == nil || server.config.PersistFailurePolicy != persistRollback {
+		for _, class := range changed {
+			server.occupancyChanged(class)
+		}
+	}
+	return err
+}
+
+// lastClasses returns pointers to the last count classes of DBClasses, the ones most recently appended
+func (server *Server) lastClasses(count int) []*Class {
+	classes := make([]*Class, 0, count)
+	for index := len(server.DBClasses) - count; index < len(server.DBClasses); index++ {
+		classes = append(classes, &server.DBClasses[index])
+	}
+	return classes
+}
+
+// snapshotClass copies the class, along with its bookings, audit log and holds, so it can be put back if a change to
+// it can't be saved
+func snapshotClass(class *Class) Class {
+	snapshot := *class
+	snapshot.Bookings = append([]Booking(nil), class.Bookings...)
+	snapshot.Audit = append([]AuditEntry(nil), class.Audit...)
+	snapshot.Holds = append([]Hold(nil), class.Holds...)
+	return snapshot
+}
+
+// cachedClassList returns the serialized list of DBClasses, building and caching it if it isn't already cached
+func (server *Server) cachedClassList() (*classList, error) {
+	server.dbLock.RLock()
+	cached := server.classesCache
+	if cached != nil && !cached.builtFrom(server.DBClasses) {
+		cached = nil
+	}
+	server.dbLock.RUnlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	server.dbLock.Lock()
+	defer server.dbLock.Unlock()
+	if server.classesCache == nil || !server.classesCache.builtFrom(server.DBClasses) {
+		list, err := newClassList(applyClassFilters(server.DBClasses, nil), nil, namingSnake, false)
+		if err != nil {
+			return nil, err
+		}
+		list.classes = server.DBClasses
+		server.classesCache = list
+	}
+	return server.classesCache, nil
+}
+
+// findClassReference will return a pointer to the first class with a matching name and date to given input
+// in a real real world scenario we'd use its Id to guarantee it was unique
+func (server *Server) findClassReference(className string, date time.Time) (*Class, error) {
+	for index, class := range server.DBClasses {
+		if class.Name == className && class.Date == date && !class.Deleted {
+			return &server.DBClasses[index], nil
+		}
+	}
+	return nil, fmt.Errorf("that class does not exsist")
+}
+
+// classExists reports whether there is already a class with the name on the date
+func (server *Server) classExists(className string, date time.Time) bool {
+	_, err := server.findClassReference(className, date)
+	return err == nil
+}
+
+// sessionsFull reports whether the date already has as many classes with the name as MAX_SESSIONS_PER_DAY allows
+func (server *Server) sessionsFull(className string, date time.Time) bool {
+	if server.config.MaxSessionsPerDay == 0 {
+		return false
+	}
+	sessions := 0
+	for _, class := range server.DBClasses {
+		if class.Name == className && class.Date == date && !class.Deleted {
+			sessions++
+		}
+	}
+	return sessions >= server.config.MaxSessionsPerDay
+}
+
+// layoutTime is the format of a class's StartTime
+const layoutTime = "15:04"
+
+// validateSessionTime checks the start time parses and the duration isn't negative, an empty start time is allowed
+func validateSessionTime(startTime string, durationMinutes int) error {
+	if durationMinutes < 0 {
+		return newValidationError(CodeInvalidSessionTime, InvalidSessionTime)
+	}
+	if startTime == "" {
+		return nil
+	}
+	if _, err := time.Parse(layoutTime, startTime); err != nil {
+		return newValidationError(CodeInvalidSessionTime, InvalidSessionTime)
+	}
+	return nil
+}
+
+// session returns when the class starts and ends, ok is false for a class without a StartTime
+func (class *Class) session() (start, end time.Time, ok bool) {
+	startTime, err := time.Parse(layoutTime, class.StartTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	start = class.Date.Add(time.Duration(startTime.Hour())*time.Hour + time.Duration(startTime.Minute())*time.Minute)
+	return start, start.Add(time.Duration(class.DurationMinutes) * time.Minute), true
+}
+
+// overlaps reports whether the two classes run at the same time, classes that finish as the other starts don't
+// overlap and neither do classes without a start time
+func (class *Class) overlaps(other *Class) bool {
+	start, end, ok := class.session()
+	otherStart, otherEnd, otherOk := other.session()
+	return ok && otherOk && start.Before(otherEnd) && otherStart.Before(end)
+}
+
+var (
+	// errRoomDoubleBooked is returned by roomConflict when another class in the location overlaps the class
+	errRoomDoubleBooked = errors.New(RoomDoubleBooked)
+	// errCooldownViolation is returned by roomConflict when another class in the location is less than
+	// COOLDOWN_MINUTES before or after the class
+	errCooldownViolation = errors.New(CooldownViolation)
+)
+
+// roomConflict checks the class against the other active classes in the same location, they can't overlap and must
+// be at least COOLDOWN_MINUTES apart so the room can be cleaned. Classes without a location or a start time are never
+// in conflict.
+func (server *Server) roomConflict(class Class, others []Class) error {
+	start, end, ok := class.session()
+	if class.Location == "" || !ok {
+		return nil
+	}
+	cooldown := time.Duration(server.config.CooldownMinutes) * time.Minute
+	for _, other := range others {
+		if other.Id == class.Id || other.Deleted || other.Cancelled || !strings.EqualFold(other.Location, class.Location) {
+			continue
+		}
+		otherStart, otherEnd, ok := other.session()
+		if !ok {
+			continue
+		}
+		if start.Before(otherEnd) && otherStart.Before(end) {
+			return errRoomDoubleBooked
+		}
+		if start.Before(otherEnd.Add(cooldown)) && otherStart.Before(end.Add(cooldown)) {
+			return errCooldownViolation
+		}
+	}
+	return nil
+}
+
+// memberTimeConflict reports whether the member has an active booking in another class that overlaps the class,
+// classes that finish as the other starts don't overlap. Classes without a start time are never in conflict.
+func (server *Server) memberTimeConflict(class *Class, memberName, memberEmail string) bool {
+	for index := range server.DBClasses {
+		other := &server.DBClasses[index]
+		if other.Id == class.Id || other.Deleted || other.Cancelled {
+			continue
+		}
+		if class.overlaps(other) && other.hasActiveBooking(memberName, memberEmail) {
+			return true
+		}
+	}
+	return false
+}
+
+// roomConflictResponse writes the 409 for an error from roomConflict
+func roomConflictResponse(w http.ResponseWriter, err error) {
+	code, reason := CodeRoomDoubleBooked, RoomDoubleBooked
+	if err == errCooldownViolation {
+		code, reason = CodeCooldownViolation, CooldownViolation
+	}
+	err = errorResponse(w, code, reason, http.StatusConflict)
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// errClassDeleted is returned by findClassByID for a soft deleted class
+var errClassDeleted = errors.New(ClassDeleted)
+
+// findClassByID will return a pointer to the class with the given id, or errClassDeleted if it has been deleted
+func (server *Server) findClassByID(id string) (*Class, error) {
+	for index, class := range server.DBClasses {
+		if class.Id == id && class.Deleted {
+			return nil, errClassDeleted
+		}
+		if class.Id == id {
+			return &server.DBClasses[index], nil
+		}
+	}
+	return nil, fmt.Errorf("that class does not exsist")
+}
+
+// findBookingReference will return pointers to the booking with the given id and the class it belongs to
+func (server *Server) findBookingReference(id string) (*Class, *Booking, error) {
+	for classIndex := range server.DBClasses {
+		class := &server.DBClasses[classIndex]
+		if class.Deleted {
+			continue
+		}
+		for bookingIndex := range class.Bookings {
+			if class.Bookings[bookingIndex].Id == id {
+				return class, &class.Bookings[bookingIndex], nil
+			}
+		}
+	}
+	return nil, nil, fmt.Errorf("that booking does not exsist")
+}
+
+// Booking is a member's place in a class. MemberEmail is optional, when given it identifies the member so members
+// sharing a name can be told apart.
+type Booking struct {
+	MemberName  string    `json:"member_name"`
+	MemberEmail string    `json:"member_email,omitempty"`
+	Id          string    `json:"id"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// AuditEntry records something that happened to one of a class's bookings, for resolving disputes
+type AuditEntry struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Action     string    `json:"action"`
+	MemberName string    `json:"member_name"`
+	BookingId  string    `json:"booking_id"`
+	// Reason is why a booking was cancelled, when the member gave one
+	Reason string `json:"reason,omitempty"`
+}
+
+type BookingRequest struct {
+	Id          string `json:"id"`
+	MemberName  string `json:"member_name"`
+	MemberEmail string `json:"member_email,omitempty"`
+	ClassName   string `json:"class_name"`
+	Date        string `json:"date"`
+	// Waitlist asks for the member to be put on the waitlist if the class is already full
+	Waitlist bool   `json:"waitlist,omitempty"`
+	Status   string `json:"status"`
+}
+
+// BookingReceipt is what createBooking writes back once a member is booked. Position is the member's spot number in
+// the class, or their place on the waitlist when waitlisted, and SpotsRemaining is how many spots are left after the
+// booking.
+type BookingReceipt struct {
+	Id             string `json:"id"`
+	MemberName     string `json:"member_name"`
+	MemberEmail    string `json:"member_email,omitempty"`
+	ClassId        string `json:"class_id"`
+	ClassName      string `json:"class_name"`
+	Date           string `json:"date"`
+	Status         string `json:"status"`
+	Position       int    `json:"position"`
+	SpotsRemaining int    `json:"spots_remaining"`
+}
+
+// newBookingReceipt describes the booking just added to the class at now
+func newBookingReceipt(class *Class, booking Booking, now time.Time) BookingReceipt {
+	return BookingReceipt{
+		Id:             booking.Id,
+		MemberName:     booking.MemberName,
+		MemberEmail:    booking.MemberEmail,
+		ClassId:        class.Id,
+		ClassName:      class.Name,
+		Date:           class.Date.Format(layoutISO),
+		Status:         booking.Status,
+		Position:       class.countBookings(booking.Status),
+		SpotsRemaining: class.spotsAvailable(now),
+	}
+}
+
+type Class struct {
+	Id       string    `json:"id"`
+	Name     string    `json:"name"`
+	Date     time.Time `json:"date"`
+	Capacity int       `json:"capacity"`
+	Bookings []Booking `json:"-"`
+	// Version is bumped on every update and exposed as the class's ETag for optimistic concurrency
+	Version int `json:"-"`
+	// MaxWaitlist caps how many bookings can wait for a spot, nil is unlimited and 0 means the class has no waitlist
+	MaxWaitlist *int `json:"max_waitlist,omitempty"`
+	// Location is the studio or room the class runs in
+	Location string `json:"location,omitempty"`
+	// Audit is the append only history of the class's bookings
+	Audit []AuditEntry `json:"-"`
+	// Cancelled classes keep their bookings for history but can't be booked
+	Cancelled bool `json:"cancelled,omitempty"`
+	// Credits is what booking the class costs a member, it is separate from the capacity
+	Credits int `json:"credits,omitempty"`
+	// Holds are spots set aside for members for a short time, they count against the capacity until they expire
+	Holds []Hold `json:"-"`
+	// StartTime is when the class starts on its date as HH:MM. Classes without one are taken to start at the beginning
+	// of their day but have no set time, so they never conflict with another class, see overlaps and roomConflict.
+	StartTime string `json:"start_time,omitempty"`
+	// DurationMinutes is how long the class runs from its StartTime
+	DurationMinutes int `json:"duration_minutes,omitempty"`
+	// Deleted classes are soft deleted, they are kept but left out of everything except getClass which reports them
+	// as gone
+	Deleted bool `json:"-"`
+	// ChangeSeq is the Server's change sequence when the class or its bookings last changed, see getClassChanges
+	ChangeSeq uint64 `json:"-"`
+	// CreationKey is the natural key of the createClass request that made the class, see classCreationKey
+	CreationKey string `json:"-"`
+}
+
+// etag returns the quoted entity tag for the current version of the class
+func (class *Class) etag() string {
+	return fmt.Sprintf(`"%d"`, class.Version)
+}
+
+// addBooking adds the booking to the class, it is audited as happening when the booking was created
+func (class *Class) addBooking(booking Booking) {
+	class.Bookings = append(class.Bookings, booking)
+	class.audit(AuditBooked, booking, booking.CreatedAt)
+}
+
+// audit appends an entry for the booking to the class's audit log, now is when it happened
+func (class *Class) audit(action string, booking Booking, now time.Time) {
+	class.auditReason(action, booking, "", now)
+}
+
+// auditReason is audit recording why it happened
+func (class *Class) auditReason(action string, booking Booking, reason string, now time.Time) {
+	class.Audit = append(class.Audit, AuditEntry{
+		Timestamp:  now,
+		Action:     action,
+		MemberName: booking.MemberName,
+		BookingId:  booking.Id,
+		Reason:     reason,
+	})
+}
+
+// countBookings returns how many of the class's bookings have the given status
+func (class *Class) countBookings(status string) int {
+	count := 0
+	for _, booking := range class.Bookings {
+		if booking.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// isMember reports whether the booking belongs to the member. Emails identify the member when both the booking and
+// the member have one, otherwise names are compared, both case-insensitively.
+func (booking Booking) isMember(memberName, memberEmail string) bool {
+	if memberEmail != "" && booking.MemberEmail != "" {
+		return strings.EqualFold(booking.MemberEmail, memberEmail)
+	}
+	return strings.EqualFold(booking.MemberName, memberName)
+}
+
+// spotsAvailable is how many more members can be confirmed at now, spots taken by holds aren't available
+func (class *Class) spotsAvailable(now time.Time) int {
+	taken := class.countBookings(BookingConfirmed) + class.activeHolds(now)
+	if taken >= class.Capacity {
+		return 0
+	}
+	return class.Capacity - taken
+}
+
+// hasActiveBooking reports whether the member, see isMember, has a confirmed or waitlisted booking
+func (class *Class) hasActiveBooking(memberName, memberEmail string) bool {
+	return class.hasOtherActiveBooking(memberName, memberEmail, "")
+}
+
+// hasOtherActiveBooking is hasActiveBooking ignoring the booking with the given id
+func (class *Class) hasOtherActiveBooking(memberName, memberEmail, bookingID string) bool {
+	for _, booking := range class.Bookings {
+		if booking.Id != bookingID && booking.Status != BookingCancelled && booking.isMember(memberName, memberEmail) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitlistIsFull reports whether the class can't take any more waitlisted bookings
+func (class *Class) waitlistIsFull() bool {
+	return class.MaxWaitlist != nil && class.countBookings(BookingWaitlisted) >= *class.MaxWaitlist
+}
+
+// isFull reports whether every spot in the class has a confirmed booking or is held at now
+func (class *Class) isFull(now time.Time) bool {
+	return class.countBookings(BookingConfirmed)+class.activeHolds(now) >= class.Capacity
+}
+
+// promoteWaitlisted confirms the longest waiting booking, if there is one, to fill a freed spot. It reports whether a
+// booking was promoted.
+func (class *Class) promoteWaitlisted(now time.Time) bool {
+	for index := range class.Bookings {
+		if class.Bookings[index].Status == BookingWaitlisted {
+			class.Bookings[index].Status = BookingConfirmed
+			class.audit(AuditPromoted, class.Bookings[index], now)
+			return true
+		}
+	}
+	return false
+}
+
+// waitlistHasRoom reports whether count more bookings can be put on the class's waitlist
+func (class *Class) waitlistHasRoom(count int) bool {
+	return class.MaxWaitlist == nil || class.countBookings(BookingWaitlisted)+count <= *class.MaxWaitlist
+}
+
+// fitCapacity brings the confirmed bookings in line with the class's capacity after it changes. When it shrinks the
+// most recent confirmed bookings are moved to the waitlist, callers should check waitlistHasRoom first, and when it
+// grows waitlisted bookings are promoted into the new spots.
+func (class *Class) fitCapacity(now time.Time) {
+	excess := class.countBookings(BookingConfirmed) - class.Capacity
+	for index := len(class.Bookings) - 1; index >= 0 && excess > 0; index-- {
+		if class.Bookings[index].Status == BookingConfirmed {
+			class.Bookings[index].Status = BookingWaitlisted
+			class.audit(AuditDemoted, class.Bookings[index], now)
+			excess--
+		}
+	}
+	for !class.isFull(now) {
+		if !class.promoteWaitlisted(now) {
+			return
+		}
+	}
+}
+
+type ClassRequest struct {
+	Name      string       `json:"name"`
+	StartDate string       `json:"start_date"`
+	EndDate   string       `json:"end_date"`
+	Capacity  jsonCapacity `json:"capacity"`
+	// Capacities gives each generated class its own capacity in date order instead of Capacity, there must be one
+	// per class
+	Capacities []int `json:"capacities,omitempty"`
+	// MaxWaitlist overrides the MAX_WAITLIST default for the classes
+	MaxWaitlist *int    `json:"max_waitlist"`
+	Location    *string `json:"location"`
+	Credits     int     `json:"credits,omitempty"`
+	// StartTime and DurationMinutes set when the classes run on their dates, see Class
+	StartTime       string `json:"start_time,omitempty"`
+	DurationMinutes int    `json:"duration_minutes,omitempty"`
+	// RRule is an RFC 5545 recurrence rule, when given classes are only created on the days it falls on between
+	// start_date and end_date, see parseRRule for the parts supported
+	RRule string `json:"rrule,omitempty"`
+}
+
+// jsonCapacity is a capacity in a request body. As well as a JSON integer it can be a float with no fractional part,
+// like 20.0, or a numeric string, like "20", since not every client sends whole numbers as integers. Anything else,
+// fractions and negatives included, fails decoding with a validationError.
+type jsonCapacity int
+
+// maxJSONCapacity is the largest capacity decoded, floats can't hold every integer beyond it exactly
+const maxJSONCapacity = 1 << 53
+
+func (capacity *jsonCapacity) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = strings.TrimSpace(unquoted)
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil || value != math.Trunc(value) || value < 0 || value > maxJSONCapacity {
+		return newValidationError(CodeInvalidCapacity, InvalidCapacity)
+	}
+	*capacity = jsonCapacity(value)
+	return nil
+}
+
+// maxLocationLength is the longest location a class can have
+const maxLocationLength = 100
+
+// ClassUpdateRequest holds the fields of a class that can be updated, fields left out of the request are unchanged
+type ClassUpdateRequest struct {
+	Name     *string       `json:"name"`
+	Date     *string       `json:"date"`
+	Capacity *jsonCapacity `json:"capacity"`
+}
+
+// validID reports whether id could have been created by the configured id strategy. UUIDs must be in the canonical
+// 36 character form the server creates, uuid.Parse also accepts braced and urn:uuid forms which no class has.
+func (server *Server) validID(id string) bool {
+	if server.config.IDStrategy == "sequential" {
+		number, err := strconv.ParseUint(id, 10, 64)
+		return err == nil && number > 0
+	}
+	_, err := uuid.Parse(id)
+	return err == nil && len(id) == 36
+}
+
+type ErrorResponse struct {
+	Err  string `json:"error"`
+	Code string `json:"code"`
+}
+
+// invalidJSON describes where a request body's JSON is broken, or which field has the wrong type, when the decoder
+// says. Otherwise it is just InvalidJSON.
+func invalidJSON(err error) string {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return fmt.Sprintf("%s: invalid JSON at offset %d", InvalidJSON, syntaxErr.Offset)
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return fmt.Sprintf("%s: field %s: expected %s got %s", InvalidJSON, typeErr.Field, typeErr.Type, typeErr.Value)
+	}
+	return InvalidJSON
+}
+
+// validationError is an error from validating a request that knows the code to report it with
+type validationError struct {
+	code   string
+	reason string
+}
+
+func (err *validationError) Error() string {
+	return err.reason
+}
+
+// newValidationError returns an error with the reason as its message, to be reported to the client with the code
+func newValidationError(code, reason string) error {
+	return &validationError{code: code, reason: reason}
+}
+
+// errorCode returns the code to report err with, errors that aren't a validationError are reported as invalid_request
+func errorCode(err error) string {
+	if validationErr, ok := err.(*validationError); ok {
+		return validationErr.code
+	}
+	return "invalid_request"
+}
+
+// ClassFullResponse is the error written when a booking is rejected because the class is full, it suggests other
+// sessions of the same class that still have space
+type ClassFullResponse struct {
+	Err         string  `json:"error"`
+	Code        string  `json:"code"`
+	Suggestions []Class `json:"suggestions"`
+}
+
+// maxSuggestions is the most alternative classes offered when a booking is rejected because its class is full
+const maxSuggestions = 3
+
+// suggestAlternatives returns up to maxSuggestions other upcoming classes with the same name as the given class that
+// still have space, closest in date first
+func (server *Server) suggestAlternatives(full *Class) []Class {
+	suggestions := make([]Class, 0)
+	startOfToday := server.today()
+	for _, class := range server.DBClasses {
+		if class.Date.Before(startOfToday) {
+			continue
+		}
+		if class.Id != full.Id && class.Name == full.Name && !class.isFull(server.now()) && !class.Cancelled && !class.Deleted {
+			suggestions = append(suggestions, class)
+		}
+	}
+
+	distance := func(class Class) time.Duration {
+		d := class.Date.Sub(full.Date)
+		if d < 0 {
+			return -d
+		}
+		return d
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if distance(suggestions[i]) == distance(suggestions[j]) {
+			return suggestions[i].Date.Before(suggestions[j].Date)
+		}
+		return distance(suggestions[i]) < distance(suggestions[j])
+	})
+
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+	return suggestions
+}
+
+// errorResponse will write an error json constructed from inputs to ResponseWriter, code is the machine readable
+// counterpart of the human readable reason
+func errorResponse(w http.ResponseWriter, code, reason string, statusCode int) error {
+	logger.Error("request failed", "status", statusCode, "code", code, "reason", reason)
+	w.WriteHeader(statusCode)
+	errResponse := ErrorResponse{Err: reason, Code: code}
+	err := json.NewEncoder(w).Encode(errResponse)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// printable reports whether the name has no control characters, such as newlines, that would break CSV exports and
+// log lines
+func printable(name string) bool {
+	for _, r := range name {
+		if !strconv.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateMemberName checks a member name isn't blank and is printable
+func validateMemberName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return newValidationError(CodeMissingMemberName, MissingMemberName)
+	}
+	if !printable(name) {
+		return newValidationError(CodeInvalidCharacters, InvalidCharacters)
+	}
+	return nil
+}
+
+// validateMemberEmail checks an optional member email is a bare address such as david@example.com
+func validateMemberEmail(email string) error {
+	if email == "" {
+		return nil
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return newValidationError(CodeInvalidEmail, InvalidEmail)
+	}
+	return nil
+}
+
+// validateClassName checks a class name is present and, if a class catalog is configured, that it is in the catalog
+func (server *Server) validateClassName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return newValidationError(CodeMissingClassName, MissingClassName)
+	}
+	if !printable(name) {
+		return newValidationError(CodeInvalidCharacters, InvalidCharacters)
+	}
+	if len(server.config.ClassCatalog) == 0 {
+		return nil
+	}
+	for _, allowed := range server.config.ClassCatalog {
+		if strings.EqualFold(name, allowed) {
+			return nil
+		}
+	}
+	return newValidationError(CodeUnknownClassName, UnknownClassName)
+}
+
+// maxClassesPerRequest caps how many classes a single request can create, whether from a date range or an rrule
+const maxClassesPerRequest = 366
+
+// errTooManyClasses is returned when a request would create more than maxClassesPerRequest classes
+var errTooManyClasses = newValidationError(CodeTooManyClasses, TooManyClasses)
+
+// rangeDates returns each day in the range from startDate to endDate, both inclusive. A range of more than
+// maxClassesPerRequest days is errTooManyClasses.
+func rangeDates(startDate, endDate time.Time) ([]time.Time, error) {
+	days := int(endDate.Sub(startDate).Hours()/24) + 1
+	if days > maxClassesPerRequest {
+		return nil, errTooManyClasses
+	}
+	var dates []time.Time
+	for day := 0; day < days; day++ {
+		dates = append(dates, startDate.Add(time.Hour*24*time.Duration(day)))
+	}
+	return dates, nil
+}
+
+// newClassesInRange returns a copy of template for each day in the range from startDate to endDate, each with a new
+// id, its own date and no bookings. A range longer than rangeDates allows is errTooManyClasses. It stops and returns
+// the context's error if ctx is cancelled part way through.
+func (server *Server) newClassesInRange(ctx context.Context, template Class, startDate, endDate time.Time) ([]Class, error) {
+	dates, err := rangeDates(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	return server.newClassesOnDates(ctx, template, dates)
+}
+
+// maxConcurrentRequests is the most requests handled at once
+func (server *Server) maxConcurrentRequests() int {
+	if server.config.MaxConcurrentRequests == 0 {
+		return defaultMaxConcurrentRequests
+	}
+	return server.config.MaxConcurrentRequests
+}
+
+// maxBatchSize is the most items a bulk request can hold
+func (server *Server) maxBatchSize() int {
+	if server.config.MaxBatchSize == 0 {
+		return defaultMaxBatchSize
+	}
+	return server.config.MaxBatchSize
+}
+
+// validateCapacities checks there's a capacity of 0 or more for each of the count classes being created
+func validateCapacities(capacities []int, count int) error {
+	if len(capacities) != count {
+		return newValidationError(CodeCapacitiesMismatch, CapacitiesMismatch)
+	}
+	for _, capacity := range capacities {
+		if capacity < 0 {
+			return newValidationError(CodeInvalidCapacity, InvalidCapacity)
+		}
+	}
+	return nil
+}
+
+// classIDsOf returns the ids of the classes in order
+func classIDsOf(classes []Class) []string {
+	ids := make([]string, 0, len(classes))
+	for _, class := range classes {
+		ids = append(ids, class.Id)
+	}
+	return ids
+}
+
+// parseEndDate parses the end of a range of classes, an empty end date leaves the range open so it runs for the
+// configured number of days from startDate
+func (server *Server) parseEndDate(endDate string, startDate time.Time) (time.Time, error) {
+	if endDate == "" {
+		days := server.config.DefaultRangeDays
+		if days == 0 {
+			days = defaultRangeDays
+		}
+		return startDate.AddDate(0, 0, days-1), nil
+	}
+	return time.Parse(layoutISO, endDate)
+}
+
+// classCreationKey is the natural key of a request to create classes, a hash of every field of the request with the
+// name ignoring case and surrounding spaces and the start and end dates as they were resolved. Repeating the same
+// request gives the same key, so it can be found and answered with the classes it first created, while changing
+// anything that affects what gets created, such as the rrule or start_time, gives a new one.
+func classCreationKey(classRequest ClassRequest, startDate, endDate time.Time) string {
+	classRequest.Name = strings.ToLower(strings.TrimSpace(classRequest.Name))
+	classRequest.StartDate = startDate.Format(layoutISO)
+	classRequest.EndDate = endDate.Format(layoutISO)
+	// a ClassRequest is plain data so encoding it can't fail
+	encoded, _ := json.Marshal(classRequest)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// createClass is the handler function for POST requests to `/classes`, it will parse the request body, validate it and
+// append classes to `DBClasses`. Will append 1 class for each day in the range from start_date to end_date, or for the
+// configured number of days from start_date when end_date is left empty. With an rrule only the days in that range the
+// rule falls on get a class. Days that already have a class with the same name are rejected with a 409, or left out
+// when `on_conflict=skip` is given. An `If-None-Match: *` header makes the request conditional, any existing class in
+// the range fails it with a 412 so clients can safely retry. With `response=ids` only the ids of the created classes
+// are written rather than the full classes. A range that ends before today is rejected with a 422. Repeating a request
+// with the same fields, see classCreationKey, writes the classes it first created with a 200 rather than creating them
+// again, so retries are safe without an idempotency key.
+func (server *Server) createClass(w http.ResponseWriter, r *http.Request) {
+	spans := startSpans(r.Context(), "createClass")
+	defer spans.log()
+
+	onConflict := r.URL.Query().Get("on_conflict")
+	if onConflict != "" && onConflict != "skip" && onConflict != "reject" {
+		err := errorResponse(w, CodeInvalidOnConflict, InvalidOnConflict, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	ifNoneMatch := r.Header.Get("If-None-Match") == "*"
+	responseMode := r.URL.Query().Get("response")
+	if responseMode != "" && responseMode != "ids" && responseMode != "full" {
+		err := errorResponse(w, CodeInvalidResponseMode, InvalidResponseMode, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	reqBody, _ := ioutil.ReadAll(r.Body)
+
+	var classRequest ClassRequest
+	err := json.Unmarshal(reqBody, &classRequest)
+	if err != nil {
+		code, reason := CodeInvalidJSON, invalidJSON(err)
+		if _, ok := err.(*validationError); ok {
+			code, reason = errorCode(err), err.Error()
+		}
+		err = errorResponse(w, code, reason, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	spans.mark("decode")
+
+	err = server.validateClassName(classRequest.Name)
+	if err != nil {
+		err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	startDate, err := time.Parse(layoutISO, classRequest.StartDate)
+	if err != nil {
+		err = errorResponse(w, CodeInvalidDate, InvalidDate, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	endDate, err := server.parseEndDate(classRequest.EndDate, startDate)
+	if err != nil {
+		err = errorResponse(w, CodeInvalidDate, InvalidDate, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	// a range that starts in the past but runs to today or later still gets a class on every day, past ones included,
+	// so capacities line up with the days requested
+	if endDate.Before(server.today()) {
+		err = errorResponse(w, CodeRangeInPast, RangeInPast, http.StatusUnprocessableEntity)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	maxWaitlist := server.config.MaxWaitlist
+	if classRequest.MaxWaitlist != nil {
+		if *classRequest.MaxWaitlist < 0 {
+			err = errorResponse(w, CodeInvalidMaxWaitlist, InvalidMaxWaitlist, http.StatusBadRequest)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+		maxWaitlist = classRequest.MaxWaitlist
+	}
+	if classRequest.Credits < 0 {
+		err = errorResponse(w, CodeInvalidCredits, InvalidCredits, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	err = validateSessionTime(classRequest.StartTime, classRequest.DurationMinutes)
+	if err != nil {
+		err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	var location string
+	if classRequest.Location != nil {
+		location = strings.TrimSpace(*classRequest.Location)
+		if location == "" || utf8.RuneCountInString(location) > maxLocationLength {
+			err = errorResponse(w, CodeInvalidLocation, InvalidLocation, http.StatusBadRequest)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+	}
+	var dates []time.Time
+	if classRequest.RRule != "" {
+		var rule recurrence
+		rule, err = parseRRule(classRequest.RRule)
+		if err == nil {
+			dates, err = rule.dates(startDate, endDate)
+		}
+	} else {
+		dates, err = rangeDates(startDate, endDate)
+	}
+	if err != nil {
+		err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if len(classRequest.Capacities) > server.maxBatchSize() {
+		err = errorResponse(w, CodeBatchTooLarge, BatchTooLarge, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if classRequest.Capacities != nil {
+		err = validateCapacities(classRequest.Capacities, len(dates))
+		if err != nil {
+			err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+	}
+	spans.mark("validate")
+
+	creationKey := classCreationKey(classRequest, startDate, endDate)
+	if !ifNoneMatch {
+		existing, err := server.store.ListClasses(r.Context(), []classFilter{withCreationKey(creationKey)})
+		if err != nil {
+			err = errorResponse(w, CodeRequestCancelled, RequestCancelled, http.StatusServiceUnavailable)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+		if len(existing) > 0 {
+			sort.SliceStable(existing, func(i, j int) bool {
+				return existing[i].Date.Before(existing[j].Date)
+			})
+			logger.Debug("class creation repeated", "name", classRequest.Name, "count", len(existing))
+			if responseMode == "ids" {
+				err = json.NewEncoder(w).Encode(classIDsOf(existing))
+			} else {
+				err = json.NewEncoder(w).Encode(namedResponse(r, existing))
+			}
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+	}
+
+	template := Class{
+		Name:        classRequest.Name,
+		Capacity:    int(classRequest.Capacity),
+		MaxWaitlist: maxWaitlist,
+		Location:    location,
+		Credits:     classRequest.Credits,
+
+		StartTime:       classRequest.StartTime,
+		DurationMinutes: classRequest.DurationMinutes,
+		CreationKey:     creationKey,
+	}
+	classes, err := server.newClassesOnDates(r.Context(), template, dates)
+	if err == nil {
+		spans.mark("generate")
+		for i := range classRequest.Capacities {
+			classes[i].Capacity = classRequest.Capacities[i]
+		}
+		// classes are stored and returned in ascending date order whichever days end up skipped
+		sort.SliceStable(classes, func(i, j int) bool {
+			return classes[i].Date.Before(classes[j].Date)
+		})
+		classes, err = server.store.AddClasses(r.Context(), classes, onConflict == "skip" && !ifNoneMatch)
+	}
+	if err == errMemoryOnly || err == errNotSaved {
+		if !changesKept(w, err) {
+			return
+		}
+		err = nil
+	}
+	if err != nil {
+		statusCode, code, reason := http.StatusServiceUnavailable, CodeRequestCancelled, RequestCancelled
+		if err == errClassExists && ifNoneMatch {
+			statusCode, code, reason = http.StatusPreconditionFailed, CodeClassAlreadyExists, ClassAlreadyExists
+		} else if err == errClassExists {
+			statusCode, code, reason = http.StatusConflict, CodeClassAlreadyExists, ClassAlreadyExists
+		} else if err == errTooManySessions {
+			statusCode, code, reason = http.StatusConflict, CodeTooManySessions, TooManySessions
+		} else if err == errRoomDoubleBooked {
+			statusCode, code, reason = http.StatusConflict, CodeRoomDoubleBooked, RoomDoubleBooked
+		} else if err == errCooldownViolation {
+			statusCode, code, reason = http.StatusConflict, CodeCooldownViolation, CooldownViolation
+		}
+		err = errorResponse(w, code, reason, statusCode)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	spans.mark("store")
+
+	logger.Debug("created classes", "name", classRequest.Name, "count", len(classes))
+	w.WriteHeader(http.StatusCreated)
+	if responseMode == "ids" {
+		err = json.NewEncoder(w).Encode(classIDsOf(classes))
+	} else {
+		err = json.NewEncoder(w).Encode(namedResponse(r, classes))
+	}
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+		return
+	}
+	spans.mark("encode")
+}
+
+// DuplicateClassRequest is the range of dates a class should be copied onto
+type DuplicateClassRequest struct {
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+}
+
+// duplicateClass is the handler function for POST requests to `/classes/{id}/duplicate`, it copies the class onto
+// each day in the range from start_date to end_date. The copies get new ids and start with no bookings.
+func (server *Server) duplicateClass(w http.ResponseWriter, r *http.Request) {
+	reqBody, _ := ioutil.ReadAll(r.Body)
+	var duplicateRequest DuplicateClassRequest
+	err := json.Unmarshal(reqBody, &duplicateRequest)
+	if err != nil {
+		err = errorResponse(w, CodeInvalidJSON, invalidJSON(err), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	startDate, err := time.Parse(layoutISO, duplicateRequest.StartDate)
+	if err != nil {
+		err = errorResponse(w, CodeInvalidDate, InvalidDate, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	endDate, err := time.Parse(layoutISO, duplicateRequest.EndDate)
+	if err != nil {
+		err = errorResponse(w, CodeInvalidDate, InvalidDate, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	server.dbLock.Lock()
+	defer server.dbLock.Unlock()
+	source, err := server.findClassByID(mux.Vars(r)["id"])
+	if err != nil {
+		err = errorResponse(w, CodeClassDoesNotExists, ClassDoesNotExists, http.StatusNotFound)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	// the copies weren't made by the request that created source so mustn't answer a repeat of it
+	template := *source
+	template.CreationKey = ""
+	classes, err := server.newClassesInRange(r.Context(), template, startDate, endDate)
+	if err == errTooManyClasses {
+		err = errorResponse(w, CodeTooManyClasses, TooManyClasses, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if err != nil {
+		err = errorResponse(w, CodeRequestCancelled, RequestCancelled, http.StatusServiceUnavailable)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	for _, class := range classes {
+		if server.sessionsFull(class.Name, class.Date) {
+			err = errorResponse(w, CodeTooManySessions, TooManySessions, http.StatusConflict)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+		if err = server.roomConflict(class, server.DBClasses); err != nil {
+			roomConflictResponse(w, err)
+			return
+		}
+	}
+	snapshot := server.rollbackPoint()
+	server.DBClasses = append(server.DBClasses, classes...)
+	if !changesKept(w, server.commitChanges(snapshot, server.lastClasses(len(classes))...)) {
+		return
+	}
+
+	logger.Debug("duplicated class", "source", mux.Vars(r)["id"], "count", len(classes))
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(namedResponse(r, classes))
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// RescheduleRequest is the day a class should move to
+type RescheduleRequest struct {
+	Date string `json:"date"`
+}
+
+// rescheduleClass is the handler function for POST requests to `/classes/{id}/reschedule`, it moves the class and its
+// bookings to another day as long as no class with the same name is already on that day. Members with a confirmed or
+// waitlisted booking are told through the notifier.
+func (server *Server) rescheduleClass(w http.ResponseWriter, r *http.Request) {
+	reqBody, _ := ioutil.ReadAll(r.Body)
+	var rescheduleRequest RescheduleRequest
+	err := json.Unmarshal(reqBody, &rescheduleRequest)
+	if err != nil {
+		err = errorResponse(w, CodeInvalidJSON, invalidJSON(err), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	date, err := time.Parse(layoutISO, rescheduleRequest.Date)
+	if err != nil {
+		err = errorResponse(w, CodeInvalidDate, InvalidDate, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	server.dbLock.Lock()
+	defer server.dbLock.Unlock()
+	class, err := server.findClassByID(mux.Vars(r)["id"])
+	if err != nil {
+		err = errorResponse(w, CodeClassDoesNotExists, ClassDoesNotExists, http.StatusNotFound)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if class.Cancelled {
+		err = errorResponse(w, CodeClassCancelled, ClassCancelled, http.StatusConflict)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if existing, err := server.findClassReference(class.Name, date); err == nil && existing.Id != class.Id {
+		err = errorResponse(w, CodeClassAlreadyExists, ClassAlreadyExists, http.StatusConflict)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	moved := *class
+	moved.Date = date
+	if err = server.roomConflict(moved, server.DBClasses); err != nil {
+		roomConflictResponse(w, err)
+		return
+	}
+
+	snapshot := server.rollbackPoint()
+	previous := class.Date
+	class.Date = date
+	class.Version++
+	if !changesKept(w, server.commitChanges(snapshot, class)) {
+		return
+	}
+
+	message := fmt.Sprintf("%s on %s has moved to %s", class.Name, previous.Format(layoutISO), date.Format(layoutISO))
+	for _, booking := range class.Bookings {
+		if booking.Status != BookingCancelled {
+			server.notifier.Notify(booking.MemberName, message)
+		}
+	}
+	logger.Debug("rescheduled class", "id", class.Id, "from", previous, "to", date)
+	w.Header().Set("ETag", class.etag())
+	err = json.NewEncoder(w).Encode(namedResponse(r, class))
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// BulkRescheduleRequest is the name of the classes to move and how many days to move them by, negative days move them
+// earlier
+type BulkRescheduleRequest struct {
+	Name      string `json:"name"`
+	ShiftDays int    `json:"shift_days"`
+}
+
+// rescheduleClasses is the handler function for POST requests to `/classes/reschedule`, it moves every class with the
+// name, along with its bookings, by shift_days. Cancelled classes stay where they are. Either all of the classes move
+// or, if any would land on a day that already has a class with the same name or clash in its room, none of them do.
+// Members with a confirmed or waitlisted booking are told through the notifier. The moved classes are written in date
+// order.
+func (server *Server) rescheduleClasses(w http.ResponseWriter, r *http.Request) {
+	reqBody, _ := ioutil.ReadAll(r.Body)
+	var rescheduleRequest BulkRescheduleRequest
+	err := json.Unmarshal(reqBody, &rescheduleRequest)
+	if err != nil {
+		err = errorResponse(w, CodeInvalidJSON, invalidJSON(err), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if strings.TrimSpace(rescheduleRequest.Name) == "" {
+		err = newValidationError(CodeMissingClassName, MissingClassName)
+	} else if rescheduleRequest.ShiftDays == 0 {
+		err = newValidationError(CodeInvalidShiftDays, InvalidShiftDays)
+	}
+	if err != nil {
+		err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	server.dbLock.Lock()
+	defer server.dbLock.Unlock()
+	var indexes []int
+	// after is DBClasses as it would be once the classes have moved, so they are checked against each other's new days
+	after := append([]Class(nil), server.DBClasses...)
+	for index := range after {
+		class := &after[index]
+		if class.Name == rescheduleRequest.Name && !class.Cancelled && !class.Deleted {
+			class.Date = class.Date.AddDate(0, 0, rescheduleRequest.ShiftDays)
+			indexes = append(indexes, index)
+		}
+	}
+	if len(indexes) == 0 {
+		err = errorResponse(w, CodeClassDoesNotExists, ClassDoesNotExists, http.StatusNotFound)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	for _, index := range indexes {
+		moved := after[index]
+		for _, other := range after {
+			if other.Id != moved.Id && other.Name == moved.Name && other.Date.Equal(moved.Date) && !other.Deleted {
+				err = errorResponse(w, CodeClassAlreadyExists, ClassAlreadyExists, http.StatusConflict)
+				if err != nil {
+					logger.Error("failed to write response", "err", err)
+				}
+				return
+			}
+		}
+		if err = server.roomConflict(moved, after); err != nil {
+			roomConflictResponse(w, err)
+			return
+		}
+	}
+
+	snapshot := server.rollbackPoint()
+	moved := make([]Class, 0, len(indexes))
+	changed := make([]*Class, 0, len(indexes))
+	previous := make([]time.Time, 0, len(indexes))
+	for _, index := range indexes {
+		class := &server.DBClasses[index]
+		changed = append(changed, class)
+		previous = append(previous, class.Date)
+		class.Date = after[index].Date
+		class.Version++
+		moved = append(moved, *class)
+	}
+	if !changesKept(w, server.commitChanges(snapshot, changed...)) {
+		return
+	}
+	for index, class := range changed {
+		message := fmt.Sprintf("%s on %s has moved to %s", class.Name, previous[index].Format(layoutISO), class.Date.Format(layoutISO))
+		for _, booking := range class.Bookings {
+			if booking.Status != BookingCancelled {
+				server.notifier.Notify(booking.MemberName, message)
+			}
+		}
+	}
+	sort.SliceStable(moved, func(i, j int) bool {
+		return moved[i].Date.Before(moved[j].Date)
+	})
+
+	logger.Debug("rescheduled classes", "name", rescheduleRequest.Name, "count", len(moved), "days", rescheduleRequest.ShiftDays)
+	err = json.NewEncoder(w).Encode(namedResponse(r, moved))
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// ImportResult reports the outcome of importing a single row of a CSV file
+type ImportResult struct {
+	Row    int    `json:"row"`
+	Status string `json:"status"`
+	Class  *Class `json:"class,omitempty"`
+	Err    string `json:"error,omitempty"`
+	Code   string `json:"code,omitempty"`
+}
+
+// parseImportRow validates a `name,date,capacity` CSV row the same way createClass validates its request
+func (server *Server) parseImportRow(record []string) (Class, error) {
+	if len(record) != 3 {
+		return Class{}, newValidationError(CodeInvalidCSVRow, InvalidCSVRow)
+	}
+	err := server.validateClassName(strings.TrimSpace(record[0]))
+	if err != nil {
+		return Class{}, err
+	}
+	date, err := time.Parse(layoutISO, strings.TrimSpace(record[1]))
+	if err != nil {
+		return Class{}, newValidationError(CodeInvalidDate, InvalidDate)
+	}
+	capacity, err := strconv.Atoi(strings.TrimSpace(record[2]))
+	if err != nil || capacity < 0 {
+		return Class{}, newValidationError(CodeInvalidCapacity, InvalidCapacity)
+	}
+	return Class{
+		Id:          server.ids.NewID(),
+		Name:        strings.TrimSpace(record[0]),
+		Date:        date,
+		Capacity:    capacity,
+		Version:     1,
+		MaxWaitlist: server.config.MaxWaitlist,
+	}, nil
+}
+
+// importRowConflict checks a parsed import row against the classes already there, including rows imported before it,
+// the same way createClass and AddClasses check new classes
+func (server *Server) importRowConflict(class Class) error {
+	if class.Date.Before(server.today()) {
+		return newValidationError(CodeClassInPast, ClassInPast)
+	}
+	if server.classExists(class.Name, class.Date) {
+		return newValidationError(CodeClassAlreadyExists, ClassAlreadyExists)
+	}
+	if server.sessionsFull(class.Name, class.Date) {
+		return newValidationError(CodeTooManySessions, TooManySessions)
+	}
+	switch server.roomConflict(class, server.DBClasses) {
+	case errRoomDoubleBooked:
+		return newValidationError(CodeRoomDoubleBooked, RoomDoubleBooked)
+	case errCooldownViolation:
+		return newValidationError(CodeCooldownViolation, CooldownViolation)
+	}
+	return nil
+}
+
+// importClassesCSV is the handler function for POST requests to `/classes/import`, it reads a CSV body with the
+// columns name,date,capacity and creates one class per valid row. An optional header row is skipped. Every row gets
+// a result so a bad row doesn't stop the good rows around it being created.
+func (server *Server) importClassesCSV(w http.ResponseWriter, r *http.Request) {
+	reader := csv.NewReader(r.Body)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		err = errorResponse(w, CodeInvalidCSV, InvalidCSV, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	if len(records) > 0 && strings.EqualFold(strings.Join(records[0], ","), "name,date,capacity") {
+		records = records[1:]
+	}
+	if len(records) > server.maxBatchSize() {
+		err = errorResponse(w, CodeBatchTooLarge, BatchTooLarge, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	server.dbLock.Lock()
+	snapshot := server.rollbackPoint()
+	results := make([]ImportResult, 0, len(records))
+	created := 0
+	for index, record := range records {
+		result := ImportResult{Row: index + 1}
+		class, err := server.parseImportRow(record)
+		if err == nil {
+			err = server.importRowConflict(class)
+		}
+		if err != nil {
+			result.Status = "error"
+			result.Err = err.Error()
+			result.Code = errorCode(err)
+		} else {
+			server.DBClasses = append(server.DBClasses, class)
+			created++
+			result.Status = "created"
+			result.Class = &class
+		}
+		results = append(results, result)
+	}
+	err = server.commitChanges(snapshot, server.lastClasses(created)...)
+	server.dbLock.Unlock()
+	if !changesKept(w, err) {
+		return
+	}
+
+	logger.Debug("imported classes", "rows", len(results))
+	err = json.NewEncoder(w).Encode(results)
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// ClassDetail is a class along with counts of its bookings, used when a single class is fetched
+type ClassDetail struct {
+	Class
+	Booked         int `json:"booked"`
+	Waitlisted     int `json:"waitlisted"`
+	Held           int `json:"held"`
+	SpotsAvailable int `json:"spots_available"`
+}
+
+// newClassDetail counts the bookings of the class, and its holds at now
+func newClassDetail(class *Class, now time.Time) ClassDetail {
+	detail := ClassDetail{
+		Class:      *class,
+		Booked:     class.countBookings(BookingConfirmed),
+		Waitlisted: class.countBookings(BookingWaitlisted),
+		Held:       class.activeHolds(now),
+	}
+	detail.SpotsAvailable = class.spotsAvailable(now)
+	return detail
+}
+
+// sortClassesByStart orders classes by when they start, classes starting together keep their order
+func (server *Server) sortClassesByStart(classes []Class) {
+	sort.SliceStable(classes, func(i, j int) bool {
+		return server.classStart(&classes[i]).Before(server.classStart(&classes[j]))
+	})
+}
+
+// getMemberAvailableClasses is the handler function for GET requests to `/members/{name}/available`, it will write to
+// ResponseWriter the upcoming classes with space the member isn't already booked into, in the order they start. An
+// optional `?email=` identifies the member by email as well, see isMember.
+func (server *Server) getMemberAvailableClasses(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	email := r.URL.Query().Get("email")
+	filters, err := server.parseClassFilters(url.Values{"upcoming": {"true"}, "available": {"true"}})
+	var classes []Class
+	if err == nil {
+		filters = append(filters, func(class Class) bool {
+			return !class.hasActiveBooking(name, email)
+		})
+		classes, err = server.store.ListClasses(r.Context(), filters)
+	}
+	if err != nil {
+		err = errorResponse(w, CodeRequestCancelled, RequestCancelled, http.StatusServiceUnavailable)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	server.sortClassesByStart(classes)
+
+	logger.Debug("listed classes available to member", "member", name, "count", len(classes))
+	err = json.NewEncoder(w).Encode(namedResponse(r, classes))
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// lookupClass is the handler function for GET requests to `/classes/lookup?name=&date=`, it will write to
+// ResponseWriter the class with the name on the date, for clients that know classes by those rather than by id
+func (server *Server) lookupClass(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if strings.TrimSpace(name) == "" {
+		err := errorResponse(w, CodeMissingClassName, MissingClassName, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	date, err := time.Parse(layoutISO, r.URL.Query().Get("date"))
+	if err != nil {
+		err = errorResponse(w, CodeInvalidDate, InvalidDate, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	server.dbLock.RLock()
+	defer server.dbLock.RUnlock()
+	class, err := server.findClassReference(name, date)
+	if err != nil {
+		err = errorResponse(w, CodeClassDoesNotExists, ClassDoesNotExists, http.StatusNotFound)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	logger.Debug("looked up class", "id", class.Id)
+	w.Header().Set("ETag", class.etag())
+	err = json.NewEncoder(w).Encode(namedResponse(r, newClassDetail(class, server.now())))
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// ClassChanges is the response to getClassChanges
+type ClassChanges struct {
+	// Classes changed since the requested sequence, oldest change first
+	Classes []Class `json:"classes"`
+	// DeletedIds are the ids of classes deleted since the requested sequence
+	DeletedIds []string `json:"deleted_ids"`
+	// ChangeSeq is the current change sequence, the since to ask for next time
+	ChangeSeq uint64 `json:"change_seq"`
+}
+
+// getClassChanges is the handler function for GET requests to `/classes/changes?since=`, it will write to
+// ResponseWriter the classes changed after the change sequence since along with the current sequence, so clients can
+// keep a copy of the classes in sync without fetching all of them every time
+func (server *Server) getClassChanges(w http.ResponseWriter, r *http.Request) {
+	var since uint64
+	if value := r.URL.Query().Get("since"); value != "" {
+		var err error
+		since, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			err = errorResponse(w, CodeInvalidSince, InvalidSince, http.StatusBadRequest)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+	}
+
+	changes := ClassChanges{Classes: make([]Class, 0), DeletedIds: make([]string, 0)}
+	server.dbLock.RLock()
+	changes.ChangeSeq = server.changeSeq
+	for _, class := range server.DBClasses {
+		if class.ChangeSeq <= since {
+			continue
+		}
+		if class.Deleted {
+			changes.DeletedIds = append(changes.DeletedIds, class.Id)
+			continue
+		}
+		changes.Classes = append(changes.Classes, class)
+	}
+	server.dbLock.RUnlock()
+	sort.SliceStable(changes.Classes, func(i, j int) bool {
+		return changes.Classes[i].ChangeSeq < changes.Classes[j].ChangeSeq
+	})
+
+	logger.Debug("got class changes", "since", since, "change_seq", changes.ChangeSeq, "count", len(changes.Classes))
+	err := json.NewEncoder(w).Encode(namedResponse(r, changes))
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// getNextClass is the handler function for GET requests to `/classes/next?name=`, it will write to ResponseWriter the
+// soonest upcoming class with the name, matched case-insensitively, that isn't full or cancelled
+func (server *Server) getNextClass(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if strings.TrimSpace(name) == "" {
+		err := errorResponse(w, CodeMissingClassName, MissingClassName, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	filters, err := server.parseClassFilters(url.Values{"name": {name}, "upcoming": {"true"}, "available": {"true"}})
+	var classes []Class
+	if err == nil {
+		classes, err = server.store.ListClasses(r.Context(), filters)
+	}
+	if err != nil {
+		err = errorResponse(w, CodeRequestCancelled, RequestCancelled, http.StatusServiceUnavailable)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if len(classes) == 0 {
+		err = errorResponse(w, CodeNoUpcomingClass, NoUpcomingClass, http.StatusNotFound)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	server.sortClassesByStart(classes)
+
+	logger.Debug("found next class", "name", name, "id", classes[0].Id)
+	err = json.NewEncoder(w).Encode(namedResponse(r, classes[0]))
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// getTodaysClasses is the handler function for GET requests to `/classes/today`, it will write to ResponseWriter the
+// classes on today's date in the server's timezone, in the order they start
+func (server *Server) getTodaysClasses(w http.ResponseWriter, r *http.Request) {
+	classes, err := server.store.ListClasses(r.Context(), []classFilter{onDate(server.today())})
+	if err != nil {
+		err = errorResponse(w, CodeRequestCancelled, RequestCancelled, http.StatusServiceUnavailable)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	server.sortClassesByStart(classes)
+
+	logger.Debug("listed today's classes", "count", len(classes))
+	err = json.NewEncoder(w).Encode(namedResponse(r, classes))
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// getClassNames is the handler function for GET requests to `/classes/names`, it will write to ResponseWriter the
+// sorted names of all classes. Names differing only by case are listed once, as the first class with it spells it.
+func (server *Server) getClassNames(w http.ResponseWriter, r *http.Request) {
+	server.dbLock.RLock()
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for _, class := range applyClassFilters(server.DBClasses, nil) {
+		key := strings.ToLower(class.Name)
+		if !seen[key] {
+			seen[key] = true
+			names = append(names, class.Name)
+		}
+	}
+	server.dbLock.RUnlock()
+
+	sort.Slice(names, func(i, j int) bool {
+		return strings.ToLower(names[i]) < strings.ToLower(names[j])
+	})
+
+	logger.Debug("listed class names", "count", len(names))
+	err := json.NewEncoder(w).Encode(names)
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// getClass is the handler function for GET requests to `/classes/{id}`, it will write the class and counts of its
+// bookings to ResponseWriter along with its current version as an ETag. Fields are camelCase with `naming=camel` and
+// the date is YYYY-MM-DD with `date_format=date`.
+func (server *Server) getClass(w http.ResponseWriter, r *http.Request) {
+	naming, err := parseNaming(r.URL.Query())
+	var dateOnly bool
+	if err == nil {
+		dateOnly, err = parseDateFormat(r.URL.Query())
+	}
+	if err != nil {
+		err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	server.dbLock.RLock()
+	defer server.dbLock.RUnlock()
+	class, err := server.findClassByID(mux.Vars(r)["id"])
+	if err == errClassDeleted {
+		err = errorResponse(w, CodeClassDeleted, ClassDeleted, http.StatusGone)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if err != nil {
+		err = errorResponse(w, CodeClassDoesNotExists, ClassDoesNotExists, http.StatusNotFound)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	logger.Debug("fetched class", "id", class.Id)
+	w.Header().Set("ETag", class.etag())
+	err = json.NewEncoder(w).Encode(formatClassDetail(newClassDetail(class, server.now()), naming, dateOnly))
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// updateClass is the handler function for PUT and PATCH requests to `/classes/{id}`, the request must carry an
+// If-Match header matching the class's current ETag so concurrent edits can't silently overwrite each other
+func (server *Server) updateClass(w http.ResponseWriter, r *http.Request) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		err := errorResponse(w, CodeMissingIfMatch, MissingIfMatch, http.StatusPreconditionRequired)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	reqBody, _ := ioutil.ReadAll(r.Body)
+	var updateRequest ClassUpdateRequest
+	err := json.Unmarshal(reqBody, &updateRequest)
+	if err != nil {
+		code, reason := CodeInvalidJSON, invalidJSON(err)
+		if _, ok := err.(*validationError); ok {
+			code, reason = errorCode(err), err.Error()
+		}
+		err = errorResponse(w, code, reason, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	var date time.Time
+	if updateRequest.Date != nil {
+		date, err = time.Parse(layoutISO, *updateRequest.Date)
+		if err != nil {
+			err = errorResponse(w, CodeInvalidDate, InvalidDate, http.StatusBadRequest)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+	}
+	if updateRequest.Name != nil {
+		err = server.validateClassName(*updateRequest.Name)
+		if err != nil {
+			err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+	}
+
+	server.dbLock.Lock()
+	defer server.dbLock.Unlock()
+	class, err := server.findClassByID(mux.Vars(r)["id"])
+	if err != nil {
+		err = errorResponse(w, CodeClassDoesNotExists, ClassDoesNotExists, http.StatusNotFound)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if ifMatch != class.etag() {
+		err = errorResponse(w, CodeVersionMismatch, VersionMismatch, http.StatusPreconditionFailed)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	snapshot := server.rollbackPoint()
+	updated := *class
+	if updateRequest.Date != nil {
+		updated.Date = date
+	}
+	if updateRequest.Name != nil {
+		updated.Name = *updateRequest.Name
+	}
+	if updateRequest.Capacity != nil {
+		updated.Capacity = int(*updateRequest.Capacity)
+		excess := updated.countBookings(BookingConfirmed) - updated.Capacity
+		if excess > 0 && !updated.waitlistHasRoom(excess) {
+			err = errorResponse(w, CodeCapacityBelowBookings, CapacityBelowBookings, http.StatusConflict)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+		updated.fitCapacity(server.now())
+	}
+	if err = server.roomConflict(updated, server.DBClasses); err != nil {
+		roomConflictResponse(w, err)
+		return
+	}
+	updated.Version++
+	*class = updated
+	if !changesKept(w, server.commitChanges(snapshot, class)) {
+		return
+	}
+	logger.Debug("updated class", "id", class.Id, "version", class.Version)
+
+	w.Header().Set("ETag", class.etag())
+	err = json.NewEncoder(w).Encode(namedResponse(r, class))
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// getClassesByIDs handles GET requests to `/classes?ids=id1,id2`, it will write to ResponseWriter the classes with
+// the given ids in the order they were asked for. Unknown ids are left out and listed in the X-Missing-IDs header.
+func (server *Server) getClassesByIDs(w http.ResponseWriter, ids []string, naming string, dateOnly bool) {
+	for _, id := range ids {
+		if !server.validID(id) {
+			err := errorResponse(w, CodeInvalidClassID, InvalidClassID, http.StatusBadRequest)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+	}
+
+	server.dbLock.RLock()
+	classes := make([]Class, 0, len(ids))
+	missing := make([]string, 0)
+	for _, id := range ids {
+		class, err := server.findClassByID(id)
+		if err != nil {
+			missing = append(missing, id)
+			continue
+		}
+		classes = append(classes, *class)
+	}
+	list, err := newClassList(classes, nil, naming, dateOnly)
+	server.dbLock.RUnlock()
+	if err != nil {
+		err = errorResponse(w, CodeInternalError, InternalError, http.StatusInternalServerError)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	logger.Debug("listed classes by id", "found", len(classes), "missing", len(missing))
+	if len(missing) > 0 {
+		w.Header().Set("X-Missing-IDs", strings.Join(missing, ","))
+	}
+	w.Header().Set("X-Total-Capacity", strconv.Itoa(list.totalCapacity))
+	w.Header().Set("X-Total-Booked", strconv.Itoa(list.totalBooked))
+	_, err = w.Write(list.body)
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// getClasses is the handler function for GET requests to `/classes`, it will write to ResponseWriter all classes in `DBClasses`
+// matching the filters in the query parameters, with their total capacity and confirmed bookings in the X-Total-Capacity
+// and X-Total-Booked headers. If limit or offset are given only that page is written, in a PageResponse envelope. With
+// `?group_by=date` the classes are grouped by day instead, see newClassListByDate, and with `?date_format=date` their
+// dates are written as YYYY-MM-DD. Fields are camelCase with `naming=camel`.
+// The unfiltered, unpaged list is cached until the next change to DBClasses.
+func (server *Server) getClasses(w http.ResponseWriter, r *http.Request) {
+	naming, err := parseNaming(r.URL.Query())
+	var dateOnly bool
+	if err == nil {
+		dateOnly, err = parseDateFormat(r.URL.Query())
+	}
+	if err != nil {
+		err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if ids := r.URL.Query().Get("ids"); ids != "" {
+		server.getClassesByIDs(w, strings.Split(ids, ","), naming, dateOnly)
+		return
+	}
+
+	spans := startSpans(r.Context(), "getClasses")
+	defer spans.log()
+	filters, err := server.parseClassFilters(r.URL.Query())
+	if err != nil {
+		err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	page, err := parsePagination(r.URL.Query())
+	if err != nil {
+		err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	groupBy := r.URL.Query().Get("group_by")
+	if (groupBy != "" && groupBy != "date") || (groupBy != "" && page != nil) {
+		err = errorResponse(w, CodeInvalidClassGroupBy, InvalidClassGroupBy, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	var list *classList
+	if groupBy == "date" {
+		var classes []Class
+		classes, err = server.store.ListClasses(r.Context(), filters)
+		if err == nil {
+			list, err = server.newClassListByDate(classes, naming, dateOnly)
+		}
+	} else if len(filters) > 0 || page != nil || dateOnly || naming != namingSnake {
+		var classes []Class
+		classes, err = server.store.ListClasses(r.Context(), filters)
+		if err == nil {
+			list, err = newClassList(classes, page, naming, dateOnly)
+		}
+	} else {
+		list, err = server.cachedClassList()
+	}
+	spans.mark("serialize")
+	if err != nil {
+		err = errorResponse(w, CodeInternalError, InternalError, http.StatusInternalServerError)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	logger.Debug("listed classes", "filters", len(filters), "bytes", len(list.body))
+	w.Header().Set("X-Total-Capacity", strconv.Itoa(list.totalCapacity))
+	w.Header().Set("X-Total-Booked", strconv.Itoa(list.totalBooked))
+	_, err = w.Write(list.body)
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+		return
+	}
+	spans.mark("write")
+}
+
+// bookingWaitPollInterval is how often a booking waiting for a spot checks the class again
+var bookingWaitPollInterval = 50 * time.Millisecond
+
+// parseBookingWait reads the `wait` query parameter of a booking, capped at the configured maximum
+func (server *Server) parseBookingWait(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	wait, err := time.ParseDuration(value)
+	if err != nil || wait < 0 {
+		return 0, errors.New(InvalidWait)
+	}
+	maxWait := server.config.MaxBookingWait
+	if maxWait == 0 {
+		maxWait = defaultMaxBookingWait
+	}
+	if wait > maxWait {
+		wait = maxWait
+	}
+	return wait, nil
+}
+
+// BookingValidation is what validateBooking writes for a booking that could be made, Status is the status it would get
+type BookingValidation struct {
+	Bookable bool   `json:"bookable"`
+	Status   string `json:"status"`
+}
+
+// validateBooking is the handler function for POST requests to `/bookings/validate`, it makes the same checks as
+// createBooking for the request body without booking anything. A booking that could be made gets a BookingValidation,
+// otherwise the error createBooking would give is written.
+func (server *Server) validateBooking(w http.ResponseWriter, r *http.Request) {
+	reqBody, _ := ioutil.ReadAll(r.Body)
+	var bookingRequest BookingRequest
+	err := json.Unmarshal(reqBody, &bookingRequest)
+	if err != nil {
+		err = errorResponse(w, CodeInvalidJSON, invalidJSON(err), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	defaultMemberName(r, &bookingRequest.MemberName)
+	err = validateMemberName(bookingRequest.MemberName)
+	if err == nil {
+		err = validateMemberEmail(bookingRequest.MemberEmail)
+	}
+	if err != nil {
+		err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	date, err := time.Parse(layoutISO, bookingRequest.Date)
+	if err != nil {
+		err = errorResponse(w, CodeInvalidDate, InvalidDate, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	server.dbLock.RLock()
+	defer server.dbLock.RUnlock()
+	class, err := server.findClassReference(bookingRequest.ClassName, date)
+	if err != nil {
+		err = errorResponse(w, CodeClassDoesNotExists, ClassDoesNotExists, http.StatusNotFound)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	status, rejection := server.checkBooking(class, bookingRequest)
+	if rejection != nil {
+		server.writeBookingRejection(w, class, rejection)
+		return
+	}
+
+	logger.Debug("validated booking", "class", class.Id, "status", status)
+	err = json.NewEncoder(w).Encode(BookingValidation{Bookable: true, Status: status})
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// bookingRejection is why a booking can't be made, with the status code to report it with
+type bookingRejection struct {
+	statusCode int
+	code       string
+	reason     string
+}
+
+// checkBooking makes createBooking's checks on the class it found for the request, without changing anything. It
+// returns the status the booking would get or why it would be rejected.
+func (server *Server) checkBooking(class *Class, bookingRequest BookingRequest) (string, *bookingRejection) {
+	if class.Cancelled {
+		return "", &bookingRejection{http.StatusConflict, CodeClassCancelled, ClassCancelled}
+	}
+	if server.config.BookingWindowDays > 0 && class.Date.After(server.today().AddDate(0, 0, server.config.BookingWindowDays)) {
+		return "", &bookingRejection{http.StatusConflict, CodeBookingNotYetOpen, BookingNotYetOpen}
+	}
+	if server.bookingTooLate(class) {
+		return "", &bookingRejection{http.StatusConflict, CodeBookingTooLate, BookingTooLate}
+	}
+	if class.hasActiveBooking(bookingRequest.MemberName, bookingRequest.MemberEmail) {
+		return "", &bookingRejection{http.StatusConflict, CodeMemberAlreadyBooked, MemberAlreadyBooked}
+	}
+	if server.config.RejectTimeConflicts && server.memberTimeConflict(class, bookingRequest.MemberName, bookingRequest.MemberEmail) {
+		return "", &bookingRejection{http.StatusConflict, CodeMemberTimeConflict, MemberTimeConflict}
+	}
+	// a class without capacity was never bookable, rather than filled up, so it isn't reported as full
+	if class.Capacity == 0 {
+		return "", &bookingRejection{http.StatusConflict, CodeClassNotBookable, ClassNotBookable}
+	}
+	if !class.isFullFor(bookingRequest.MemberName, server.now()) {
+		return BookingConfirmed, nil
+	}
+	noWaitlist := class.MaxWaitlist != nil && *class.MaxWaitlist == 0
+	if !bookingRequest.Waitlist || noWaitlist {
+		return "", &bookingRejection{http.StatusConflict, CodeClassIsFull, ClassIsFull}
+	}
+	if class.waitlistIsFull() {
+		return "", &bookingRejection{http.StatusConflict, CodeWaitlistFull, WaitlistFull}
+	}
+	return BookingWaitlisted, nil
+}
+
+// writeBookingRejection writes why a booking for the class was rejected, a full class suggests other sessions of it
+// that still have space
+func (server *Server) writeBookingRejection(w http.ResponseWriter, class *Class, rejection *bookingRejection) {
+	var err error
+	if rejection.code == CodeClassIsFull {
+		w.WriteHeader(rejection.statusCode)
+		err = json.NewEncoder(w).Encode(ClassFullResponse{
+			Err:         ClassIsFull,
+			Code:        CodeClassIsFull,
+			Suggestions: server.suggestAlternatives(class),
+		})
+	} else {
+		err = errorResponse(w, rejection.code, rejection.reason, rejection.statusCode)
+	}
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// waitForSpot polls a full class until a spot frees up, the wait runs out or ctx is cancelled, and returns the class
+// as it was last seen. dbLock must be held for writing when it's called and is held again when it returns, but is
+// released while waiting so cancellations can get in.
+func (server *Server) waitForSpot(ctx context.Context, className string, date time.Time, wait time.Duration) (*Class, error) {
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	for {
+		server.dbLock.Unlock()
+		select {
+		case <-ctx.Done():
+		case <-time.After(bookingWaitPollInterval):
+		}
+		server.dbLock.Lock()
+
+		class, err := server.findClassReference(className, date)
+		if err != nil || !class.isFull(server.now()) || ctx.Err() != nil {
+			return class, err
+		}
+	}
+}
+
+// createBooking is the handler function for POST requests to `/bookings`, it will parse the request body, validate it
+// and appends a booking to the appropriate class if it exists.
+// If the class is full and `wait` is given, e.g. `?wait=2s`, it waits up to that long for a spot to free up. Every
+// rejection is counted in bookingsRejected. A member_name left out defaults to the member the bearer token names.
+func (server *Server) createBooking(w http.ResponseWriter, r *http.Request) {
+	spans := startSpans(r.Context(), "createBooking")
+	defer spans.log()
+	reqBody, _ := ioutil.ReadAll(r.Body)
+	var bookingRequest BookingRequest
+	err := json.Unmarshal(reqBody, &bookingRequest)
+	if err != nil {
+		bookingsRejected.inc(rejectedInvalidRequest)
+		err = errorResponse(w, CodeInvalidJSON, invalidJSON(err), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	defaultMemberName(r, &bookingRequest.MemberName)
+	err = validateMemberName(bookingRequest.MemberName)
+	if err == nil {
+		err = validateMemberEmail(bookingRequest.MemberEmail)
+	}
+	if err != nil {
+		bookingsRejected.inc(rejectedInvalidRequest)
+		err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	date, err := time.Parse(layoutISO, bookingRequest.Date)
+	if err != nil {
+		bookingsRejected.inc(rejectedInvalidRequest)
+		err = errorResponse(w, CodeInvalidDate, InvalidDate, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
 
-// findClassReference will return a pointer to the first class with a matching name and date to given input
-// in a real real world scenario we'd use its Id to guarantee it was unique
-func findClassReference(className string, date time.Time) (*Class, error) {
-	for index, class := range DBClasses {
-		if class.Name == className && class.Date == date {
-			return &DBClasses[index], nil
+	spans.mark("decode")
+
+	wait, err := server.parseBookingWait(r.URL.Query().Get("wait"))
+	if err != nil {
+		bookingsRejected.inc(rejectedInvalidRequest)
+		err = errorResponse(w, CodeInvalidWait, InvalidWait, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
 		}
+		return
 	}
-	return nil, fmt.Errorf("that class does not exsist")
-}
 
-type Booking struct {
-	MemberName string
-	Id         string
-}
+	server.dbLock.Lock()
+	defer server.dbLock.Unlock()
+	spans.mark("lock")
+	class, err := server.findClassReference(bookingRequest.ClassName, date)
+	if err == nil && wait > 0 && class.isFull(server.now()) && !bookingRequest.Waitlist {
+		class, err = server.waitForSpot(r.Context(), bookingRequest.ClassName, date, wait)
+		spans.mark("wait")
+	}
+	if err != nil {
+		bookingsRejected.inc(rejectedClassNotFound)
+		err = errorResponse(w, CodeClassDoesNotExists, ClassDoesNotExists, http.StatusNotFound)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	spans.mark("lookup")
 
-type BookingRequest struct {
-	Id         string `json:"id"`
-	MemberName string `json:"member_name"`
-	ClassName  string `json:"class_name"`
-	Date       string `json:"date"`
+	status, rejection := server.checkBooking(class, bookingRequest)
+	if rejection != nil {
+		bookingsRejected.inc(rejectionReason(rejection))
+		server.writeBookingRejection(w, class, rejection)
+		return
+	}
+	snapshot := server.rollbackPoint()
+	// the member's hold has become their booking
+	class.releaseHold(bookingRequest.MemberName)
+
+	bookingRequest.Status = status
+	bookingRequest.Id = server.ids.NewID()
+	class.addBooking(Booking{
+		MemberName:  bookingRequest.MemberName,
+		MemberEmail: bookingRequest.MemberEmail,
+		Id:          bookingRequest.Id,
+		Status:      bookingRequest.Status,
+		CreatedAt:   server.now(),
+	})
+	if !changesKept(w, server.commitChanges(snapshot, class)) {
+		return
+	}
+	spans.mark("book")
+	logger.Debug("created booking", "id", bookingRequest.Id, "class", class.Id, "status", bookingRequest.Status)
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(newBookingReceipt(class, class.Bookings[len(class.Bookings)-1], server.now()))
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+		return
+	}
+	spans.mark("encode")
 }
 
-type Class struct {
-	Id       string    `json:"id"`
-	Name     string    `json:"name"`
-	Date     time.Time `json:"date"`
-	Capacity int       `json:"capacity"`
-	Bookings []Booking `json:"-"`
+// CancelRequest is the optional body of a booking cancellation, Reason is why the member is cancelling
+type CancelRequest struct {
+	Reason string `json:"reason"`
 }
 
-func (class *Class) addBooking(booking Booking) {
-	class.Bookings = append(class.Bookings, booking)
+// maxCancelReasonLength is the longest reason a booking can be cancelled for
+const maxCancelReasonLength = 200
+
+// classCancelledReason is the reason recorded for bookings cancelled along with their class
+const classCancelledReason = "class cancelled"
+
+// cancelBooking is the handler function for POST requests to `/bookings/{id}/cancel`, it marks the booking as cancelled
+// rather than removing it. If a confirmed spot is freed the longest waiting booking on the class is confirmed. An
+// optional `{"reason": ...}` body is recorded in the class's audit log, see getCancellationReport.
+func (server *Server) cancelBooking(w http.ResponseWriter, r *http.Request) {
+	var reqBody []byte
+	if r.Body != nil {
+		reqBody, _ = ioutil.ReadAll(r.Body)
+	}
+	var cancelRequest CancelRequest
+	if len(bytes.TrimSpace(reqBody)) > 0 {
+		err := json.Unmarshal(reqBody, &cancelRequest)
+		if err != nil {
+			err = errorResponse(w, CodeInvalidJSON, invalidJSON(err), http.StatusBadRequest)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+	}
+	reason := strings.TrimSpace(cancelRequest.Reason)
+	if utf8.RuneCountInString(reason) > maxCancelReasonLength || !printable(reason) {
+		err := errorResponse(w, CodeInvalidCancelReason, InvalidCancelReason, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	server.dbLock.Lock()
+	defer server.dbLock.Unlock()
+	class, booking, err := server.findBookingReference(mux.Vars(r)["id"])
+	if err != nil {
+		err = errorResponse(w, CodeBookingDoesNotExist, BookingDoesNotExist, http.StatusNotFound)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if booking.Status == BookingCancelled {
+		err = errorResponse(w, CodeBookingAlreadyCancelled, BookingAlreadyCancelled, http.StatusConflict)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	cutoff := time.Duration(server.config.CancelCutoffHours) * time.Hour
+	if cutoff > 0 && server.classStart(class).Sub(server.now()) < cutoff {
+		err = errorResponse(w, CodeCancellationTooLate, CancellationTooLate, http.StatusConflict)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	snapshot := server.rollbackPoint()
+	wasConfirmed := booking.Status == BookingConfirmed
+	booking.Status = BookingCancelled
+	cancelled := *booking
+	class.auditReason(AuditCancelled, cancelled, reason, server.now())
+	if wasConfirmed {
+		class.promoteWaitlisted(server.now())
+	}
+	if !changesKept(w, server.commitChanges(snapshot, class)) {
+		return
+	}
+
+	logger.Debug("cancelled booking", "id", cancelled.Id, "class", class.Id)
+	err = json.NewEncoder(w).Encode(cancelled)
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
 }
 
-type ClassRequest struct {
-	Name      string `json:"name"`
-	StartDate string `json:"start_date"`
-	EndDate   string `json:"end_date"`
-	Capacity  int    `json:"capacity"`
+// ClassCancellation is the response to cancelling a class, AffectedBookings counts the confirmed and waitlisted
+// bookings that were released
+type ClassCancellation struct {
+	Id               string `json:"id"`
+	AffectedBookings int    `json:"affected_bookings"`
 }
 
-// createID creates a unique id
-var createID = func() string{
-	return uuid.New().String()
+// reopenClass is the handler function for POST requests to `/classes/{id}/reopen`, it reverses cancelClass so the
+// class can be booked again. The bookings cancelled with the class stay cancelled, members have to book again.
+func (server *Server) reopenClass(w http.ResponseWriter, r *http.Request) {
+	server.dbLock.Lock()
+	defer server.dbLock.Unlock()
+	class, err := server.findClassByID(mux.Vars(r)["id"])
+	if err != nil {
+		err = errorResponse(w, CodeClassDoesNotExists, ClassDoesNotExists, http.StatusNotFound)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if !class.Cancelled {
+		err = errorResponse(w, CodeClassNotCancelled, ClassNotCancelled, http.StatusConflict)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	snapshot := server.rollbackPoint()
+	class.Cancelled = false
+	class.Version++
+	if !changesKept(w, server.commitChanges(snapshot, class)) {
+		return
+	}
+	logger.Debug("reopened class", "id", class.Id)
+	w.Header().Set("ETag", class.etag())
+	err = json.NewEncoder(w).Encode(namedResponse(r, newClassDetail(class, server.now())))
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
 }
 
-type ErrorResponse struct {
-	Err string `json:"error"`
+// deleteClass is the handler function for DELETE requests to `/classes/{id}`, it soft deletes the class so it is kept,
+// bookings and all, but left out of lists and lookups. Fetching it afterwards gives 410 rather than 404.
+func (server *Server) deleteClass(w http.ResponseWriter, r *http.Request) {
+	server.dbLock.Lock()
+	defer server.dbLock.Unlock()
+	class, err := server.findClassByID(mux.Vars(r)["id"])
+	if err == errClassDeleted {
+		err = errorResponse(w, CodeClassDeleted, ClassDeleted, http.StatusGone)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if err != nil {
+		err = errorResponse(w, CodeClassDoesNotExists, ClassDoesNotExists, http.StatusNotFound)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	snapshot := server.rollbackPoint()
+	class.Deleted = true
+	class.Version++
+	if !changesKept(w, server.commitChanges(snapshot, class)) {
+		return
+	}
+	logger.Debug("deleted class", "id", class.Id)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// errorResponse will write an error json constructed from inputs to ResponseWriter
-func errorResponse(w http.ResponseWriter, reason string, statusCode int) error {
-	w.WriteHeader(statusCode)
-	errResponse := ErrorResponse{Err: reason}
-	err := json.NewEncoder(w).Encode(errResponse)
+// cancelClass is the handler function for POST requests to `/classes/{id}/cancel`, it marks the class as cancelled and
+// cancels its confirmed and waitlisted bookings, letting each member know through the notifier
+func (server *Server) cancelClass(w http.ResponseWriter, r *http.Request) {
+	server.dbLock.Lock()
+	defer server.dbLock.Unlock()
+	class, err := server.findClassByID(mux.Vars(r)["id"])
 	if err != nil {
-		return err
+		err = errorResponse(w, CodeClassDoesNotExists, ClassDoesNotExists, http.StatusNotFound)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if class.Cancelled {
+		err = errorResponse(w, CodeClassCancelled, ClassCancelled, http.StatusConflict)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	snapshot := server.rollbackPoint()
+	var affected []Booking
+	for index := range class.Bookings {
+		booking := &class.Bookings[index]
+		if booking.Status == BookingCancelled {
+			continue
+		}
+		booking.Status = BookingCancelled
+		class.auditReason(AuditCancelled, *booking, classCancelledReason, server.now())
+		affected = append(affected, *booking)
+	}
+	class.Cancelled = true
+	class.Version++
+	if !changesKept(w, server.commitChanges(snapshot, class)) {
+		return
+	}
+
+	for _, booking := range affected {
+		server.notifier.Notify(booking.MemberName, fmt.Sprintf("%s on %s has been cancelled", class.Name, class.Date.Format(layoutISO)))
+	}
+	logger.Debug("cancelled class", "id", class.Id, "affected", len(affected))
+	err = json.NewEncoder(w).Encode(ClassCancellation{Id: class.Id, AffectedBookings: len(affected)})
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
 	}
-	return nil
 }
 
-// createClass is the handler function for POST requests to `/classes`, it will parse the request body, validate it and
-// append classes to `DBClasses`. Will append 1 class for each day in the range from start_date to end_date
-func createClass(w http.ResponseWriter, r *http.Request) {
+// TransferRequest is the member a booking should be given to
+type TransferRequest struct {
+	MemberName  string `json:"member_name"`
+	MemberEmail string `json:"member_email,omitempty"`
+}
+
+// transferBooking is the handler function for POST requests to `/bookings/{id}/transfer`, it gives the booking, and
+// its place in the class or waitlist, to another member as long as they aren't already booked into the class
+func (server *Server) transferBooking(w http.ResponseWriter, r *http.Request) {
 	reqBody, _ := ioutil.ReadAll(r.Body)
+	var transferRequest TransferRequest
+	err := json.Unmarshal(reqBody, &transferRequest)
+	if err != nil {
+		err = errorResponse(w, CodeInvalidJSON, invalidJSON(err), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	err = validateMemberName(transferRequest.MemberName)
+	if err == nil {
+		err = validateMemberEmail(transferRequest.MemberEmail)
+	}
+	if err != nil {
+		err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
 
-	var classRequest ClassRequest
-	err := json.Unmarshal(reqBody, &classRequest)
+	server.dbLock.Lock()
+	defer server.dbLock.Unlock()
+	class, booking, err := server.findBookingReference(mux.Vars(r)["id"])
 	if err != nil {
-		err = errorResponse(w, InvalidJSON, http.StatusBadRequest)
+		err = errorResponse(w, CodeBookingDoesNotExist, BookingDoesNotExist, http.StatusNotFound)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if booking.Status == BookingCancelled {
+		err = errorResponse(w, CodeBookingAlreadyCancelled, BookingAlreadyCancelled, http.StatusConflict)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if class.hasActiveBooking(transferRequest.MemberName, transferRequest.MemberEmail) {
+		err = errorResponse(w, CodeMemberAlreadyBooked, MemberAlreadyBooked, http.StatusConflict)
 		if err != nil {
-			fmt.Println(err)
+			logger.Error("failed to write response", "err", err)
 		}
 		return
 	}
 
-	var classes []Class
-	startDate, err := time.Parse(layoutISO, classRequest.StartDate)
+	snapshot := server.rollbackPoint()
+	booking.MemberName = transferRequest.MemberName
+	booking.MemberEmail = transferRequest.MemberEmail
+	class.audit(AuditTransferred, *booking, server.now())
+	if !changesKept(w, server.commitChanges(snapshot, class)) {
+		return
+	}
+
+	logger.Debug("transferred booking", "id", booking.Id, "class", class.Id)
+	err = json.NewEncoder(w).Encode(namedResponse(r, booking))
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// BookingUpdateRequest is the changes to make to a booking
+type BookingUpdateRequest struct {
+	MemberName string `json:"member_name"`
+}
+
+// updateBooking is the handler function for PATCH requests to `/bookings/{id}`, it corrects the member name on the
+// booking in place so it keeps its place in the class or waitlist
+func (server *Server) updateBooking(w http.ResponseWriter, r *http.Request) {
+	reqBody, _ := ioutil.ReadAll(r.Body)
+	var updateRequest BookingUpdateRequest
+	err := json.Unmarshal(reqBody, &updateRequest)
 	if err != nil {
-		err = errorResponse(w, InvalidDate, http.StatusBadRequest)
+		err = errorResponse(w, CodeInvalidJSON, invalidJSON(err), http.StatusBadRequest)
 		if err != nil {
-			fmt.Println(err)
+			logger.Error("failed to write response", "err", err)
 		}
 		return
 	}
-	endDate, err := time.Parse(layoutISO, classRequest.EndDate)
+	err = validateMemberName(updateRequest.MemberName)
 	if err != nil {
-		err = errorResponse(w, InvalidDate, http.StatusBadRequest)
+		err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
 		if err != nil {
-			fmt.Println(err)
+			logger.Error("failed to write response", "err", err)
 		}
 		return
 	}
 
-	for days := 0; days <= int(endDate.Sub(startDate).Hours()/24); days++ {
-		class := Class{
-			Id:       createID(),
-			Name:     classRequest.Name,
-			Date:     startDate.Add(time.Hour * 24 * time.Duration(days)),
-			Capacity: classRequest.Capacity,
+	server.dbLock.Lock()
+	defer server.dbLock.Unlock()
+	class, booking, err := server.findBookingReference(mux.Vars(r)["id"])
+	if err != nil {
+		err = errorResponse(w, CodeBookingDoesNotExist, BookingDoesNotExist, http.StatusNotFound)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if booking.Status == BookingCancelled {
+		err = errorResponse(w, CodeBookingAlreadyCancelled, BookingAlreadyCancelled, http.StatusConflict)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if class.hasOtherActiveBooking(updateRequest.MemberName, booking.MemberEmail, booking.Id) {
+		err = errorResponse(w, CodeMemberAlreadyBooked, MemberAlreadyBooked, http.StatusConflict)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
 		}
-		classes = append(classes, class)
+		return
 	}
-	DBClasses = append(DBClasses, classes...)
 
-	w.WriteHeader(http.StatusCreated)
-	err = json.NewEncoder(w).Encode(classes)
-	if err != nil {
-		fmt.Println(err)
+	snapshot := server.rollbackPoint()
+	booking.MemberName = updateRequest.MemberName
+	class.audit(AuditRenamed, *booking, server.now())
+	if !changesKept(w, server.commitChanges(snapshot, class)) {
 		return
 	}
+
+	logger.Debug("renamed booking", "id", booking.Id, "class", class.Id)
+	err = json.NewEncoder(w).Encode(namedResponse(r, booking))
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
 }
 
-// getClasses is the handler function for GET requests to `/classes`, it will write to ResponseWriter all classes in `DBClasses`
-func getClasses(w http.ResponseWriter, r *http.Request) {
-	err := json.NewEncoder(w).Encode(DBClasses)
+// sortBookings orders bookings by when they were created, oldest first, with ties broken by id so the order is the
+// same however the bookings were stored
+func sortBookings(bookings []Booking) {
+	sort.SliceStable(bookings, func(i, j int) bool {
+		if bookings[i].CreatedAt.Equal(bookings[j].CreatedAt) {
+			return bookings[i].Id < bookings[j].Id
+		}
+		return bookings[i].CreatedAt.Before(bookings[j].CreatedAt)
+	})
+}
+
+// getClassBookings is the handler function for GET requests to `/classes/{id}/bookings`, it will write to
+// ResponseWriter the bookings of the class, optionally only those matching the `status` query parameter. Cancelled
+// bookings are left out unless `include_cancelled=true` or `status=cancelled` is given. Bookings are always in the
+// order they were created, see sortBookings. Fields are camelCase with `naming=camel`.
+func (server *Server) getClassBookings(w http.ResponseWriter, r *http.Request) {
+	server.dbLock.RLock()
+	defer server.dbLock.RUnlock()
+	class, err := server.findClassByID(mux.Vars(r)["id"])
 	if err != nil {
-		err = errorResponse(w, InternalError, http.StatusInternalServerError)
+		err = errorResponse(w, CodeClassDoesNotExists, ClassDoesNotExists, http.StatusNotFound)
 		if err != nil {
-			fmt.Println(err)
+			logger.Error("failed to write response", "err", err)
 		}
+		return
 	}
-}
 
-// createBooking is the handler function for POST requests to `/bookings`, it will parse the request body, validate it
-// and appends a booking to the appropriate class if it exists.
-func createBooking(w http.ResponseWriter, r *http.Request) {
-	reqBody, _ := ioutil.ReadAll(r.Body)
-	var bookingRequest BookingRequest
-	err := json.Unmarshal(reqBody, &bookingRequest)
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", BookingConfirmed, BookingWaitlisted, BookingCancelled:
+	default:
+		err = errorResponse(w, CodeInvalidStatus, InvalidStatus, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	naming, err := parseNaming(r.URL.Query())
 	if err != nil {
-		err = errorResponse(w, InvalidJSON, http.StatusBadRequest)
+		err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
 		if err != nil {
-			fmt.Println(err)
+			logger.Error("failed to write response", "err", err)
 		}
 		return
 	}
 
-	date, err := time.Parse(layoutISO, bookingRequest.Date)
+	includeCancelled := status == BookingCancelled
+	if value := r.URL.Query().Get("include_cancelled"); value != "" {
+		includeCancelled, err = strconv.ParseBool(value)
+		if err != nil {
+			err = errorResponse(w, CodeInvalidBoolean, InvalidBoolean+"include_cancelled", http.StatusBadRequest)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+	}
+
+	bookings := make([]Booking, 0, len(class.Bookings))
+	for _, booking := range class.Bookings {
+		if booking.Status == BookingCancelled && !includeCancelled {
+			continue
+		}
+		if status == "" || booking.Status == status {
+			bookings = append(bookings, booking)
+		}
+	}
+	sortBookings(bookings)
+	logger.Debug("listed class bookings", "class", class.Id, "count", len(bookings))
+	var response interface{} = bookings
+	if naming == namingCamel {
+		response = newCamelBookings(bookings)
+	}
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// getClassAudit is the handler function for GET requests to `/classes/{id}/audit`, it will write to ResponseWriter
+// the audit log of the class, oldest entry first
+func (server *Server) getClassAudit(w http.ResponseWriter, r *http.Request) {
+	server.dbLock.RLock()
+	defer server.dbLock.RUnlock()
+	class, err := server.findClassByID(mux.Vars(r)["id"])
 	if err != nil {
-		err = errorResponse(w, InvalidDate, http.StatusBadRequest)
+		err = errorResponse(w, CodeClassDoesNotExists, ClassDoesNotExists, http.StatusNotFound)
 		if err != nil {
-			fmt.Println(err)
+			logger.Error("failed to write response", "err", err)
 		}
 		return
 	}
 
-	class, err := findClassReference(bookingRequest.ClassName, date)
+	entries := append([]AuditEntry{}, class.Audit...)
+	logger.Debug("listed class audit", "class", class.Id, "count", len(entries))
+	err = json.NewEncoder(w).Encode(entries)
 	if err != nil {
-		err = errorResponse(w, ClassDoesNotExists, http.StatusNotFound)
-		if err != nil {
-			fmt.Println(err)
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// BookingCount is the number of bookings a member has
+type BookingCount struct {
+	Count int `json:"count"`
+}
+
+// getMemberBookingCount is the handler function for GET requests to `/members/{name}/bookings/count`, it will write to
+// ResponseWriter how many confirmed bookings the member has across all classes. An optional `?email=` identifies the
+// member by email as well, see isMember.
+func (server *Server) getMemberBookingCount(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	email := r.URL.Query().Get("email")
+	count := 0
+	server.dbLock.RLock()
+	for _, class := range applyClassFilters(server.DBClasses, nil) {
+		for _, booking := range class.Bookings {
+			if booking.Status == BookingConfirmed && booking.isMember(name, email) {
+				count++
+			}
+		}
+	}
+	server.dbLock.RUnlock()
+
+	logger.Debug("counted member bookings", "member", name, "count", count)
+	err := json.NewEncoder(w).Encode(BookingCount{Count: count})
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// DeletedBookings is the response to deleting a member's bookings, Deleted is how many were removed
+type DeletedBookings struct {
+	Deleted int `json:"deleted"`
+}
+
+// deleteMemberBookings is the handler function for DELETE requests to `/members/{name}/bookings`, it removes every
+// booking the member has across all classes, matching the name case-insensitively, and writes how many were removed to
+// ResponseWriter. Each confirmed spot freed is filled from the class's waitlist.
+func (server *Server) deleteMemberBookings(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	deleted := 0
+	var changed []*Class
+	server.dbLock.Lock()
+	snapshot := server.rollbackPoint()
+	for index := range server.DBClasses {
+		class := &server.DBClasses[index]
+		kept := make([]Booking, 0, len(class.Bookings))
+		freed := 0
+		for _, booking := range class.Bookings {
+			if !booking.isMember(name, "") {
+				kept = append(kept, booking)
+				continue
+			}
+			if booking.Status == BookingConfirmed {
+				freed++
+			}
+			deleted++
+		}
+		if len(kept) == len(class.Bookings) {
+			continue
+		}
+		class.Bookings = kept
+		for ; freed > 0; freed-- {
+			class.promoteWaitlisted(server.now())
 		}
+		changed = append(changed, class)
+	}
+	var err error
+	if deleted > 0 {
+		err = server.commitChanges(snapshot, changed...)
+	}
+	server.dbLock.Unlock()
+	if !changesKept(w, err) {
 		return
 	}
-	bookingRequest.Id = createID()
-	class.addBooking(Booking{bookingRequest.MemberName, bookingRequest.Id})
-	w.WriteHeader(http.StatusCreated)
-	err = json.NewEncoder(w).Encode(bookingRequest)
+
+	logger.Debug("deleted member bookings", "member", name, "deleted", deleted)
+	err = json.NewEncoder(w).Encode(DeletedBookings{Deleted: deleted})
 	if err != nil {
-		fmt.Println(err)
+		logger.Error("failed to write response", "err", err)
 	}
 }
 
-//  handleRequests handles our request routing
-func handleRequests() {
-	myRouter := mux.NewRouter().StrictSlash(true)
-	myRouter.HandleFunc("/classes", createClass).Methods("POST")
-	myRouter.HandleFunc("/classes", getClasses).Methods("GET")
-	myRouter.HandleFunc("/bookings", createBooking).Methods("POST")
-	log.Fatal(http.ListenAndServe(":10000", myRouter))
+// allowMethods returns a handler for OPTIONS requests that advertises the methods a route supports in the Allow header
+func allowMethods(methods ...string) http.HandlerFunc {
+	allow := strings.Join(append(methods, http.MethodOptions), ", ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleRequests serves our routes
+func (server *Server) handleRequests() {
+	log.Fatal(server.newHTTPServer(server.newRouter()).ListenAndServe())
+}
+
+// listenPort is the port the server listens on
+func (server *Server) listenPort() string {
+	if server.config.Port == "" {
+		return defaultPort
+	}
+	return server.config.Port
+}
+
+// apiPrefix is the path the routes are served under, empty when they are served at the root, see versionedRoutes
+func (server *Server) apiPrefix() string {
+	if server.config.APIPrefix == "" {
+		return defaultAPIPrefix
+	}
+	return strings.TrimRight(server.config.APIPrefix, "/")
+}
+
+// newHTTPServer builds the server for our routes with the configured read timeouts, see defaultReadHeaderTimeout
+func (server *Server) newHTTPServer(handler http.Handler) *http.Server {
+	httpServer := &http.Server{
+		Addr:              ":" + server.listenPort(),
+		Handler:           handler,
+		ReadHeaderTimeout: server.config.ReadHeaderTimeout,
+		ReadTimeout:       server.config.ReadTimeout,
+	}
+	if httpServer.ReadHeaderTimeout == 0 {
+		httpServer.ReadHeaderTimeout = defaultReadHeaderTimeout
+	}
+	if httpServer.ReadTimeout == 0 {
+		httpServer.ReadTimeout = defaultReadTimeout
+	}
+	return httpServer
+}
+
+// newRouter handles our request routing, the routes are served under the API prefix so `/v1/classes` by default. A
+// trailing slash is ignored so `/classes/` is served the same as `/classes` rather than redirected and GET responses
+// are indented with `pretty=true`.
+func (server *Server) newRouter() http.Handler {
+	myRouter := mux.NewRouter()
+	myRouter.HandleFunc("/live", live).Methods("GET")
+	myRouter.HandleFunc("/ready", server.readiness).Methods("GET")
+	myRouter.HandleFunc("/metrics", getMetrics).Methods("GET")
+	myRouter.HandleFunc("/classes", requireJSON(server.createClass)).Methods("POST")
+	myRouter.HandleFunc("/classes", server.getClasses).Methods("GET")
+	myRouter.HandleFunc("/classes", allowMethods("GET", "POST")).Methods("OPTIONS")
+	myRouter.HandleFunc("/classes/import", requireContentType("text/csv", server.importClassesCSV)).Methods("POST")
+	myRouter.HandleFunc("/classes/reschedule", requireJSON(server.rescheduleClasses)).Methods("POST")
+	myRouter.HandleFunc("/classes/names", server.getClassNames).Methods("GET")
+	myRouter.HandleFunc("/classes/today", server.getTodaysClasses).Methods("GET")
+	myRouter.HandleFunc("/classes/next", server.getNextClass).Methods("GET")
+	myRouter.HandleFunc("/classes/lookup", server.lookupClass).Methods("GET")
+	myRouter.HandleFunc("/classes/changes", server.getClassChanges).Methods("GET")
+	myRouter.HandleFunc("/classes/stats", server.getClassStats).Methods("GET")
+	myRouter.HandleFunc("/classes/alerts", server.getClassAlerts).Methods("GET")
+	myRouter.HandleFunc("/classes/{id}", server.requireValidClassID(server.getClass)).Methods("GET")
+	myRouter.HandleFunc("/classes/{id}", server.requireValidClassID(requireJSON(server.updateClass))).Methods("PUT", "PATCH")
+	myRouter.HandleFunc("/classes/{id}", server.requireValidClassID(server.deleteClass)).Methods("DELETE")
+	myRouter.HandleFunc("/classes/{id}/bookings", server.requireValidClassID(server.getClassBookings)).Methods("GET")
+	myRouter.HandleFunc("/classes/{id}/audit", server.requireValidClassID(server.getClassAudit)).Methods("GET")
+	myRouter.HandleFunc("/classes/{id}/events", server.requireValidClassID(server.getClassEvents)).Methods("GET")
+	myRouter.HandleFunc("/classes/{id}/cancel", server.requireValidClassID(server.cancelClass)).Methods("POST")
+	myRouter.HandleFunc("/classes/{id}/reopen", server.requireValidClassID(server.reopenClass)).Methods("POST")
+	myRouter.HandleFunc("/classes/{id}/holds", server.requireValidClassID(requireJSON(server.createHold))).Methods("POST")
+	myRouter.HandleFunc("/classes/{id}/reschedule", server.requireValidClassID(requireJSON(server.rescheduleClass))).Methods("POST")
+	myRouter.HandleFunc("/classes/{id}/duplicate", server.requireValidClassID(requireJSON(server.duplicateClass))).Methods("POST")
+	myRouter.HandleFunc("/bookings", requireJSON(server.createBooking)).Methods("POST")
+	myRouter.HandleFunc("/bookings", allowMethods("POST")).Methods("OPTIONS")
+	myRouter.HandleFunc("/bookings.csv", server.exportBookingsCSV).Methods("GET")
+	myRouter.HandleFunc("/bookings/bundle", requireJSON(server.createBundleBooking)).Methods("POST")
+	myRouter.HandleFunc("/bookings/validate", requireJSON(server.validateBooking)).Methods("POST")
+	myRouter.HandleFunc("/bookings/{id}", server.requireValidBookingID(requireJSON(server.updateBooking))).Methods("PATCH")
+	myRouter.HandleFunc("/bookings/{id}/cancel", server.requireValidBookingID(server.cancelBooking)).Methods("POST")
+	myRouter.HandleFunc("/members/{name}/bookings/count", server.getMemberBookingCount).Methods("GET")
+	myRouter.HandleFunc("/members/{name}/bookings", server.deleteMemberBookings).Methods("DELETE")
+	myRouter.HandleFunc("/ws/classes", server.getClassesWebSocket).Methods("GET")
+	myRouter.HandleFunc("/reports/weekly", server.getWeeklyReport).Methods("GET")
+	myRouter.HandleFunc("/reports/cancellations", server.getCancellationReport).Methods("GET")
+	myRouter.HandleFunc("/members/{name}/available", server.getMemberAvailableClasses).Methods("GET")
+	myRouter.HandleFunc("/bookings/{id}/transfer", server.requireValidBookingID(requireJSON(server.transferBooking))).Methods("POST")
+	myRouter.Use(timeHandlers)
+	if server.config.AdminEnabled {
+		myRouter.HandleFunc("/admin/config", server.requireAPIKey(server.getConfig)).Methods("GET")
+		myRouter.HandleFunc("/admin/read-only", server.requireAPIKey(server.getReadOnly)).Methods("GET")
+		myRouter.HandleFunc("/admin/read-only", server.requireAPIKey(requireJSON(server.setReadOnly))).Methods("PUT")
+	}
+	return versionedRoutes(server.apiPrefix(), limitConcurrency(server.maxConcurrentRequests(), server.cors(trimTrailingSlash(server.requireBearerToken(server.rejectWritesWhenReadOnly(prettyJSON(requireKnownNaming(myRouter))))))))
 }
 
 func main() {
-	fmt.Println("Opening Routes:")
-	handleRequests()
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger, err = newLogger(config.LogLevel, config.LogFormat, os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ids, err := newIDGenerator(config.IDStrategy)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	classes := make([]Class, 0)
+	if config.DataFile != "" {
+		classes, err = loadClasses(config.DataFile, config.StrictLoad)
+		if err != nil {
+			log.Fatal(err)
+		}
+		logger.Info("loaded classes", "path", config.DataFile, "count", len(classes))
+		if config.IDStrategy == "sequential" {
+			ids = sequentialIDsAfter(highestSequentialID(classes))
+		}
+	}
+
+	server := NewServer(config, ids)
+	server.DBClasses = classes
+	server.changeSeq = highestChangeSeq(classes)
+	if config.SeedDemo {
+		server.seedDemoData()
+	}
+	go server.sweepHolds(context.Background(), holdSweepInterval)
+
+	server.ready.Store(true)
+	logger.Info("opening routes")
+	server.handleRequests()
 }
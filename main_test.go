@@ -6,19 +6,51 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 )
 
-func init()  {
-	// Force createID to always create an ID of 1 so we can test easier
-	createID = func() string {
-		return "1"
-	}
+// fixedID is an IDGenerator that always returns the same id, so tests can easily find what they created
+type fixedID string
+
+func (id fixedID) NewID() string {
+	return string(id)
+}
+
+// testServer is the Server tests call handlers on, every id it creates is 1
+var testServer = newTestServer()
+
+// testClock is testServer's clock, it is stopped at the start of 2006 so the classes tests create aren't in the past
+func testClock() time.Time {
+	return time.Date(2006, 1, 1, 9, 0, 0, 0, time.UTC)
+}
+
+func newTestServer() *Server {
+	server := NewServer(Config{}, fixedID("1"))
+	server.now = testClock
+	return server
+}
+
+// resetTestServer empties testServer's classes, tests that add classes run it on cleanup so the tests after them start
+// with an empty server
+func resetTestServer() {
+	testServer.DBClasses = []Class{}
+	testServer.markClassesChanged()
 }
 
+// withFrozenTime runs fn with testServer's clock stopped at when, the clock is restored afterwards even if fn fails the test
+func withFrozenTime(t *testing.T, when time.Time, fn func()) {
+	t.Helper()
+	testServer.now = func() time.Time { return when }
+	defer func() { testServer.now = testClock }()
+	fn()
+}
 
 func Test_getClasses(t *testing.T) {
 	t.Run("Get classes when their is zero classes", func(t *testing.T) {
@@ -26,7 +58,7 @@ func Test_getClasses(t *testing.T) {
 		r, _ := http.NewRequest("GET", "/classes", nil)
 		w := httptest.NewRecorder()
 
-		getClasses(w, r)
+		testServer.getClasses(w, r)
 		var response []map[string]string
 		respBody, _ := ioutil.ReadAll(w.Body)
 		json.Unmarshal(respBody, &response)
@@ -38,7 +70,7 @@ func Test_getClasses(t *testing.T) {
 		r, _ := http.NewRequest("GET", "/classes", nil)
 		w := httptest.NewRecorder()
 
-		DBClasses = []Class{
+		testServer.DBClasses = []Class{
 			{
 				Id:       "1",
 				Name:     "class 1",
@@ -55,8 +87,8 @@ func Test_getClasses(t *testing.T) {
 			},
 		}
 		expectedResponse := `[{"id":"1","name":"class 1","date":"2020-12-12T00:00:00Z","capacity":20},` +
-			 				 `{"id":"2","name":"class 2","date":"2020-12-13T00:00:00Z","capacity":10}]` + "\n"
-		getClasses(w, r)
+			`{"id":"2","name":"class 2","date":"2020-12-13T00:00:00Z","capacity":10}]` + "\n"
+		testServer.getClasses(w, r)
 		respBody, _ := ioutil.ReadAll(w.Body)
 
 		assert.Equal(t, expectedResponse, string(respBody))
@@ -64,15 +96,48 @@ func Test_getClasses(t *testing.T) {
 	})
 }
 
+func Test_getClassesCache(t *testing.T) {
+	getBody := func() string {
+		r, _ := http.NewRequest("GET", "/classes", nil)
+		w := httptest.NewRecorder()
+		testServer.getClasses(w, r)
+		respBody, _ := ioutil.ReadAll(w.Body)
+		return string(respBody)
+	}
+
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "class 1", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 20},
+	}
+	testServer.markClassesChanged()
+	expectedResponse := `[{"id":"1","name":"class 1","date":"2020-12-12T00:00:00Z","capacity":20}]` + "\n"
+
+	t.Run("second read without a mutation is served from the cache", func(t *testing.T) {
+		assert.Equal(t, expectedResponse, getBody())
+		assert.Equal(t, expectedResponse, string(testServer.classesCache.body))
+		assert.Equal(t, expectedResponse, getBody())
+	})
+	t.Run("read after a mutation rebuilds the cache", func(t *testing.T) {
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-01", "capacity": 5}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		testServer.createClass(httptest.NewRecorder(), r)
+		assert.Nil(t, testServer.classesCache)
+
+		expectedResponse = `[{"id":"1","name":"class 1","date":"2020-12-12T00:00:00Z","capacity":20},` +
+			`{"id":"1","name":"kayak","date":"2006-01-01T00:00:00Z","capacity":5}]` + "\n"
+		assert.Equal(t, expectedResponse, getBody())
+		assert.Equal(t, expectedResponse, string(testServer.classesCache.body))
+	})
+}
+
 func Test_createClass(t *testing.T) {
 	t.Run("Create a single class", func(t *testing.T) {
-		DBClasses = []Class{}
+		testServer.DBClasses = []Class{}
 		// get fake reader and writer for request
 		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-01", "capacity": 20}`)
 		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
 		w := httptest.NewRecorder()
 
-		createClass(w, r)
+		testServer.createClass(w, r)
 		var response []Class
 		respBody, _ := ioutil.ReadAll(w.Body)
 
@@ -84,14 +149,14 @@ func Test_createClass(t *testing.T) {
 		assert.Equal(t, http.StatusCreated, w.Code)
 	})
 	t.Run("Create a class spanning 5 days", func(t *testing.T) {
-		DBClasses = []Class{}
+		testServer.DBClasses = []Class{}
 
 		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-05", "capacity": 20}`)
 		expectedStartDate, _ := time.Parse(layoutISO, "2006-01-01")
 		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
 		w := httptest.NewRecorder()
 
-		createClass(w, r)
+		testServer.createClass(w, r)
 		var response []Class
 		respBody, _ := ioutil.ReadAll(w.Body)
 		json.Unmarshal(respBody, &response)
@@ -103,28 +168,28 @@ func Test_createClass(t *testing.T) {
 		assert.Equal(t, http.StatusCreated, w.Code)
 	})
 	t.Run("try create class with malformed json request", func(t *testing.T) {
-		DBClasses = []Class{}
+		testServer.DBClasses = []Class{}
 
 		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-05" "capacity": 20}`)
 		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
 		w := httptest.NewRecorder()
 
-		createClass(w, r)
+		testServer.createClass(w, r)
 		var errorResponse ErrorResponse
 		respBody, _ := ioutil.ReadAll(w.Body)
 		json.Unmarshal(respBody, &errorResponse)
 
-		assert.Equal(t, InvalidJSON, errorResponse.Err)
+		assert.Equal(t, InvalidJSON+": invalid JSON at offset 70", errorResponse.Err)
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 	t.Run("try create class with malformed start date request", func(t *testing.T) {
-		DBClasses = []Class{}
+		testServer.DBClasses = []Class{}
 
 		body := []byte(`{"name": "kayak","start_date": "2006-13-12","end_date": "2006-01-05", "capacity": 20}`)
 		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
 		w := httptest.NewRecorder()
 
-		createClass(w, r)
+		testServer.createClass(w, r)
 		var errorResponse ErrorResponse
 		respBody, _ := ioutil.ReadAll(w.Body)
 		json.Unmarshal(respBody, &errorResponse)
@@ -136,8 +201,11 @@ func Test_createClass(t *testing.T) {
 
 func Test_createBooking(t *testing.T) {
 	t.Run("create a booking", func(t *testing.T) {
+		now := time.Date(2020, 12, 1, 9, 0, 0, 0, time.UTC)
+		testServer.now = func() time.Time { return now }
+		defer func() { testServer.now = testClock }()
 		//Adding a class to are pretend DB
-		DBClasses = []Class{
+		testServer.DBClasses = []Class{
 			{
 				Id:       "1",
 				Name:     "lifting",
@@ -151,22 +219,23 @@ func Test_createBooking(t *testing.T) {
 		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(requestBody))
 		w := httptest.NewRecorder()
 
-		createBooking(w, r)
-		expectedRespBody := []byte(`{"id":"1","member_name":"David","class_name":"lifting","date":"2020-12-12"}` + "\n")
+		testServer.createBooking(w, r)
+		expectedRespBody := []byte(`{"id":"1","member_name":"David","class_id":"1","class_name":"lifting","date":"2020-12-12",` +
+			`"status":"confirmed","position":1,"spots_remaining":19}` + "\n")
 		respBody, _ := ioutil.ReadAll(w.Body)
 		assert.Equal(t, string(expectedRespBody), string(respBody))
 		//Make sure the booking is properly append to the correct Class in DBClasses
-		assert.Equal(t, Booking{MemberName: "David", Id: "1"}, DBClasses[0].Bookings[0])
+		assert.Equal(t, Booking{MemberName: "David", Id: "1", Status: BookingConfirmed, CreatedAt: now}, testServer.DBClasses[0].Bookings[0])
 		assert.Equal(t, http.StatusCreated, w.Code)
 	})
 	t.Run("try create a booking for a class that doesn't exist", func(t *testing.T) {
-		DBClasses = []Class{}
+		testServer.DBClasses = []Class{}
 
 		body := []byte(`{"member_name": "David","class_name": "lifting","date": "2020-12-12"}`)
 		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
 		w := httptest.NewRecorder()
 
-		createBooking(w, r)
+		testServer.createBooking(w, r)
 
 		var errorResponse ErrorResponse
 		respBody, _ := ioutil.ReadAll(w.Body)
@@ -176,29 +245,29 @@ func Test_createBooking(t *testing.T) {
 		assert.Equal(t, http.StatusNotFound, w.Code)
 	})
 	t.Run("try create a booking malformed json request", func(t *testing.T) {
-		DBClasses = []Class{}
+		testServer.DBClasses = []Class{}
 
 		body := []byte(`{"member_na "David","class_name": "lifting","date": "2020-12-12"}`)
 		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
 		w := httptest.NewRecorder()
 
-		createBooking(w, r)
+		testServer.createBooking(w, r)
 
 		var errorResponse ErrorResponse
 		respBody, _ := ioutil.ReadAll(w.Body)
 		json.Unmarshal(respBody, &errorResponse)
 
-		assert.Equal(t, InvalidJSON, errorResponse.Err)
+		assert.Equal(t, InvalidJSON+": invalid JSON at offset 14", errorResponse.Err)
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 	t.Run("try create a booking with a malformed date request", func(t *testing.T) {
-		DBClasses = []Class{}
+		testServer.DBClasses = []Class{}
 
 		body := []byte(`{"member_name": "David","class_name": "lifting","date": "2020-12-11222222222222222"}`)
 		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
 		w := httptest.NewRecorder()
 
-		createBooking(w, r)
+		testServer.createBooking(w, r)
 
 		var errorResponse ErrorResponse
 		respBody, _ := ioutil.ReadAll(w.Body)
@@ -209,30 +278,445 @@ func Test_createBooking(t *testing.T) {
 	})
 }
 
+func Test_createBookingWaitlist(t *testing.T) {
+	t.Run("try create a booking for a full class", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{
+				Id:       "1",
+				Name:     "lifting",
+				Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+				Capacity: 1,
+				Bookings: []Booking{{MemberName: "David", Id: "1", Status: BookingConfirmed}},
+			},
+		}
+
+		body := []byte(`{"member_name": "Sarah","class_name": "lifting","date": "2020-12-12"}`)
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createBooking(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, ClassIsFull, errorResponse.Err)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, 1, len(testServer.DBClasses[0].Bookings))
+	})
+	t.Run("create a booking on the waitlist of a full class", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{
+				Id:       "1",
+				Name:     "lifting",
+				Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+				Capacity: 1,
+				Bookings: []Booking{{MemberName: "David", Id: "1", Status: BookingConfirmed}},
+			},
+		}
+
+		body := []byte(`{"member_name": "Sarah","class_name": "lifting","date": "2020-12-12","waitlist": true}`)
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createBooking(w, r)
+
+		var response BookingRequest
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, BookingWaitlisted, response.Status)
+		assert.Equal(t, "Sarah", testServer.DBClasses[0].Bookings[1].MemberName)
+		assert.Equal(t, BookingWaitlisted, testServer.DBClasses[0].Bookings[1].Status)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+}
+
+func Test_createBookingSuggestions(t *testing.T) {
+	t.Run("full class suggests the nearest sessions with space", func(t *testing.T) {
+		full := []Booking{{MemberName: "David", Id: "a", Status: BookingConfirmed}}
+		testServer.DBClasses = []Class{
+			{Id: "1", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 1, Bookings: full},
+			{Id: "2", Name: "lifting", Date: time.Date(2020, 12, 20, 0, 0, 0, 0, time.UTC), Capacity: 5},
+			{Id: "3", Name: "lifting", Date: time.Date(2020, 12, 11, 0, 0, 0, 0, time.UTC), Capacity: 5},
+			{Id: "4", Name: "lifting", Date: time.Date(2020, 12, 13, 0, 0, 0, 0, time.UTC), Capacity: 1, Bookings: full},
+			{Id: "5", Name: "yoga", Date: time.Date(2020, 12, 13, 0, 0, 0, 0, time.UTC), Capacity: 5},
+			{Id: "6", Name: "lifting", Date: time.Date(2020, 12, 14, 0, 0, 0, 0, time.UTC), Capacity: 5},
+			{Id: "7", Name: "lifting", Date: time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC), Capacity: 5},
+		}
+
+		body := []byte(`{"member_name": "Sarah","class_name": "lifting","date": "2020-12-12"}`)
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createBooking(w, r)
+
+		var response ClassFullResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, ClassIsFull, response.Err)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		ids := make([]string, 0)
+		for _, class := range response.Suggestions {
+			ids = append(ids, class.Id)
+		}
+		assert.Equal(t, []string{"3", "6", "2"}, ids)
+	})
+	t.Run("full class doesn't suggest sessions in the past", func(t *testing.T) {
+		full := []Booking{{MemberName: "David", Id: "a", Status: BookingConfirmed}}
+		testServer.DBClasses = []Class{
+			{Id: "1", Name: "lifting", Date: time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC), Capacity: 1, Bookings: full},
+			{Id: "2", Name: "lifting", Date: time.Date(2005, 12, 31, 0, 0, 0, 0, time.UTC), Capacity: 5},
+			{Id: "3", Name: "lifting", Date: time.Date(2006, 1, 5, 0, 0, 0, 0, time.UTC), Capacity: 5},
+		}
+
+		body := []byte(`{"member_name": "Sarah","class_name": "lifting","date": "2006-01-02"}`)
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createBooking(w, r)
+
+		var response ClassFullResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, []string{"3"}, classIDs(response.Suggestions))
+	})
+	t.Run("full class with no alternatives returns empty suggestions", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{
+				Id:       "1",
+				Name:     "lifting",
+				Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+				Capacity: 1,
+				Bookings: []Booking{{MemberName: "David", Id: "a", Status: BookingConfirmed}},
+			},
+		}
+
+		body := []byte(`{"member_name": "Sarah","class_name": "lifting","date": "2020-12-12"}`)
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createBooking(w, r)
+
+		respBody, _ := ioutil.ReadAll(w.Body)
+		assert.Equal(t, `{"error":"`+ClassIsFull+`","code":"class_full","suggestions":[]}`+"\n", string(respBody))
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+}
+
+func Test_cancelBooking(t *testing.T) {
+	t.Run("cancel a booking and promote the waitlist", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{
+				Id:       "1",
+				Name:     "lifting",
+				Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+				Capacity: 1,
+				Bookings: []Booking{
+					{MemberName: "David", Id: "a", Status: BookingConfirmed},
+					{MemberName: "Sarah", Id: "b", Status: BookingWaitlisted},
+				},
+			},
+		}
+
+		r, _ := http.NewRequest("POST", "/bookings/a/cancel", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "a"})
+		w := httptest.NewRecorder()
+
+		testServer.cancelBooking(w, r)
+
+		var response Booking
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, BookingCancelled, response.Status)
+		assert.Equal(t, http.StatusOK, w.Code)
+		// the cancelled booking is kept for history and the waitlisted booking takes the freed spot
+		assert.Equal(t, BookingCancelled, testServer.DBClasses[0].Bookings[0].Status)
+		assert.Equal(t, BookingConfirmed, testServer.DBClasses[0].Bookings[1].Status)
+	})
+	t.Run("try cancel a booking that is already cancelled", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{
+				Id:       "1",
+				Name:     "lifting",
+				Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+				Capacity: 1,
+				Bookings: []Booking{{MemberName: "David", Id: "a", Status: BookingCancelled}},
+			},
+		}
+
+		r, _ := http.NewRequest("POST", "/bookings/a/cancel", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "a"})
+		w := httptest.NewRecorder()
+
+		testServer.cancelBooking(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, BookingAlreadyCancelled, errorResponse.Err)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+	t.Run("try cancel a booking that doesn't exist", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		r, _ := http.NewRequest("POST", "/bookings/a/cancel", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "a"})
+		w := httptest.NewRecorder()
+
+		testServer.cancelBooking(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, BookingDoesNotExist, errorResponse.Err)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func Test_getClassBookings(t *testing.T) {
+	testServer.DBClasses = []Class{
+		{
+			Id:       "1",
+			Name:     "lifting",
+			Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+			Capacity: 1,
+			Bookings: []Booking{
+				{MemberName: "David", Id: "a", Status: BookingCancelled},
+				{MemberName: "Sarah", Id: "b", Status: BookingConfirmed},
+				{MemberName: "Tom", Id: "c", Status: BookingWaitlisted},
+			},
+		},
+	}
+
+	t.Run("get the active bookings for a class", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/classes/1/bookings", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+
+		testServer.getClassBookings(w, r)
+
+		var response []Booking
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, testServer.DBClasses[0].Bookings[1:], response)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	t.Run("get all bookings for a class including cancelled ones", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/classes/1/bookings?include_cancelled=true", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+
+		testServer.getClassBookings(w, r)
+
+		var response []Booking
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, testServer.DBClasses[0].Bookings, response)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	t.Run("get cancelled bookings by status", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/classes/1/bookings?status=cancelled", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+
+		testServer.getClassBookings(w, r)
+
+		var response []Booking
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, []Booking{{MemberName: "David", Id: "a", Status: BookingCancelled}}, response)
+	})
+	t.Run("get bookings for a class filtered by status", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/classes/1/bookings?status=waitlisted", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+
+		testServer.getClassBookings(w, r)
+
+		var response []Booking
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, []Booking{{MemberName: "Tom", Id: "c", Status: BookingWaitlisted}}, response)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	t.Run("try get bookings with an unknown status", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/classes/1/bookings?status=maybe", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+
+		testServer.getClassBookings(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, InvalidStatus, errorResponse.Err)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func Test_getClassBookingsOrder(t *testing.T) {
+	t.Run("bookings are sorted by creation time then id", func(t *testing.T) {
+		at := func(minute int) time.Time {
+			return time.Date(2020, 12, 1, 9, minute, 0, 0, time.UTC)
+		}
+		testServer.DBClasses = []Class{
+			{
+				Id:       "1",
+				Name:     "lifting",
+				Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+				Capacity: 5,
+				Bookings: []Booking{
+					{MemberName: "Tom", Id: "d", Status: BookingConfirmed, CreatedAt: at(30)},
+					{MemberName: "Anna", Id: "c", Status: BookingWaitlisted, CreatedAt: at(10)},
+					{MemberName: "David", Id: "b", Status: BookingConfirmed, CreatedAt: at(10)},
+					{MemberName: "Sarah", Id: "a", Status: BookingCancelled, CreatedAt: at(20)},
+				},
+			},
+		}
+
+		r, _ := http.NewRequest("GET", "/classes/1/bookings?include_cancelled=true", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+
+		testServer.getClassBookings(w, r)
+
+		var response []Booking
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		ids := make([]string, 0)
+		for _, booking := range response {
+			ids = append(ids, booking.Id)
+		}
+		assert.Equal(t, []string{"b", "c", "a", "d"}, ids)
+		// the stored order is left alone
+		assert.Equal(t, "d", testServer.DBClasses[0].Bookings[0].Id)
+	})
+}
+
 func Test_errorResponse(t *testing.T) {
 	t.Run("test error message and response code are correct", func(t *testing.T) {
 		w := httptest.NewRecorder()
 
 		givenReason := "reason a"
+		givenCode := "code_a"
 		httpErrorCode := http.StatusTeapot
-		errorResponse(w, givenReason, httpErrorCode)
+		errorResponse(w, givenCode, givenReason, httpErrorCode)
 
 		var errorResponse ErrorResponse
 		respBody, _ := ioutil.ReadAll(w.Body)
 		json.Unmarshal(respBody, &errorResponse)
 
 		assert.Equal(t, givenReason, errorResponse.Err)
+		assert.Equal(t, givenCode, errorResponse.Code)
 		assert.Equal(t, httpErrorCode, w.Code)
 	})
+	t.Run("invalid date is reported with its code", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+		body := []byte(`{"name": "kayak","start_date": "2006-13-12","end_date": "2006-01-05", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createClass(w, r)
+
+		respBody, _ := ioutil.ReadAll(w.Body)
+		assert.Equal(t, `{"error":"`+InvalidDate+`","code":"invalid_date"}`+"\n", string(respBody))
+	})
+	t.Run("unknown class is reported with its code", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+		body := []byte(`{"member_name": "David","class_name": "lifting","date": "2020-12-12"}`)
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createBooking(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, ClassDoesNotExists, errorResponse.Err)
+		assert.Equal(t, "class_not_found", errorResponse.Code)
+	})
+	t.Run("validation errors from filters keep their code", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/classes?day_of_week=Funday", nil)
+		w := httptest.NewRecorder()
+
+		testServer.getClasses(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, InvalidDayOfWeek, errorResponse.Err)
+		assert.Equal(t, "invalid_day_of_week", errorResponse.Code)
+	})
 }
 
 func Test_getClass(t *testing.T) {
+	t.Run("get a class with its version as an ETag", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{Id: "1", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 20, Version: 3},
+		}
+		r, _ := http.NewRequest("GET", "/classes/1", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+
+		testServer.getClass(w, r)
+
+		var response Class
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, "lifting", response.Name)
+		assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	t.Run("get a full class with its booking counts", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{
+				Id:       "1",
+				Name:     "lifting",
+				Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+				Capacity: 2,
+				Bookings: []Booking{
+					{MemberName: "David", Id: "a", Status: BookingConfirmed},
+					{MemberName: "Sarah", Id: "b", Status: BookingCancelled},
+					{MemberName: "Tom", Id: "c", Status: BookingConfirmed},
+					{MemberName: "Anna", Id: "d", Status: BookingWaitlisted},
+					{MemberName: "Mark", Id: "e", Status: BookingWaitlisted},
+				},
+			},
+		}
+		r, _ := http.NewRequest("GET", "/classes/1", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+
+		testServer.getClass(w, r)
+
+		expectedResponse := `{"id":"1","name":"lifting","date":"2020-12-12T00:00:00Z","capacity":2,` +
+			`"booked":2,"waitlisted":2,"held":0,"spots_available":0}` + "\n"
+		respBody, _ := ioutil.ReadAll(w.Body)
+		assert.Equal(t, expectedResponse, string(respBody))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
 	t.Run("malformed date request", func(t *testing.T) {
 		w := httptest.NewRecorder()
 
 		givenReason := "reason a"
+		givenCode := "code_a"
 		httpErrorCode := http.StatusTeapot
-		errorResponse(w, givenReason, httpErrorCode)
+		errorResponse(w, givenCode, givenReason, httpErrorCode)
 
 		var errorResponse ErrorResponse
 		respBody, _ := ioutil.ReadAll(w.Body)
@@ -242,3 +726,2443 @@ func Test_getClass(t *testing.T) {
 		assert.Equal(t, httpErrorCode, w.Code)
 	})
 }
+
+func Test_updateClass(t *testing.T) {
+	t.Run("update a class with a matching version", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{Id: "1", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 20, Version: 1},
+		}
+		body := []byte(`{"capacity": 25}`)
+		r, _ := http.NewRequest("PATCH", "/classes/1", bytes.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		r.Header.Set("If-Match", `"1"`)
+		w := httptest.NewRecorder()
+
+		testServer.updateClass(w, r)
+
+		var response Class
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, 25, response.Capacity)
+		assert.Equal(t, "lifting", response.Name)
+		assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+		assert.Equal(t, 2, testServer.DBClasses[0].Version)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	t.Run("try update a class with a stale version", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{Id: "1", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 20, Version: 2},
+		}
+		body := []byte(`{"capacity": 25}`)
+		r, _ := http.NewRequest("PUT", "/classes/1", bytes.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		r.Header.Set("If-Match", `"1"`)
+		w := httptest.NewRecorder()
+
+		testServer.updateClass(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, VersionMismatch, errorResponse.Err)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		assert.Equal(t, 20, testServer.DBClasses[0].Capacity)
+		assert.Equal(t, 2, testServer.DBClasses[0].Version)
+	})
+	t.Run("try update a class without an If-Match header", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{Id: "1", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 20, Version: 1},
+		}
+		body := []byte(`{"capacity": 25}`)
+		r, _ := http.NewRequest("PATCH", "/classes/1", bytes.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+
+		testServer.updateClass(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, MissingIfMatch, errorResponse.Err)
+		assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+	})
+}
+
+func Test_importClassesCSV(t *testing.T) {
+	t.Run("import several valid rows", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		body := "name,date,capacity\nkayak,2021-01-01,10\nyoga,2021-01-02,15\n"
+		r, _ := http.NewRequest("POST", "/classes/import", bytes.NewReader([]byte(body)))
+		r.Header.Set("Content-Type", "text/csv")
+		w := httptest.NewRecorder()
+
+		testServer.importClassesCSV(w, r)
+
+		var response []ImportResult
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 2, len(response))
+		assert.Equal(t, "created", response[0].Status)
+		assert.Equal(t, "created", response[1].Status)
+		assert.Equal(t, 2, len(testServer.DBClasses))
+		assert.Equal(t, "yoga", testServer.DBClasses[1].Name)
+		assert.Equal(t, time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC), testServer.DBClasses[1].Date)
+		assert.Equal(t, 15, testServer.DBClasses[1].Capacity)
+	})
+	t.Run("import a bad row among good rows", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		body := "kayak,2021-01-01,10\nyoga,2021-13-02,15\nlifting,2021-01-03,20\n"
+		r, _ := http.NewRequest("POST", "/classes/import", bytes.NewReader([]byte(body)))
+		r.Header.Set("Content-Type", "text/csv")
+		w := httptest.NewRecorder()
+
+		testServer.importClassesCSV(w, r)
+
+		var response []ImportResult
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 3, len(response))
+		assert.Equal(t, "created", response[0].Status)
+		assert.Equal(t, ImportResult{Row: 2, Status: "error", Err: InvalidDate, Code: CodeInvalidDate}, response[1])
+		assert.Equal(t, "created", response[2].Status)
+		assert.Equal(t, 2, len(testServer.DBClasses))
+	})
+	t.Run("import rows that duplicate a class or are in the past", func(t *testing.T) {
+		testServer.DBClasses = []Class{{Id: "existing", Name: "kayak", Date: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), Capacity: 10}}
+
+		body := "kayak,2021-01-01,10\nyoga,2005-12-31,15\nlifting,2021-01-03,20\nlifting,2021-01-03,20\n"
+		r, _ := http.NewRequest("POST", "/classes/import", bytes.NewReader([]byte(body)))
+		r.Header.Set("Content-Type", "text/csv")
+		w := httptest.NewRecorder()
+
+		testServer.importClassesCSV(w, r)
+
+		var response []ImportResult
+		json.Unmarshal(w.Body.Bytes(), &response)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 4, len(response))
+		assert.Equal(t, ImportResult{Row: 1, Status: "error", Err: ClassAlreadyExists, Code: CodeClassAlreadyExists}, response[0])
+		assert.Equal(t, ImportResult{Row: 2, Status: "error", Err: ClassInPast, Code: CodeClassInPast}, response[1])
+		assert.Equal(t, "created", response[2].Status)
+		assert.Equal(t, ImportResult{Row: 4, Status: "error", Err: ClassAlreadyExists, Code: CodeClassAlreadyExists}, response[3])
+		assert.Equal(t, 2, len(testServer.DBClasses))
+	})
+}
+
+func Test_duplicateClass(t *testing.T) {
+	t.Run("duplicate a class across three days", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{
+				Id:       "source",
+				Name:     "lifting",
+				Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+				Capacity: 12,
+				Bookings: []Booking{{MemberName: "David", Id: "a", Status: BookingConfirmed}},
+				Version:  4,
+			},
+		}
+
+		body := []byte(`{"start_date": "2021-01-01","end_date": "2021-01-03"}`)
+		r, _ := http.NewRequest("POST", "/classes/source/duplicate", bytes.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"id": "source"})
+		w := httptest.NewRecorder()
+
+		testServer.duplicateClass(w, r)
+
+		var response []Class
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 3, len(response))
+		for days, class := range response {
+			assert.Equal(t, "lifting", class.Name)
+			assert.Equal(t, 12, class.Capacity)
+			assert.Equal(t, time.Date(2021, 1, 1+days, 0, 0, 0, 0, time.UTC), class.Date)
+		}
+		assert.Equal(t, 4, len(testServer.DBClasses))
+		assert.Equal(t, 0, len(testServer.DBClasses[1].Bookings))
+		assert.Equal(t, 1, testServer.DBClasses[1].Version)
+	})
+	t.Run("duplicate a cancelled class", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{Id: "source", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 12, Cancelled: true},
+		}
+
+		body := []byte(`{"start_date": "2021-01-01","end_date": "2021-01-01"}`)
+		r, _ := http.NewRequest("POST", "/classes/source/duplicate", bytes.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"id": "source"})
+		w := httptest.NewRecorder()
+
+		testServer.duplicateClass(w, r)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 2, len(testServer.DBClasses))
+		assert.True(t, testServer.DBClasses[0].Cancelled)
+		assert.False(t, testServer.DBClasses[1].Cancelled)
+	})
+	t.Run("try duplicate a class with a malformed date", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{Id: "source", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 12},
+		}
+
+		body := []byte(`{"start_date": "2021-01-01","end_date": "2021-01-32"}`)
+		r, _ := http.NewRequest("POST", "/classes/source/duplicate", bytes.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"id": "source"})
+		w := httptest.NewRecorder()
+
+		testServer.duplicateClass(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, InvalidDate, errorResponse.Err)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, 1, len(testServer.DBClasses))
+	})
+	t.Run("try duplicate a class onto more days than allowed", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{Id: "source", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 12},
+		}
+
+		body := []byte(`{"start_date": "2021-01-01","end_date": "2022-12-31"}`)
+		r, _ := http.NewRequest("POST", "/classes/source/duplicate", bytes.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"id": "source"})
+		w := httptest.NewRecorder()
+
+		testServer.duplicateClass(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, CodeTooManyClasses, errorResponse.Code)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, 1, len(testServer.DBClasses))
+	})
+}
+
+func Test_createClassCatalog(t *testing.T) {
+	createWithName := func(name string) *httptest.ResponseRecorder {
+		body := []byte(`{"name": "` + name + `","start_date": "2006-01-01","end_date": "2006-01-01", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createClass(w, r)
+		return w
+	}
+	defer func() { testServer.config.ClassCatalog = nil }()
+
+	t.Run("create a class in the catalog matching case-insensitively", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+		testServer.config.ClassCatalog = []string{"Kayak", "Yoga"}
+
+		w := createWithName("kayak")
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 1, len(testServer.DBClasses))
+	})
+	t.Run("try create a class that isn't in the catalog", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+		testServer.config.ClassCatalog = []string{"Kayak", "Yoga"}
+
+		w := createWithName("lifting")
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, UnknownClassName, errorResponse.Err)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses))
+	})
+	t.Run("any name is allowed without a catalog", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+		testServer.config.ClassCatalog = nil
+
+		w := createWithName("lifting")
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 1, len(testServer.DBClasses))
+	})
+	t.Run("try create a class with an empty name", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+		testServer.config.ClassCatalog = nil
+
+		w := createWithName(" ")
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, MissingClassName, errorResponse.Err)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func Test_cancelBookingCutoff(t *testing.T) {
+	testServer.config.CancelCutoffHours = 24
+	testServer.now = func() time.Time {
+		return time.Date(2020, 12, 10, 12, 0, 0, 0, time.UTC)
+	}
+	defer func() {
+		testServer.config.CancelCutoffHours = 0
+		testServer.now = testClock
+	}()
+
+	cancel := func(classDate time.Time) *httptest.ResponseRecorder {
+		testServer.DBClasses = []Class{
+			{
+				Id:       "1",
+				Name:     "lifting",
+				Date:     classDate,
+				Capacity: 1,
+				Bookings: []Booking{{MemberName: "David", Id: "a", Status: BookingConfirmed}},
+			},
+		}
+		r, _ := http.NewRequest("POST", "/bookings/a/cancel", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "a"})
+		w := httptest.NewRecorder()
+		testServer.cancelBooking(w, r)
+		return w
+	}
+
+	t.Run("cancel a booking well ahead of the class", func(t *testing.T) {
+		w := cancel(time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, BookingCancelled, testServer.DBClasses[0].Bookings[0].Status)
+	})
+	t.Run("try cancel a booking inside the cutoff", func(t *testing.T) {
+		w := cancel(time.Date(2020, 12, 11, 0, 0, 0, 0, time.UTC))
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, CancellationTooLate, errorResponse.Err)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, BookingConfirmed, testServer.DBClasses[0].Bookings[0].Status)
+	})
+}
+
+func Test_newIDGenerator(t *testing.T) {
+	t.Run("sequential strategy creates increasing ids", func(t *testing.T) {
+		ids, err := newIDGenerator("sequential")
+		assert.Nil(t, err)
+
+		assert.Equal(t, "1", ids.NewID())
+		assert.Equal(t, "2", ids.NewID())
+		assert.Equal(t, "3", ids.NewID())
+	})
+	t.Run("uuid strategy creates parseable uuids", func(t *testing.T) {
+		ids, err := newIDGenerator("uuid")
+		assert.Nil(t, err)
+
+		first, second := ids.NewID(), ids.NewID()
+		_, err = uuid.Parse(first)
+		assert.Nil(t, err)
+		_, err = uuid.Parse(second)
+		assert.Nil(t, err)
+		assert.NotEqual(t, first, second)
+	})
+	t.Run("unknown strategy is rejected", func(t *testing.T) {
+		_, err := newIDGenerator("random")
+		assert.NotNil(t, err)
+	})
+}
+
+func Test_transferBooking(t *testing.T) {
+	transfer := func(body string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("POST", "/bookings/a/transfer", bytes.NewReader([]byte(body)))
+		r = mux.SetURLVars(r, map[string]string{"id": "a"})
+		w := httptest.NewRecorder()
+		testServer.transferBooking(w, r)
+		return w
+	}
+	resetClasses := func() {
+		testServer.DBClasses = []Class{
+			{
+				Id:       "1",
+				Name:     "lifting",
+				Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+				Capacity: 5,
+				Bookings: []Booking{
+					{MemberName: "David", Id: "a", Status: BookingConfirmed},
+					{MemberName: "Sarah", Id: "b", Status: BookingConfirmed},
+				},
+			},
+		}
+	}
+
+	t.Run("transfer a booking to another member", func(t *testing.T) {
+		resetClasses()
+
+		w := transfer(`{"member_name": "Tom"}`)
+
+		var response Booking
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, Booking{MemberName: "Tom", Id: "a", Status: BookingConfirmed}, response)
+		assert.Equal(t, "Tom", testServer.DBClasses[0].Bookings[0].MemberName)
+	})
+	t.Run("try transfer a booking to a member already booked", func(t *testing.T) {
+		resetClasses()
+
+		w := transfer(`{"member_name": "sarah"}`)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, MemberAlreadyBooked, errorResponse.Err)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, "David", testServer.DBClasses[0].Bookings[0].MemberName)
+	})
+	t.Run("try transfer a booking that doesn't exist", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		w := transfer(`{"member_name": "Tom"}`)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func Test_createBookingDuplicate(t *testing.T) {
+	t.Run("try book a member into a class twice", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{
+				Id:       "1",
+				Name:     "lifting",
+				Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+				Capacity: 5,
+				Bookings: []Booking{{MemberName: "David", Id: "a", Status: BookingConfirmed}},
+			},
+		}
+
+		body := []byte(`{"member_name": "David","class_name": "lifting","date": "2020-12-12"}`)
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createBooking(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, MemberAlreadyBooked, errorResponse.Err)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, 1, len(testServer.DBClasses[0].Bookings))
+	})
+}
+
+func Test_createBookingMaxWaitlist(t *testing.T) {
+	book := func(member string, maxWaitlist int) *httptest.ResponseRecorder {
+		testServer.DBClasses[0].MaxWaitlist = &maxWaitlist
+		body := []byte(`{"member_name": "` + member + `","class_name": "lifting","date": "2020-12-12","waitlist": true}`)
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createBooking(w, r)
+		return w
+	}
+	resetClasses := func() {
+		testServer.DBClasses = []Class{
+			{
+				Id:       "1",
+				Name:     "lifting",
+				Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+				Capacity: 1,
+				Bookings: []Booking{{MemberName: "David", Id: "a", Status: BookingConfirmed}},
+			},
+		}
+	}
+
+	t.Run("waitlist up to the limit then reject", func(t *testing.T) {
+		resetClasses()
+
+		assert.Equal(t, http.StatusCreated, book("Sarah", 2).Code)
+		assert.Equal(t, http.StatusCreated, book("Tom", 2).Code)
+		w := book("Anna", 2)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, WaitlistFull, errorResponse.Err)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, 2, testServer.DBClasses[0].countBookings(BookingWaitlisted))
+	})
+	t.Run("a class without a waitlist rejects as soon as it is full", func(t *testing.T) {
+		resetClasses()
+
+		w := book("Sarah", 0)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, ClassIsFull, errorResponse.Err)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, 0, testServer.DBClasses[0].countBookings(BookingWaitlisted))
+	})
+	t.Run("new classes take the configured default", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+		maxWaitlist := 3
+		testServer.config.MaxWaitlist = &maxWaitlist
+		defer func() { testServer.config.MaxWaitlist = nil }()
+
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-01", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		testServer.createClass(httptest.NewRecorder(), r)
+
+		assert.Equal(t, 3, *testServer.DBClasses[0].MaxWaitlist)
+	})
+}
+
+func Test_createClassOverlap(t *testing.T) {
+	createOverlapping := func(query string) *httptest.ResponseRecorder {
+		testServer.DBClasses = []Class{}
+		for day := 1; day <= 5; day++ {
+			testServer.DBClasses = append(testServer.DBClasses, Class{
+				Id:       "existing",
+				Name:     "kayak",
+				Date:     time.Date(2006, 1, day, 0, 0, 0, 0, time.UTC),
+				Capacity: 20,
+			})
+		}
+		body := []byte(`{"name": "kayak","start_date": "2006-01-03","end_date": "2006-01-07", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes"+query, bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createClass(w, r)
+		return w
+	}
+
+	t.Run("overlapping range is rejected by default", func(t *testing.T) {
+		w := createOverlapping("")
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, ClassAlreadyExists, errorResponse.Err)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, 5, len(testServer.DBClasses))
+	})
+	t.Run("overlapping days are skipped with on_conflict=skip", func(t *testing.T) {
+		w := createOverlapping("?on_conflict=skip")
+
+		var response []Class
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 2, len(response))
+		assert.Equal(t, time.Date(2006, 1, 6, 0, 0, 0, 0, time.UTC), response[0].Date)
+		assert.Equal(t, time.Date(2006, 1, 7, 0, 0, 0, 0, time.UTC), response[1].Date)
+		assert.Equal(t, 7, len(testServer.DBClasses))
+	})
+	t.Run("try create with an unknown conflict mode", func(t *testing.T) {
+		w := createOverlapping("?on_conflict=merge")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, 5, len(testServer.DBClasses))
+	})
+}
+
+func Test_getClassNames(t *testing.T) {
+	getNames := func() (*httptest.ResponseRecorder, []string) {
+		r, _ := http.NewRequest("GET", "/classes/names", nil)
+		w := httptest.NewRecorder()
+		testServer.getClassNames(w, r)
+
+		var response []string
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+		return w, response
+	}
+
+	t.Run("names repeated across dates are listed once", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{Id: "1", Name: "Yoga", Date: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{Id: "2", Name: "kayak", Date: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{Id: "3", Name: "yoga", Date: time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)},
+			{Id: "4", Name: "Boxing", Date: time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)},
+			{Id: "5", Name: "kayak", Date: time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC)},
+		}
+
+		w, response := getNames()
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"Boxing", "kayak", "Yoga"}, response)
+	})
+	t.Run("no classes gives an empty list", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		w, response := getNames()
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{}, response)
+	})
+}
+
+func Test_createBookingWait(t *testing.T) {
+	resetClasses := func() {
+		testServer.DBClasses = []Class{
+			{
+				Id:       "1",
+				Name:     "lifting",
+				Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+				Capacity: 1,
+				Bookings: []Booking{{MemberName: "David", Id: "a", Status: BookingConfirmed}},
+			},
+		}
+	}
+	book := func(query string) *httptest.ResponseRecorder {
+		body := []byte(`{"member_name": "Sarah","class_name": "lifting","date": "2020-12-12"}`)
+		r, _ := http.NewRequest("POST", "/bookings"+query, bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createBooking(w, r)
+		return w
+	}
+	bookingWaitPollInterval = 5 * time.Millisecond
+	defer func() { bookingWaitPollInterval = 50 * time.Millisecond }()
+
+	t.Run("a cancellation during the wait frees a spot", func(t *testing.T) {
+		resetClasses()
+		go func() {
+			time.Sleep(30 * time.Millisecond)
+			r, _ := http.NewRequest("POST", "/bookings/a/cancel", nil)
+			r = mux.SetURLVars(r, map[string]string{"id": "a"})
+			testServer.cancelBooking(httptest.NewRecorder(), r)
+		}()
+
+		w := book("?wait=2s")
+
+		var response BookingRequest
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, BookingConfirmed, response.Status)
+	})
+	t.Run("give up when no spot frees in time", func(t *testing.T) {
+		resetClasses()
+
+		w := book("?wait=20ms")
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, 1, len(testServer.DBClasses[0].Bookings))
+	})
+	t.Run("wait is capped at the configured maximum", func(t *testing.T) {
+		testServer.config.MaxBookingWait = time.Second
+		defer func() { testServer.config.MaxBookingWait = 0 }()
+
+		wait, err := testServer.parseBookingWait("1h")
+
+		assert.Nil(t, err)
+		assert.Equal(t, time.Second, wait)
+	})
+	t.Run("try book with a malformed wait", func(t *testing.T) {
+		resetClasses()
+
+		w := book("?wait=soon")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func Test_classAudit(t *testing.T) {
+	now := time.Date(2020, 12, 1, 9, 0, 0, 0, time.UTC)
+	testServer.now = func() time.Time { return now }
+	defer func() { testServer.now = testClock }()
+	testServer.DBClasses = []Class{
+		{
+			Id:       "1",
+			Name:     "lifting",
+			Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+			Capacity: 20,
+		},
+	}
+
+	t.Run("creating a booking is audited", func(t *testing.T) {
+		requestBody := []byte(`{"member_name":"David","class_name":"lifting","date":"2020-12-12"}`)
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(requestBody))
+		w := httptest.NewRecorder()
+
+		testServer.createBooking(w, r)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, []AuditEntry{
+			{Timestamp: now, Action: AuditBooked, MemberName: "David", BookingId: "1"},
+		}, testServer.DBClasses[0].Audit)
+	})
+	t.Run("cancelling a booking is audited", func(t *testing.T) {
+		now = now.Add(time.Hour)
+		r, _ := http.NewRequest("POST", "/bookings/1/cancel", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+
+		testServer.cancelBooking(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, testServer.DBClasses[0].Audit, 2)
+		assert.Equal(t, AuditEntry{Timestamp: now, Action: AuditCancelled, MemberName: "David", BookingId: "1"}, testServer.DBClasses[0].Audit[1])
+	})
+	t.Run("get the audit log of a class", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/classes/1/audit", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+
+		testServer.getClassAudit(w, r)
+
+		var response []AuditEntry
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{AuditBooked, AuditCancelled}, []string{response[0].Action, response[1].Action})
+	})
+	t.Run("try get the audit log of a class that doesn't exist", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/classes/2/audit", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "2"})
+		w := httptest.NewRecorder()
+
+		testServer.getClassAudit(w, r)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func Test_createClassOpenEnded(t *testing.T) {
+	t.Run("omitted end date creates the configured number of days", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+		testServer.config.DefaultRangeDays = 7
+		defer func() { testServer.config.DefaultRangeDays = 0 }()
+
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createClass(w, r)
+		var response []Class
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 7, len(response))
+		assert.Equal(t, time.Date(2006, 1, 1, 0, 0, 0, 0, time.UTC), response[0].Date)
+		assert.Equal(t, time.Date(2006, 1, 7, 0, 0, 0, 0, time.UTC), response[6].Date)
+	})
+	t.Run("omitted end date without configuration uses the default", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createClass(w, r)
+		var response []Class
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, defaultRangeDays, len(response))
+	})
+	t.Run("explicit end date ignores the configured number of days", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+		testServer.config.DefaultRangeDays = 7
+		defer func() { testServer.config.DefaultRangeDays = 0 }()
+
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-03", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createClass(w, r)
+		var response []Class
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 3, len(response))
+	})
+}
+
+func Test_allowMethods(t *testing.T) {
+	t.Run("options on /classes", func(t *testing.T) {
+		r, _ := http.NewRequest("OPTIONS", "/classes", nil)
+		w := httptest.NewRecorder()
+
+		allowMethods("GET", "POST")(w, r)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "GET, POST, OPTIONS", w.Header().Get("Allow"))
+	})
+	t.Run("options on /bookings", func(t *testing.T) {
+		r, _ := http.NewRequest("OPTIONS", "/bookings", nil)
+		w := httptest.NewRecorder()
+
+		allowMethods("POST")(w, r)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "POST, OPTIONS", w.Header().Get("Allow"))
+	})
+}
+
+func Test_updateClassCapacity(t *testing.T) {
+	newClass := func(maxWaitlist *int) []Class {
+		return []Class{
+			{
+				Id:          "1",
+				Name:        "lifting",
+				Date:        time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+				Capacity:    3,
+				Version:     1,
+				MaxWaitlist: maxWaitlist,
+				Bookings: []Booking{
+					{MemberName: "David", Id: "a", Status: BookingConfirmed},
+					{MemberName: "Sarah", Id: "b", Status: BookingConfirmed},
+					{MemberName: "Tom", Id: "c", Status: BookingConfirmed},
+					{MemberName: "Priya", Id: "d", Status: BookingWaitlisted},
+				},
+			},
+		}
+	}
+	updateCapacity := func(capacity string) *httptest.ResponseRecorder {
+		body := []byte(`{"capacity": ` + capacity + `}`)
+		r, _ := http.NewRequest("PATCH", "/classes/1", bytes.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		r.Header.Set("If-Match", `"1"`)
+		w := httptest.NewRecorder()
+		testServer.updateClass(w, r)
+		return w
+	}
+	statuses := func() []string {
+		var statuses []string
+		for _, booking := range testServer.DBClasses[0].Bookings {
+			statuses = append(statuses, booking.Status)
+		}
+		return statuses
+	}
+
+	t.Run("shrinking capacity moves the most recent bookings to the waitlist", func(t *testing.T) {
+		testServer.DBClasses = newClass(nil)
+
+		w := updateCapacity("1")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{BookingConfirmed, BookingWaitlisted, BookingWaitlisted, BookingWaitlisted}, statuses())
+		assert.Equal(t, AuditDemoted, testServer.DBClasses[0].Audit[0].Action)
+		assert.Equal(t, "c", testServer.DBClasses[0].Audit[0].BookingId)
+	})
+	t.Run("try shrink capacity when the waitlist is disabled", func(t *testing.T) {
+		noWaitlist := 0
+		testServer.DBClasses = newClass(&noWaitlist)
+
+		w := updateCapacity("2")
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, CapacityBelowBookings, errorResponse.Err)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, 3, testServer.DBClasses[0].Capacity)
+		assert.Equal(t, []string{BookingConfirmed, BookingConfirmed, BookingConfirmed, BookingWaitlisted}, statuses())
+	})
+	t.Run("try shrink capacity when the waitlist has no room for the excess", func(t *testing.T) {
+		maxWaitlist := 2
+		testServer.DBClasses = newClass(&maxWaitlist)
+
+		w := updateCapacity("1")
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, 1, testServer.DBClasses[0].Version)
+	})
+	t.Run("growing capacity promotes waitlisted bookings", func(t *testing.T) {
+		testServer.DBClasses = newClass(nil)
+
+		w := updateCapacity("5")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{BookingConfirmed, BookingConfirmed, BookingConfirmed, BookingConfirmed}, statuses())
+	})
+	t.Run("try update capacity to a negative number", func(t *testing.T) {
+		testServer.DBClasses = newClass(nil)
+
+		w := updateCapacity("-5")
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, CodeInvalidCapacity, errorResponse.Code)
+		assert.Equal(t, 3, testServer.DBClasses[0].Capacity)
+		assert.Equal(t, 1, testServer.DBClasses[0].Version)
+	})
+}
+
+// recordingNotifier keeps the members it was asked to notify
+type recordingNotifier struct {
+	members []string
+}
+
+func (n *recordingNotifier) Notify(memberName, message string) {
+	n.members = append(n.members, memberName)
+}
+
+func Test_cancelClass(t *testing.T) {
+	newClasses := func() []Class {
+		return []Class{
+			{
+				Id:       "1",
+				Name:     "kayak",
+				Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+				Capacity: 2,
+				Version:  1,
+				Bookings: []Booking{
+					{MemberName: "David", Id: "a", Status: BookingConfirmed},
+					{MemberName: "Sarah", Id: "b", Status: BookingCancelled},
+					{MemberName: "Tom", Id: "c", Status: BookingConfirmed},
+					{MemberName: "Priya", Id: "d", Status: BookingWaitlisted},
+				},
+			},
+		}
+	}
+	cancel := func() *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("POST", "/classes/1/cancel", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+		testServer.cancelClass(w, r)
+		return w
+	}
+
+	t.Run("cancel a class and release its bookings", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+		recorder := &recordingNotifier{}
+		testServer.notifier = recorder
+		defer func() { testServer.notifier = logNotifier{} }()
+
+		w := cancel()
+
+		var response ClassCancellation
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, ClassCancellation{Id: "1", AffectedBookings: 3}, response)
+		assert.True(t, testServer.DBClasses[0].Cancelled)
+		assert.Equal(t, 0, testServer.DBClasses[0].countBookings(BookingConfirmed))
+		assert.Equal(t, 0, testServer.DBClasses[0].countBookings(BookingWaitlisted))
+		assert.Equal(t, []string{"David", "Tom", "Priya"}, recorder.members)
+	})
+	t.Run("try cancel a class that is already cancelled", func(t *testing.T) {
+		w := cancel()
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, ClassCancelled, errorResponse.Err)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+	t.Run("try book a cancelled class", func(t *testing.T) {
+		body := []byte(`{"member_name":"Alex","class_name":"kayak","date":"2020-12-12"}`)
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createBooking(w, r)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, 0, testServer.DBClasses[0].countBookings(BookingConfirmed))
+	})
+	t.Run("try cancel a class that doesn't exist", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		w := cancel()
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func Test_newHTTPServer(t *testing.T) {
+	t.Run("server uses the default timeouts", func(t *testing.T) {
+		server := testServer.newHTTPServer(http.NotFoundHandler())
+
+		assert.Equal(t, defaultReadHeaderTimeout, server.ReadHeaderTimeout)
+		assert.Equal(t, defaultReadTimeout, server.ReadTimeout)
+	})
+	t.Run("server uses the configured timeouts", func(t *testing.T) {
+		testServer.config.ReadHeaderTimeout = 2 * time.Second
+		testServer.config.ReadTimeout = 10 * time.Second
+		defer func() {
+			testServer.config.ReadHeaderTimeout = 0
+			testServer.config.ReadTimeout = 0
+		}()
+
+		server := testServer.newHTTPServer(http.NotFoundHandler())
+
+		assert.Equal(t, 2*time.Second, server.ReadHeaderTimeout)
+		assert.Equal(t, 10*time.Second, server.ReadTimeout)
+	})
+}
+
+func Test_rescheduleClass(t *testing.T) {
+	reschedule := func(id, date string) *httptest.ResponseRecorder {
+		body := []byte(`{"date": "` + date + `"}`)
+		r, _ := http.NewRequest("POST", "/classes/"+id+"/reschedule", bytes.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"id": id})
+		w := httptest.NewRecorder()
+		testServer.rescheduleClass(w, r)
+		return w
+	}
+	newClasses := func() []Class {
+		return []Class{
+			{
+				Id:       "1",
+				Name:     "kayak",
+				Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+				Capacity: 10,
+				Version:  1,
+				Bookings: []Booking{{MemberName: "David", Id: "a", Status: BookingConfirmed}},
+			},
+			{Id: "2", Name: "kayak", Date: time.Date(2020, 12, 14, 0, 0, 0, 0, time.UTC), Capacity: 10, Version: 1},
+		}
+	}
+
+	t.Run("reschedule a class with its bookings", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+		recorder := &recordingNotifier{}
+		testServer.notifier = recorder
+		defer func() { testServer.notifier = logNotifier{} }()
+
+		w := reschedule("1", "2020-12-13")
+
+		var response Class
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, time.Date(2020, 12, 13, 0, 0, 0, 0, time.UTC), response.Date)
+		assert.Equal(t, time.Date(2020, 12, 13, 0, 0, 0, 0, time.UTC), testServer.DBClasses[0].Date)
+		assert.Equal(t, 1, testServer.DBClasses[0].countBookings(BookingConfirmed))
+		assert.Equal(t, []string{"David"}, recorder.members)
+	})
+	t.Run("try reschedule onto a day with a class of the same name", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+
+		w := reschedule("1", "2020-12-14")
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, ClassAlreadyExists, errorResponse.Err)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), testServer.DBClasses[0].Date)
+	})
+	t.Run("try reschedule with a malformed date", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+
+		w := reschedule("1", "2020-13-01")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func Test_rescheduleClasses(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2021, 1, d, 0, 0, 0, 0, time.UTC) }
+	newClasses := func() []Class {
+		return []Class{
+			{Id: "a", Name: "kayak", Date: day(4), Capacity: 10, Bookings: []Booking{{MemberName: "David", Id: "b1", Status: BookingConfirmed}}},
+			{Id: "b", Name: "kayak", Date: day(5), Capacity: 10},
+			{Id: "c", Name: "yoga", Date: day(6), Capacity: 10},
+			{Id: "d", Name: "kayak", Date: day(7), Capacity: 10, Cancelled: true},
+		}
+	}
+	reschedule := func(body string) (*httptest.ResponseRecorder, ErrorResponse) {
+		r, _ := http.NewRequest("POST", "/classes/reschedule", bytes.NewReader([]byte(body)))
+		w := httptest.NewRecorder()
+		testServer.rescheduleClasses(w, r)
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		return w, errorResponse
+	}
+
+	t.Run("move every class with the name forward a day", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+		recorder := &recordingNotifier{}
+		testServer.notifier = recorder
+		defer func() { testServer.notifier = logNotifier{} }()
+
+		w, _ := reschedule(`{"name": "kayak", "shift_days": 1}`)
+
+		var moved []Class
+		json.Unmarshal(w.Body.Bytes(), &moved)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"a", "b"}, classIDs(moved))
+		assert.Equal(t, day(5), testServer.DBClasses[0].Date)
+		assert.Equal(t, day(6), testServer.DBClasses[1].Date)
+		assert.Equal(t, 1, testServer.DBClasses[0].Version)
+		assert.Equal(t, day(6), testServer.DBClasses[2].Date)
+		assert.Equal(t, day(7), testServer.DBClasses[3].Date)
+		assert.Equal(t, []string{"David"}, recorder.members)
+	})
+	t.Run("try move the classes onto a day that already has one with the name", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+
+		w, errorResponse := reschedule(`{"name": "kayak", "shift_days": 2}`)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, CodeClassAlreadyExists, errorResponse.Code)
+		assert.Equal(t, newClasses(), testServer.DBClasses)
+	})
+	t.Run("try move the classes by no days", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+
+		w, errorResponse := reschedule(`{"name": "kayak", "shift_days": 0}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, CodeInvalidShiftDays, errorResponse.Code)
+	})
+	t.Run("try move classes with a name that has none", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+
+		w, errorResponse := reschedule(`{"name": "spin", "shift_days": 1}`)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, CodeClassDoesNotExists, errorResponse.Code)
+	})
+}
+
+func Test_getMemberBookingCount(t *testing.T) {
+	testServer.DBClasses = []Class{
+		{
+			Id:   "1",
+			Name: "kayak",
+			Bookings: []Booking{
+				{MemberName: "David", Id: "a", Status: BookingConfirmed},
+				{MemberName: "Sarah", Id: "b", Status: BookingConfirmed},
+			},
+		},
+		{
+			Id:   "2",
+			Name: "yoga",
+			Bookings: []Booking{
+				{MemberName: "david", Id: "c", Status: BookingConfirmed},
+				{MemberName: "David", Id: "d", Status: BookingCancelled},
+			},
+		},
+		{
+			Id:       "3",
+			Name:     "spin",
+			Bookings: []Booking{{MemberName: "DAVID", Id: "e", Status: BookingConfirmed}},
+		},
+	}
+	countBookings := func(name string) (*httptest.ResponseRecorder, BookingCount) {
+		r, _ := http.NewRequest("GET", "/members/"+name+"/bookings/count", nil)
+		r = mux.SetURLVars(r, map[string]string{"name": name})
+		w := httptest.NewRecorder()
+		testServer.getMemberBookingCount(w, r)
+
+		var response BookingCount
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+		return w, response
+	}
+
+	t.Run("count a member's confirmed bookings across classes", func(t *testing.T) {
+		w, response := countBookings("David")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 3, response.Count)
+	})
+	t.Run("count a member with no bookings", func(t *testing.T) {
+		w, response := countBookings("Tom")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 0, response.Count)
+	})
+}
+
+func bookingIDs(bookings []Booking) []string {
+	ids := make([]string, 0, len(bookings))
+	for _, booking := range bookings {
+		ids = append(ids, booking.Id)
+	}
+	return ids
+}
+
+func Test_deleteMemberBookings(t *testing.T) {
+	testServer.DBClasses = []Class{
+		{
+			Id:       "1",
+			Name:     "kayak",
+			Capacity: 2,
+			Bookings: []Booking{
+				{MemberName: "David", Id: "a", Status: BookingConfirmed},
+				{MemberName: "Sarah", Id: "b", Status: BookingConfirmed},
+				{MemberName: "Tom", Id: "c", Status: BookingWaitlisted},
+			},
+		},
+		{
+			Id:       "2",
+			Name:     "yoga",
+			Capacity: 10,
+			Bookings: []Booking{
+				{MemberName: "david", Id: "d", Status: BookingConfirmed},
+				{MemberName: "Sarah", Id: "e", Status: BookingConfirmed},
+			},
+		},
+	}
+	deleteBookings := func(name string) (*httptest.ResponseRecorder, DeletedBookings) {
+		r, _ := http.NewRequest("DELETE", "/members/"+name+"/bookings", nil)
+		r = mux.SetURLVars(r, map[string]string{"name": name})
+		w := httptest.NewRecorder()
+		testServer.deleteMemberBookings(w, r)
+
+		var response DeletedBookings
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response
+	}
+
+	t.Run("delete a member's bookings in two classes", func(t *testing.T) {
+		w, response := deleteBookings("DAVID")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 2, response.Deleted)
+		assert.Equal(t, []string{"b", "c"}, bookingIDs(testServer.DBClasses[0].Bookings))
+		assert.Equal(t, []string{"e"}, bookingIDs(testServer.DBClasses[1].Bookings))
+	})
+	t.Run("promote a waitlisted member into the freed spot", func(t *testing.T) {
+		assert.Equal(t, BookingConfirmed, testServer.DBClasses[0].Bookings[1].Status)
+		assert.Equal(t, AuditPromoted, testServer.DBClasses[0].Audit[len(testServer.DBClasses[0].Audit)-1].Action)
+	})
+	t.Run("delete the bookings of a member with none", func(t *testing.T) {
+		w, response := deleteBookings("David")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 0, response.Deleted)
+	})
+}
+
+func Test_maxSessionsPerDay(t *testing.T) {
+	newClasses := func() []Class {
+		return []Class{
+			{Id: "1", Name: "kayak", Date: time.Date(2006, 1, 1, 0, 0, 0, 0, time.UTC), Capacity: 20},
+			{Id: "2", Name: "kayak", Date: time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC), Capacity: 20},
+			{Id: "3", Name: "kayak", Date: time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC), Capacity: 20},
+		}
+	}
+	duplicate := func() *httptest.ResponseRecorder {
+		body := []byte(`{"start_date": "2006-01-02","end_date": "2006-01-02"}`)
+		r, _ := http.NewRequest("POST", "/classes/1/duplicate", bytes.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+		testServer.duplicateClass(w, r)
+		return w
+	}
+
+	t.Run("sessions are unlimited by default", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+
+		w := duplicate()
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 4, len(testServer.DBClasses))
+	})
+	t.Run("try duplicate a class onto a day at the limit", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+		testServer.config.MaxSessionsPerDay = 2
+		defer func() { testServer.config.MaxSessionsPerDay = 0 }()
+
+		w := duplicate()
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, TooManySessions, errorResponse.Err)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, 3, len(testServer.DBClasses))
+	})
+	t.Run("try create a class on a day at the limit reports the class exists", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+		testServer.config.MaxSessionsPerDay = 2
+		defer func() { testServer.config.MaxSessionsPerDay = 0 }()
+
+		body := []byte(`{"name": "kayak","start_date": "2006-01-02","end_date": "2006-01-03", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createClass(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, ClassAlreadyExists, errorResponse.Err)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, 3, len(testServer.DBClasses))
+	})
+	t.Run("create as many different classes on a day as the limit", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+		testServer.config.MaxSessionsPerDay = 2
+		defer func() { testServer.config.MaxSessionsPerDay = 0 }()
+
+		for _, name := range []string{"yoga", "lifting"} {
+			body := []byte(`{"name": "` + name + `","start_date": "2006-01-02","end_date": "2006-01-02", "capacity": 20}`)
+			r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			testServer.createClass(w, r)
+
+			assert.Equal(t, http.StatusCreated, w.Code)
+		}
+		assert.Equal(t, 5, len(testServer.DBClasses))
+	})
+}
+
+func Test_createClassIfNoneMatch(t *testing.T) {
+	testServer.DBClasses = []Class{}
+	create := func() *httptest.ResponseRecorder {
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-03", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes?on_conflict=skip", bytes.NewReader(body))
+		r.Header.Set("If-None-Match", "*")
+		w := httptest.NewRecorder()
+		testServer.createClass(w, r)
+		return w
+	}
+
+	t.Run("first conditional create succeeds", func(t *testing.T) {
+		w := create()
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 3, len(testServer.DBClasses))
+	})
+	t.Run("repeated conditional create fails its precondition", func(t *testing.T) {
+		w := create()
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, ClassAlreadyExists, errorResponse.Err)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		assert.Equal(t, 3, len(testServer.DBClasses))
+	})
+}
+
+func Test_createBookingWindow(t *testing.T) {
+	testServer.now = func() time.Time { return time.Date(2020, 12, 1, 9, 0, 0, 0, time.UTC) }
+	testServer.config.BookingWindowDays = 7
+	defer func() {
+		testServer.now = testClock
+		testServer.config.BookingWindowDays = 0
+	}()
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "lifting", Date: time.Date(2020, 12, 8, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		{Id: "2", Name: "lifting", Date: time.Date(2020, 12, 9, 0, 0, 0, 0, time.UTC), Capacity: 10},
+	}
+	book := func(date string) *httptest.ResponseRecorder {
+		body := []byte(`{"member_name":"David","class_name":"lifting","date":"` + date + `"}`)
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createBooking(w, r)
+		return w
+	}
+
+	t.Run("book a class inside the booking window", func(t *testing.T) {
+		w := book("2020-12-08")
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+	t.Run("try book a class outside the booking window", func(t *testing.T) {
+		w := book("2020-12-09")
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, BookingNotYetOpen, errorResponse.Err)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses[1].Bookings))
+	})
+}
+
+func Test_updateBooking(t *testing.T) {
+	newClasses := func() []Class {
+		return []Class{
+			{
+				Id:       "1",
+				Name:     "lifting",
+				Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+				Capacity: 1,
+				Bookings: []Booking{
+					{MemberName: "Dvid", Id: "a", Status: BookingConfirmed},
+					{MemberName: "Sarah", Id: "b", Status: BookingWaitlisted},
+				},
+			},
+		}
+	}
+	rename := func(id, member string) *httptest.ResponseRecorder {
+		body := []byte(`{"member_name":"` + member + `"}`)
+		r, _ := http.NewRequest("PATCH", "/bookings/"+id, bytes.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"id": id})
+		w := httptest.NewRecorder()
+		testServer.updateBooking(w, r)
+		return w
+	}
+
+	t.Run("rename a booking in place", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+
+		w := rename("a", "David")
+
+		var response Booking
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, Booking{MemberName: "David", Id: "a", Status: BookingConfirmed}, response)
+		assert.Equal(t, "David", testServer.DBClasses[0].Bookings[0].MemberName)
+		assert.Equal(t, "a", testServer.DBClasses[0].Bookings[0].Id)
+	})
+	t.Run("try rename a booking to a member already booked", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+
+		w := rename("a", "sarah")
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, MemberAlreadyBooked, errorResponse.Err)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, "Dvid", testServer.DBClasses[0].Bookings[0].MemberName)
+	})
+	t.Run("fix the case of a booking's own member name", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+
+		w := rename("b", "SARAH")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	t.Run("try rename a booking that doesn't exist", func(t *testing.T) {
+		testServer.DBClasses = newClasses()
+
+		w := rename("z", "David")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func Test_nameCharacters(t *testing.T) {
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 10},
+	}
+	book := func(member string) (*httptest.ResponseRecorder, ErrorResponse) {
+		body, _ := json.Marshal(BookingRequest{MemberName: member, ClassName: "lifting", Date: "2020-12-12"})
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createBooking(w, r)
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		return w, errorResponse
+	}
+
+	t.Run("book with a valid member name", func(t *testing.T) {
+		w, _ := book("Zoë O'Brien-Smith")
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+	t.Run("try book with a newline in the member name", func(t *testing.T) {
+		w, errorResponse := book("David\nSarah")
+
+		assert.Equal(t, InvalidCharacters, errorResponse.Err)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, 1, len(testServer.DBClasses[0].Bookings))
+	})
+	t.Run("try create a class with a control character in the name", func(t *testing.T) {
+		body := []byte(`{"name": "kayak\r","start_date": "2006-01-01","end_date": "2006-01-01", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createClass(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, InvalidCharacters, errorResponse.Err)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func Test_createClassRangeInPast(t *testing.T) {
+	when := time.Date(2021, 1, 10, 9, 0, 0, 0, time.UTC)
+	create := func(startDate, endDate string) *httptest.ResponseRecorder {
+		body := []byte(`{"name": "kayak", "start_date": "` + startDate + `", "end_date": "` + endDate + `", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		withFrozenTime(t, when, func() {
+			testServer.createClass(w, r)
+		})
+		return w
+	}
+
+	t.Run("try create classes entirely before today", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		w := create("2021-01-01", "2021-01-09")
+
+		var response ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, CodeRangeInPast, response.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses))
+	})
+	t.Run("create every day of a range that runs from the past into the future", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		w := create("2021-01-08", "2021-01-11")
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 4, len(testServer.DBClasses))
+		assert.Equal(t, time.Date(2021, 1, 8, 0, 0, 0, 0, time.UTC), testServer.DBClasses[0].Date)
+	})
+	t.Run("create a class today", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		w := create("2021-01-10", "2021-01-10")
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 1, len(testServer.DBClasses))
+	})
+}
+
+func Test_createClassIDsOnly(t *testing.T) {
+	t.Run("create a range of classes returning only their ids", func(t *testing.T) {
+		server := NewServer(Config{}, sequentialIDsAfter(0))
+		server.now = testClock
+
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-03", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes?response=ids", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		server.createClass(w, r)
+
+		respBody, _ := ioutil.ReadAll(w.Body)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, `["1","2","3"]`+"\n", string(respBody))
+		assert.Equal(t, 3, len(server.DBClasses))
+	})
+	t.Run("try create classes with an unknown response mode", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-03", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes?response=names", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createClass(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses))
+	})
+}
+
+func Test_createClassOrder(t *testing.T) {
+	t.Run("classes around a skipped day are returned and stored in date order", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{Id: "existing", Name: "kayak", Date: time.Date(2006, 1, 3, 0, 0, 0, 0, time.UTC), Capacity: 20},
+		}
+
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-05", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes?on_conflict=skip", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createClass(w, r)
+
+		var response []Class
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		days := func(classes []Class) []int {
+			var days []int
+			for _, class := range classes {
+				days = append(days, class.Date.Day())
+			}
+			return days
+		}
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, []int{1, 2, 4, 5}, days(response))
+		assert.Equal(t, []int{3, 1, 2, 4, 5}, days(testServer.DBClasses))
+	})
+}
+
+func Test_memberEmail(t *testing.T) {
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 10},
+	}
+	book := func(member, email string) (*httptest.ResponseRecorder, ErrorResponse) {
+		body, _ := json.Marshal(BookingRequest{MemberName: member, MemberEmail: email, ClassName: "lifting", Date: "2020-12-12"})
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createBooking(w, r)
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		return w, errorResponse
+	}
+
+	t.Run("two members with the same name but different emails can both book", func(t *testing.T) {
+		w, _ := book("David", "david@example.com")
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		w, _ = book("David", "david.smith@example.com")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 2, len(testServer.DBClasses[0].Bookings))
+		assert.Equal(t, "david.smith@example.com", testServer.DBClasses[0].Bookings[1].MemberEmail)
+	})
+	t.Run("try book twice with the same email under another name", func(t *testing.T) {
+		w, errorResponse := book("Dave", "David@Example.com")
+
+		assert.Equal(t, MemberAlreadyBooked, errorResponse.Err)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, 2, len(testServer.DBClasses[0].Bookings))
+	})
+	t.Run("try book with an invalid email", func(t *testing.T) {
+		w, errorResponse := book("Sarah", "Sarah <sarah@example.com>")
+
+		assert.Equal(t, InvalidEmail, errorResponse.Err)
+		assert.Equal(t, CodeInvalidEmail, errorResponse.Code)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	t.Run("count a member's bookings by email", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/members/David/bookings/count?email=david@example.com", nil)
+		r = mux.SetURLVars(r, map[string]string{"name": "David"})
+		w := httptest.NewRecorder()
+
+		testServer.getMemberBookingCount(w, r)
+
+		var count BookingCount
+		json.Unmarshal(w.Body.Bytes(), &count)
+		assert.Equal(t, 1, count.Count)
+	})
+}
+
+func Test_createClassCapacities(t *testing.T) {
+	t.Run("create a range of classes with a capacity for each day", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-03", "capacities": [20, 25, 30]}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createClass(w, r)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 3, len(testServer.DBClasses))
+		assert.Equal(t, 20, testServer.DBClasses[0].Capacity)
+		assert.Equal(t, 25, testServer.DBClasses[1].Capacity)
+		assert.Equal(t, 30, testServer.DBClasses[2].Capacity)
+	})
+	t.Run("try create a range of classes with too few capacities", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-03", "capacities": [20, 25]}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createClass(w, r)
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, CodeCapacitiesMismatch, errorResponse.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses))
+	})
+	t.Run("try create classes with a negative capacity", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-02", "capacities": [20, -1]}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createClass(w, r)
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, InvalidCapacity, errorResponse.Err)
+	})
+}
+
+func Test_batchTooLarge(t *testing.T) {
+	testServer.config.MaxBatchSize = 2
+	defer func() { testServer.config.MaxBatchSize = 0 }()
+
+	t.Run("try import more rows than allowed in one batch", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		body := "name,date,capacity\nkayak,2021-01-01,10\nyoga,2021-01-02,15\nlifting,2021-01-03,20\n"
+		r, _ := http.NewRequest("POST", "/classes/import", bytes.NewReader([]byte(body)))
+		r.Header.Set("Content-Type", "text/csv")
+		w := httptest.NewRecorder()
+
+		testServer.importClassesCSV(w, r)
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, BatchTooLarge, errorResponse.Err)
+		assert.Equal(t, 0, len(testServer.DBClasses))
+	})
+	t.Run("import as many rows as allowed in one batch", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		body := "name,date,capacity\nkayak,2021-01-01,10\nyoga,2021-01-02,15\n"
+		r, _ := http.NewRequest("POST", "/classes/import", bytes.NewReader([]byte(body)))
+		r.Header.Set("Content-Type", "text/csv")
+		w := httptest.NewRecorder()
+
+		testServer.importClassesCSV(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 2, len(testServer.DBClasses))
+	})
+	t.Run("try create classes with more capacities than allowed in one batch", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-03", "capacities": [20, 25, 30]}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createClass(w, r)
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, CodeBatchTooLarge, errorResponse.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses))
+	})
+}
+
+func Test_createBookingReceipt(t *testing.T) {
+	testServer.DBClasses = []Class{
+		{
+			Id:       "7",
+			Name:     "lifting",
+			Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+			Capacity: 2,
+			Bookings: []Booking{{MemberName: "David", Id: "a", Status: BookingConfirmed}},
+		},
+	}
+	book := func(member string) (*httptest.ResponseRecorder, BookingReceipt) {
+		body, _ := json.Marshal(BookingRequest{MemberName: member, ClassName: "lifting", Date: "2020-12-12", Waitlist: true})
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createBooking(w, r)
+
+		var receipt BookingReceipt
+		json.Unmarshal(w.Body.Bytes(), &receipt)
+		return w, receipt
+	}
+
+	t.Run("receipt for a confirmed booking", func(t *testing.T) {
+		w, receipt := book("Sarah")
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "7", receipt.ClassId)
+		assert.Equal(t, "2020-12-12", receipt.Date)
+		assert.Equal(t, BookingConfirmed, receipt.Status)
+		assert.Equal(t, 2, receipt.Position)
+		assert.Equal(t, 0, receipt.SpotsRemaining)
+	})
+	t.Run("receipt for a waitlisted booking", func(t *testing.T) {
+		book("Tom")
+		w, receipt := book("Anna")
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "7", receipt.ClassId)
+		assert.Equal(t, BookingWaitlisted, receipt.Status)
+		assert.Equal(t, 2, receipt.Position)
+		assert.Equal(t, 0, receipt.SpotsRemaining)
+	})
+}
+
+func Test_deleteClass(t *testing.T) {
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		{Id: "2", Name: "kayak", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 10},
+	}
+	testServer.markClassesChanged()
+	fetch := func(id string) (*httptest.ResponseRecorder, ErrorResponse) {
+		r, _ := http.NewRequest("GET", "/classes/"+id, nil)
+		r = mux.SetURLVars(r, map[string]string{"id": id})
+		w := httptest.NewRecorder()
+		testServer.getClass(w, r)
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		return w, errorResponse
+	}
+
+	t.Run("delete a class", func(t *testing.T) {
+		r, _ := http.NewRequest("DELETE", "/classes/1", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+
+		testServer.deleteClass(w, r)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.True(t, testServer.DBClasses[0].Deleted)
+		_, classes := listClasses("")
+		assert.Equal(t, []string{"2"}, classIDs(classes))
+	})
+	t.Run("fetching a deleted class is gone", func(t *testing.T) {
+		w, errorResponse := fetch("1")
+
+		assert.Equal(t, http.StatusGone, w.Code)
+		assert.Equal(t, CodeClassDeleted, errorResponse.Code)
+	})
+	t.Run("fetching a class that never existed is not found", func(t *testing.T) {
+		w, errorResponse := fetch("3")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, CodeClassDoesNotExists, errorResponse.Code)
+	})
+	t.Run("try book a deleted class", func(t *testing.T) {
+		body := []byte(`{"member_name": "David","class_name": "lifting","date": "2020-12-12"}`)
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createBooking(w, r)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func Test_createClassCredits(t *testing.T) {
+	t.Run("create classes costing credits", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-01", "capacity": 20, "credits": 3}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createClass(w, r)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"credits":3`)
+		assert.Equal(t, 3, testServer.DBClasses[0].Credits)
+		assert.Equal(t, 20, testServer.DBClasses[0].Capacity)
+	})
+	t.Run("try create classes with negative credits", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-01", "capacity": 20, "credits": -1}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createClass(w, r)
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, InvalidCredits, errorResponse.Err)
+		assert.Equal(t, 0, len(testServer.DBClasses))
+	})
+}
+
+func Test_invalidJSON(t *testing.T) {
+	create := func(body string) ErrorResponse {
+		r, _ := http.NewRequest("POST", "/classes", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createClass(w, r)
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, CodeInvalidJSON, errorResponse.Code)
+		return errorResponse
+	}
+
+	t.Run("report where a syntax error is", func(t *testing.T) {
+		errorResponse := create(`{"name": "kayak",, "capacity": 20}`)
+
+		assert.Equal(t, "JSON parse error: invalid JSON at offset 18", errorResponse.Err)
+	})
+	t.Run("report a field with the wrong type", func(t *testing.T) {
+		errorResponse := create(`{"name": "kayak", "capacity": 20, "credits": "2"}`)
+
+		assert.Equal(t, "JSON parse error: field credits: expected int got string", errorResponse.Err)
+	})
+	t.Run("fall back to the generic message", func(t *testing.T) {
+		errorResponse := create(`["kayak"]`)
+
+		assert.Equal(t, InvalidJSON, errorResponse.Err)
+	})
+}
+
+func Test_reopenClass(t *testing.T) {
+	reopen := func() (*httptest.ResponseRecorder, ErrorResponse) {
+		r, _ := http.NewRequest("POST", "/classes/1/reopen", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+		testServer.reopenClass(w, r)
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		return w, errorResponse
+	}
+
+	t.Run("reopen a cancelled class", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{
+				Id: "1", Name: "kayak", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 2, Version: 2,
+				Cancelled: true,
+				Bookings:  []Booking{{MemberName: "David", Id: "a", Status: BookingCancelled}},
+			},
+		}
+
+		w, _ := reopen()
+
+		var response ClassDetail
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.False(t, response.Cancelled)
+		assert.Equal(t, 2, response.SpotsAvailable)
+		assert.False(t, testServer.DBClasses[0].Cancelled)
+		assert.Equal(t, 3, testServer.DBClasses[0].Version)
+		assert.Equal(t, BookingCancelled, testServer.DBClasses[0].Bookings[0].Status)
+
+		body := []byte(`{"member_name": "David","class_name": "kayak","date": "2020-12-12"}`)
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w = httptest.NewRecorder()
+		testServer.createBooking(w, r)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+	t.Run("try reopen a class that isn't cancelled", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{Id: "1", Name: "kayak", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 2, Version: 1},
+		}
+
+		w, errorResponse := reopen()
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, ClassNotCancelled, errorResponse.Err)
+		assert.Equal(t, 1, testServer.DBClasses[0].Version)
+	})
+}
+
+func Test_validateBooking(t *testing.T) {
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		{
+			Id: "2", Name: "lifting", Date: time.Date(2020, 12, 13, 0, 0, 0, 0, time.UTC), Capacity: 1,
+			Bookings: []Booking{{MemberName: "Sarah", Id: "a", Status: BookingConfirmed}},
+		},
+	}
+	validate := func(body string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("POST", "/bookings/validate", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.validateBooking(w, r)
+		return w
+	}
+
+	t.Run("validate a booking for a class with space", func(t *testing.T) {
+		w := validate(`{"member_name": "David","class_name": "lifting","date": "2020-12-12"}`)
+
+		var response BookingValidation
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, BookingValidation{Bookable: true, Status: BookingConfirmed}, response)
+		assert.Equal(t, 0, len(testServer.DBClasses[0].Bookings))
+	})
+	t.Run("validate a booking for a full class", func(t *testing.T) {
+		w := validate(`{"member_name": "David","class_name": "lifting","date": "2020-12-13"}`)
+
+		var response ClassFullResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, CodeClassIsFull, response.Code)
+		assert.Equal(t, []string{"1"}, classIDs(response.Suggestions))
+		assert.Equal(t, 1, len(testServer.DBClasses[1].Bookings))
+	})
+	t.Run("validate a duplicate booking", func(t *testing.T) {
+		w := validate(`{"member_name": "sarah","class_name": "lifting","date": "2020-12-13","waitlist": true}`)
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, MemberAlreadyBooked, errorResponse.Err)
+	})
+}
+
+func Test_getClassDateFormat(t *testing.T) {
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 20},
+	}
+	get := func(query string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/classes/1"+query, nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+		testServer.getClass(w, r)
+		return w
+	}
+
+	t.Run("get a class with an rfc3339 date by default", func(t *testing.T) {
+		w := get("")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"date":"2020-12-12T00:00:00Z"`)
+	})
+	t.Run("get a class with a date only date", func(t *testing.T) {
+		w := get("?date_format=date")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"date":"2020-12-12"`)
+		assert.Contains(t, w.Body.String(), `"spots_available":20`)
+	})
+	t.Run("get a camelCase class with a date only date", func(t *testing.T) {
+		w := get("?date_format=date&naming=camel")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"date":"2020-12-12"`)
+		assert.Contains(t, w.Body.String(), `"spotsAvailable":20`)
+	})
+	t.Run("try get a class with an unknown date format", func(t *testing.T) {
+		w := get("?date_format=unix")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func Test_cooldownMinutes(t *testing.T) {
+	testServer.config.CooldownMinutes = 30
+	defer func() { testServer.config.CooldownMinutes = 0 }()
+	date := time.Date(2006, 1, 1, 0, 0, 0, 0, time.UTC)
+	create := func(body string) (*httptest.ResponseRecorder, ErrorResponse) {
+		// testServer creates every class with id 1 so the existing class needs another id
+		testServer.DBClasses = []Class{
+			{Id: "yoga", Name: "yoga", Date: date, Capacity: 10, Location: "Studio A", StartTime: "09:00", DurationMinutes: 60},
+		}
+		r, _ := http.NewRequest("POST", "/classes", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createClass(w, r)
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		return w, errorResponse
+	}
+
+	t.Run("create a class exactly the cooldown after another in the room", func(t *testing.T) {
+		w, _ := create(`{"name": "pilates", "start_date": "2006-01-01", "end_date": "2006-01-01", "capacity": 10, "location": "Studio A", "start_time": "10:30", "duration_minutes": 45}`)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 2, len(testServer.DBClasses))
+		assert.Equal(t, "10:30", testServer.DBClasses[1].StartTime)
+	})
+	t.Run("create a class exactly the cooldown before another in the room", func(t *testing.T) {
+		w, _ := create(`{"name": "pilates", "start_date": "2006-01-01", "end_date": "2006-01-01", "capacity": 10, "location": "studio a", "start_time": "07:45", "duration_minutes": 45}`)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+	t.Run("try create a class less than the cooldown after another in the room", func(t *testing.T) {
+		w, errorResponse := create(`{"name": "pilates", "start_date": "2006-01-01", "end_date": "2006-01-01", "capacity": 10, "location": "Studio A", "start_time": "10:29", "duration_minutes": 45}`)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, CodeCooldownViolation, errorResponse.Code)
+		assert.Equal(t, 1, len(testServer.DBClasses))
+	})
+	t.Run("try create a class overlapping another in the room", func(t *testing.T) {
+		w, errorResponse := create(`{"name": "pilates", "start_date": "2006-01-01", "end_date": "2006-01-01", "capacity": 10, "location": "Studio A", "start_time": "09:30", "duration_minutes": 45}`)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, CodeRoomDoubleBooked, errorResponse.Code)
+	})
+	t.Run("create a class less than the cooldown after another in a different room", func(t *testing.T) {
+		w, _ := create(`{"name": "pilates", "start_date": "2006-01-01", "end_date": "2006-01-01", "capacity": 10, "location": "Studio B", "start_time": "10:00", "duration_minutes": 45}`)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+	t.Run("try create a class with an invalid start time", func(t *testing.T) {
+		w, errorResponse := create(`{"name": "pilates", "start_date": "2006-01-01", "end_date": "2006-01-01", "capacity": 10, "start_time": "25:00"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, CodeInvalidSessionTime, errorResponse.Code)
+	})
+	t.Run("try reschedule a class to less than the cooldown after another in the room", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{Id: "1", Name: "yoga", Date: date, Capacity: 10, Location: "Studio A", StartTime: "09:00", DurationMinutes: 60},
+			{Id: "2", Name: "pilates", Date: date.AddDate(0, 0, 1), Capacity: 10, Location: "Studio A", StartTime: "10:15", DurationMinutes: 45},
+		}
+		r, _ := http.NewRequest("POST", "/classes/2/reschedule", strings.NewReader(`{"date": "2006-01-01"}`))
+		r = mux.SetURLVars(r, map[string]string{"id": "2"})
+		w := httptest.NewRecorder()
+
+		testServer.rescheduleClass(w, r)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), CodeCooldownViolation)
+		assert.Equal(t, date.AddDate(0, 0, 1), testServer.DBClasses[1].Date)
+	})
+}
+
+func Test_withFrozenTime(t *testing.T) {
+	when := time.Date(2020, 12, 1, 9, 30, 0, 0, time.UTC)
+	book := func(member string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(BookingRequest{MemberName: member, ClassName: "lifting", Date: "2020-12-12"})
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createBooking(w, r)
+		return w
+	}
+
+	t.Run("bookings made with the clock frozen have the same timestamps", func(t *testing.T) {
+		testServer.DBClasses = []Class{
+			{Id: "7", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 5},
+		}
+
+		withFrozenTime(t, when, func() {
+			assert.Equal(t, http.StatusCreated, book("David").Code)
+			assert.Equal(t, http.StatusCreated, book("Sarah").Code)
+		})
+
+		for _, booking := range testServer.DBClasses[0].Bookings {
+			assert.Equal(t, when, booking.CreatedAt)
+		}
+		for _, entry := range testServer.DBClasses[0].Audit {
+			assert.Equal(t, when, entry.Timestamp)
+		}
+		assert.Equal(t, 2, len(testServer.DBClasses[0].Audit))
+	})
+	t.Run("the clock is restored afterwards", func(t *testing.T) {
+		withFrozenTime(t, when, func() {
+			assert.Equal(t, when, testServer.now())
+		})
+
+		assert.Equal(t, testClock(), testServer.now())
+	})
+}
+
+func Test_rejectTimeConflicts(t *testing.T) {
+	testServer.config.RejectTimeConflicts = true
+	defer func() { testServer.config.RejectTimeConflicts = false }()
+	date := time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC)
+	book := func(className string) (*httptest.ResponseRecorder, ErrorResponse) {
+		testServer.DBClasses = []Class{
+			{
+				Id: "1", Name: "yoga", Date: date, Capacity: 10, StartTime: "09:00", DurationMinutes: 60,
+				Bookings: []Booking{{MemberName: "David", Id: "a", Status: BookingConfirmed}},
+			},
+			{Id: "2", Name: "spin", Date: date, Capacity: 10, StartTime: "09:30", DurationMinutes: 45},
+			{Id: "3", Name: "pilates", Date: date, Capacity: 10, StartTime: "10:00", DurationMinutes: 45},
+			{Id: "4", Name: "kayak", Date: date, Capacity: 10},
+		}
+		body, _ := json.Marshal(BookingRequest{MemberName: "david", ClassName: className, Date: "2021-01-04"})
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createBooking(w, r)
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		return w, errorResponse
+	}
+
+	t.Run("try book a class overlapping one the member is booked into", func(t *testing.T) {
+		w, errorResponse := book("spin")
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, CodeMemberTimeConflict, errorResponse.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses[1].Bookings))
+	})
+	t.Run("book a class starting as the member's other class ends", func(t *testing.T) {
+		w, _ := book("pilates")
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+	t.Run("book a class without a start time", func(t *testing.T) {
+		w, _ := book("kayak")
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+	t.Run("book an overlapping class when conflicts are allowed", func(t *testing.T) {
+		testServer.config.RejectTimeConflicts = false
+		defer func() { testServer.config.RejectTimeConflicts = true }()
+
+		w, _ := book("spin")
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+}
+
+func Test_getClassesEncodeFailure(t *testing.T) {
+	// times after year 9999 can't be written as JSON
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "kayak", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		{Id: "2", Name: "yoga", Date: time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC), Capacity: 10},
+	}
+	testServer.markClassesChanged()
+	defer testServer.markClassesChanged()
+	list := func(query string) (*httptest.ResponseRecorder, ErrorResponse) {
+		r, _ := http.NewRequest("GET", "/classes"+query, nil)
+		w := httptest.NewRecorder()
+		testServer.getClasses(w, r)
+
+		var errorResponse ErrorResponse
+		err := json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		assert.NoError(t, err)
+		return w, errorResponse
+	}
+
+	for _, query := range []string{"", "?min_capacity=1", "?limit=5", "?group_by=date"} {
+		t.Run("write a clean error when classes can't be encoded for "+query, func(t *testing.T) {
+			w, errorResponse := list(query)
+
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+			assert.Equal(t, CodeInternalError, errorResponse.Code)
+			assert.Empty(t, w.Header().Get("X-Total-Capacity"))
+		})
+	}
+}
+
+func Test_minAdvanceMinutes(t *testing.T) {
+	testServer.config.MinAdvanceMinutes = 60
+	defer func() { testServer.config = Config{} }()
+	book := func(now time.Time) (*httptest.ResponseRecorder, ErrorResponse) {
+		testServer.DBClasses = []Class{
+			{Id: "1", Name: "yoga", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10, StartTime: "18:00", DurationMinutes: 60},
+		}
+		body, _ := json.Marshal(BookingRequest{MemberName: "David", ClassName: "yoga", Date: "2021-01-04"})
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		withFrozenTime(t, now, func() {
+			testServer.createBooking(w, r)
+		})
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		return w, errorResponse
+	}
+
+	t.Run("book a class comfortably ahead of its start", func(t *testing.T) {
+		w, _ := book(time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC))
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+	t.Run("try book a class inside the cutoff", func(t *testing.T) {
+		w, errorResponse := book(time.Date(2021, 1, 4, 17, 30, 0, 0, time.UTC))
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, CodeBookingTooLate, errorResponse.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses[0].Bookings))
+	})
+	t.Run("the class starts in the server's timezone", func(t *testing.T) {
+		testServer.config.Timezone = time.FixedZone("Gym", 3600)
+		defer func() { testServer.config.Timezone = nil }()
+
+		w, errorResponse := book(time.Date(2021, 1, 4, 16, 30, 0, 0, time.UTC))
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, CodeBookingTooLate, errorResponse.Code)
+	})
+	t.Run("book right up to the start when there is no minimum", func(t *testing.T) {
+		testServer.config.MinAdvanceMinutes = 0
+		defer func() { testServer.config.MinAdvanceMinutes = 60 }()
+
+		w, _ := book(time.Date(2021, 1, 4, 17, 59, 0, 0, time.UTC))
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+}
+
+func Test_createBookingNotBookable(t *testing.T) {
+	book := func(className string) ErrorResponse {
+		testServer.DBClasses = []Class{
+			{Id: "1", Name: "kayak", Date: time.Date(2006, 1, 1, 0, 0, 0, 0, time.UTC), Capacity: 0},
+			{
+				Id: "2", Name: "yoga", Date: time.Date(2006, 1, 1, 0, 0, 0, 0, time.UTC), Capacity: 1,
+				Bookings: []Booking{{MemberName: "Sarah", Id: "a", Status: BookingConfirmed}},
+			},
+		}
+		body, _ := json.Marshal(BookingRequest{MemberName: "David", ClassName: className, Date: "2006-01-01"})
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createBooking(w, r)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		return errorResponse
+	}
+
+	t.Run("try book a class without capacity", func(t *testing.T) {
+		errorResponse := book("kayak")
+
+		assert.Equal(t, ErrorResponse{Err: ClassNotBookable, Code: CodeClassNotBookable}, errorResponse)
+		assert.Equal(t, 0, len(testServer.DBClasses[0].Bookings))
+	})
+	t.Run("try book a class that has filled up", func(t *testing.T) {
+		errorResponse := book("yoga")
+
+		assert.Equal(t, ErrorResponse{Err: ClassIsFull, Code: CodeClassIsFull}, errorResponse)
+	})
+}
+
+func Test_getClassChanges(t *testing.T) {
+	server := NewServer(Config{}, sequentialIDsAfter(0))
+	server.now = testClock
+	create := func(name string) {
+		body := []byte(`{"name": "` + name + `","start_date": "2006-01-02","end_date": "2006-01-02", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		server.createClass(w, r)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+	changes := func(since string) (ClassChanges, int) {
+		r, _ := http.NewRequest("GET", "/classes/changes?since="+since, nil)
+		w := httptest.NewRecorder()
+		server.getClassChanges(w, r)
+		var response ClassChanges
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response, w.Code
+	}
+
+	create("yoga")
+	create("pilates")
+	full, code := changes("0")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, len(full.Classes))
+	assert.Equal(t, uint64(2), full.ChangeSeq)
+
+	t.Run("an incremental pull only returns classes created since the last sync", func(t *testing.T) {
+		create("kayak")
+
+		response, code := changes(strconv.FormatUint(full.ChangeSeq, 10))
+
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 1, len(response.Classes))
+		assert.Equal(t, "kayak", response.Classes[0].Name)
+		assert.Equal(t, uint64(3), response.ChangeSeq)
+	})
+	t.Run("a booking marks its class as changed", func(t *testing.T) {
+		body := []byte(`{"member_name": "David", "class_name": "yoga", "date": "2006-01-02"}`)
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		server.createBooking(w, r)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		response, _ := changes("3")
+
+		assert.Equal(t, 1, len(response.Classes))
+		assert.Equal(t, "1", response.Classes[0].Id)
+		assert.Equal(t, uint64(4), response.ChangeSeq)
+	})
+	t.Run("a deleted class is returned by id", func(t *testing.T) {
+		r, _ := http.NewRequest("DELETE", "/classes/2", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "2"})
+		w := httptest.NewRecorder()
+		server.deleteClass(w, r)
+
+		response, _ := changes("4")
+
+		assert.Equal(t, 0, len(response.Classes))
+		assert.Equal(t, []string{"2"}, response.DeletedIds)
+	})
+	t.Run("try get changes with an invalid since", func(t *testing.T) {
+		_, code := changes("-1")
+
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
+
+func Test_createClassRepeated(t *testing.T) {
+	server := NewServer(Config{}, sequentialIDsAfter(0))
+	server.now = testClock
+	create := func(body string) (*httptest.ResponseRecorder, []Class) {
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader([]byte(body)))
+		w := httptest.NewRecorder()
+		server.createClass(w, r)
+		var response []Class
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response
+	}
+	body := `{"name": "kayak","start_date": "2006-01-02","end_date": "2006-01-03", "capacity": 20}`
+
+	t.Run("the first create makes new classes", func(t *testing.T) {
+		w, created := create(body)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 2, len(created))
+		assert.Equal(t, 2, len(server.DBClasses))
+	})
+	t.Run("an identical repeat returns the classes already created", func(t *testing.T) {
+		w, repeated := create(body)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"1", "2"}, classIDsOf(repeated))
+		assert.Equal(t, 2, len(server.DBClasses))
+	})
+	t.Run("try repeat with a different capacity", func(t *testing.T) {
+		w, _ := create(`{"name": "kayak","start_date": "2006-01-02","end_date": "2006-01-03", "capacity": 10}`)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, 2, len(server.DBClasses))
+	})
+	t.Run("a request differing only by rrule isn't a repeat", func(t *testing.T) {
+		w, mondays := create(`{"name": "yoga","start_date": "2006-02-06","end_date": "2006-02-19", "capacity": 20, "rrule": "FREQ=WEEKLY;BYDAY=MO"}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 2, len(mondays))
+
+		w, tuesdays := create(`{"name": "yoga","start_date": "2006-02-06","end_date": "2006-02-19", "capacity": 20, "rrule": "FREQ=WEEKLY;BYDAY=TU"}`)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 2, len(tuesdays))
+		assert.Equal(t, time.Date(2006, 2, 7, 0, 0, 0, 0, time.UTC), tuesdays[0].Date)
+		assert.Equal(t, 6, len(server.DBClasses))
+	})
+}
+
+func Test_createClassCapacityNumbers(t *testing.T) {
+	create := func(capacity string) (*httptest.ResponseRecorder, ErrorResponse) {
+		testServer.DBClasses = []Class{}
+		body := `{"name": "kayak","start_date": "2006-01-02","end_date": "2006-01-02", "capacity": ` + capacity + `}`
+		r, _ := http.NewRequest("POST", "/classes", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createClass(w, r)
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		return w, errorResponse
+	}
+
+	for _, capacity := range []string{`20`, `20.0`, `"20"`} {
+		t.Run("create a class with capacity "+capacity, func(t *testing.T) {
+			w, _ := create(capacity)
+
+			assert.Equal(t, http.StatusCreated, w.Code)
+			assert.Equal(t, 1, len(testServer.DBClasses))
+			assert.Equal(t, 20, testServer.DBClasses[0].Capacity)
+		})
+	}
+	for _, capacity := range []string{`20.5`, `"abc"`} {
+		t.Run("try create a class with capacity "+capacity, func(t *testing.T) {
+			w, errorResponse := create(capacity)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, ErrorResponse{Err: InvalidCapacity, Code: CodeInvalidCapacity}, errorResponse)
+			assert.Equal(t, 0, len(testServer.DBClasses))
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// counterVec is a counter split by the value of a single label, it is safe for concurrent use
+type counterVec struct {
+	name   string
+	help   string
+	label  string
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+func newCounterVec(name, help, label string) *counterVec {
+	return &counterVec{name: name, help: help, label: label, counts: map[string]uint64{}}
+}
+
+// inc adds one to the counter for the label value
+func (counter *counterVec) inc(value string) {
+	counter.mu.Lock()
+	counter.counts[value]++
+	counter.mu.Unlock()
+}
+
+// value returns the count for the label value
+func (counter *counterVec) value(value string) uint64 {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	return counter.counts[value]
+}
+
+// reset clears every count, it is for tests
+func (counter *counterVec) reset() {
+	counter.mu.Lock()
+	counter.counts = map[string]uint64{}
+	counter.mu.Unlock()
+}
+
+// write writes the counter in the Prometheus text exposition format, label values in sorted order
+func (counter *counterVec) write(w http.ResponseWriter) error {
+	counter.mu.Lock()
+	values := make([]string, 0, len(counter.counts))
+	for value := range counter.counts {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	counts := make([]uint64, len(values))
+	for index, value := range values {
+		counts[index] = counter.counts[value]
+	}
+	counter.mu.Unlock()
+
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", counter.name, counter.help, counter.name)
+	for index, value := range values {
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s{%s=%q} %d\n", counter.name, counter.label, value, counts[index])
+	}
+	return err
+}
+
+// the reasons createBooking counts its rejections under
+const (
+	rejectedInvalidRequest = "invalid_request"
+	rejectedClassNotFound  = "class_not_found"
+	rejectedClassFull      = "class_full"
+	rejectedNotBookable    = "not_bookable"
+	rejectedWaitlistFull   = "waitlist_full"
+	rejectedDuplicate      = "duplicate"
+	rejectedCancelled      = "class_cancelled"
+	rejectedNotYetOpen     = "not_yet_open"
+	rejectedTooLate        = "too_late"
+	rejectedTimeConflict   = "time_conflict"
+)
+
+// bookingsRejected counts the bookings createBooking turned down by why
+var bookingsRejected = newCounterVec("bookings_rejected_total", "Bookings that were rejected, by reason", "reason")
+
+// rejectionReason is the reason a rejection from checkBooking is counted under
+func rejectionReason(rejection *bookingRejection) string {
+	switch rejection.code {
+	case CodeClassIsFull:
+		return rejectedClassFull
+	case CodeClassNotBookable:
+		return rejectedNotBookable
+	case CodeWaitlistFull:
+		return rejectedWaitlistFull
+	case CodeMemberAlreadyBooked:
+		return rejectedDuplicate
+	case CodeClassCancelled:
+		return rejectedCancelled
+	case CodeBookingNotYetOpen:
+		return rejectedNotYetOpen
+	case CodeBookingTooLate:
+		return rejectedTooLate
+	case CodeMemberTimeConflict:
+		return rejectedTimeConflict
+	default:
+		return rejection.code
+	}
+}
+
+// getMetrics is the handler function for GET requests to `/metrics`, it writes the counters in the Prometheus text
+// exposition format
+func getMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	err := bookingsRejected.write(w)
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_bookingsRejected(t *testing.T) {
+	bookingsRejected.reset()
+	defer bookingsRejected.reset()
+	testServer.DBClasses = []Class{
+		{
+			Id:       "1",
+			Name:     "lifting",
+			Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+			Capacity: 1,
+			Bookings: []Booking{{MemberName: "David", Id: "a", Status: BookingConfirmed}},
+		},
+	}
+	book := func(member, className string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(BookingRequest{MemberName: member, ClassName: className, Date: "2020-12-12"})
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createBooking(w, r)
+		return w
+	}
+
+	t.Run("count rejections by reason", func(t *testing.T) {
+		assert.Equal(t, http.StatusConflict, book("Sarah", "lifting").Code)
+		assert.Equal(t, http.StatusConflict, book("Tom", "lifting").Code)
+		assert.Equal(t, http.StatusConflict, book("David", "lifting").Code)
+		assert.Equal(t, http.StatusNotFound, book("Sarah", "yoga").Code)
+
+		assert.Equal(t, uint64(2), bookingsRejected.value(rejectedClassFull))
+		assert.Equal(t, uint64(1), bookingsRejected.value(rejectedDuplicate))
+		assert.Equal(t, uint64(1), bookingsRejected.value(rejectedClassNotFound))
+		assert.Equal(t, uint64(0), bookingsRejected.value(rejectedWaitlistFull))
+	})
+	t.Run("write the counts as Prometheus text", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/metrics", nil)
+		w := httptest.NewRecorder()
+
+		getMetrics(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "# HELP bookings_rejected_total Bookings that were rejected, by reason\n"+
+			"# TYPE bookings_rejected_total counter\n"+
+			"bookings_rejected_total{reason=\"class_full\"} 2\n"+
+			"bookings_rejected_total{reason=\"class_not_found\"} 1\n"+
+			"bookings_rejected_total{reason=\"duplicate\"} 1\n", w.Body.String())
+	})
+}
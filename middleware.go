@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// requireContentType wraps a handler so POST, PUT and PATCH requests whose Content-Type isn't mediaType are rejected
+// with 415 before reaching it, parameters such as a charset are allowed
+func requireContentType(mediaType string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+			requestType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || requestType != mediaType {
+				err = errorResponse(w, CodeUnsupportedContentType, UnsupportedContentType+mediaType, http.StatusUnsupportedMediaType)
+				if err != nil {
+					logger.Error("failed to write response", "err", err)
+				}
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// requireJSON wraps a handler so writes must have an application/json body
+func requireJSON(next http.HandlerFunc) http.HandlerFunc {
+	return requireContentType("application/json", next)
+}
+
+// requireAPIKey wraps a handler so requests must carry the configured API key in the X-API-Key header, when no key is
+// configured requests are let through
+func (server *Server) requireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-Key")
+		if server.config.APIKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(server.config.APIKey)) != 1 {
+			err := errorResponse(w, CodeInvalidAPIKey, InvalidAPIKey, http.StatusUnauthorized)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireValidClassID wraps a handler so a class id in the path that the id strategy couldn't have created is rejected
+// with 400 before any class is looked up, see validID
+func (server *Server) requireValidClassID(next http.HandlerFunc) http.HandlerFunc {
+	return server.requireValidID(CodeInvalidClassID, InvalidClassID, next)
+}
+
+// requireValidBookingID is requireValidClassID for routes with a booking id in the path
+func (server *Server) requireValidBookingID(next http.HandlerFunc) http.HandlerFunc {
+	return server.requireValidID(CodeInvalidBookingID, InvalidBookingID, next)
+}
+
+// requireValidID rejects a path id that fails validID with the code and reason
+func (server *Server) requireValidID(code, reason string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !server.validID(mux.Vars(r)["id"]) {
+			err := errorResponse(w, code, reason, http.StatusBadRequest)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+		next(w, r)
+	}
+}
+
+// trimTrailingSlash wraps a handler so a path with a trailing slash is handled as if the slash wasn't there
+func trimTrailingSlash(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.URL.Path) > 1 && strings.HasSuffix(r.URL.Path, "/") {
+			r.URL.Path = strings.TrimRight(r.URL.Path, "/")
+			if r.URL.Path == "" {
+				r.URL.Path = "/"
+			}
+			r.URL.RawPath = ""
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cors wraps a handler so browsers on the configured origins can call it, answering preflight requests itself. It does
+// nothing when no origins are configured.
+func (server *Server) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || len(server.config.CORSAllowedOrigins) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if !containsString(server.config.CORSAllowedOrigins, origin) && !containsString(server.config.CORSAllowedOrigins, "*") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if containsString(server.config.CORSAllowedOrigins, "*") {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if server.config.CORSAllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			methods := server.config.CORSAllowedMethods
+			if len(methods) == 0 {
+				methods = defaultCORSAllowedMethods
+			}
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// unversionedPaths are served at the root whatever the API prefix, they are for the infrastructure rather than clients
+var unversionedPaths = map[string]bool{"/live": true, "/ready": true, "/metrics": true}
+
+// versionedRoutes serves the routes under prefix, so with `/v1` a request for `/v1/classes` is handled as `/classes`.
+// Unprefixed requests are still handled so existing clients keep working, but apart from unversionedPaths their
+// responses are marked deprecated with a Deprecation header and a Link to the prefixed path. An empty prefix serves
+// the routes at the root only.
+func versionedRoutes(prefix string, next http.Handler) http.Handler {
+	if prefix == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, prefix)
+		if path != r.URL.Path && (path == "" || path[0] == '/') {
+			if path == "" {
+				path = "/"
+			}
+			versioned := new(http.Request)
+			*versioned = *r
+			versioned.URL = new(url.URL)
+			*versioned.URL = *r.URL
+			versioned.URL.Path = path
+			versioned.URL.RawPath = ""
+			next.ServeHTTP(w, versioned)
+			return
+		}
+		if !unversionedPaths[strings.TrimRight(r.URL.Path, "/")] {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", prefix+r.URL.Path))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// concurrencySlotKey is the request context key limitConcurrency stores the release of the request's slot under
+type concurrencySlotKey struct{}
+
+// releaseConcurrencySlot gives back the request's limitConcurrency slot before the handler returns. Streams call it
+// once they are set up, an open stream isn't using the store and mustn't count against the limit for as long as a
+// client keeps it open.
+func releaseConcurrencySlot(r *http.Request) {
+	if release, ok := r.Context().Value(concurrencySlotKey{}).(func()); ok {
+		release()
+	}
+}
+
+// limitConcurrency wraps a handler so at most limit requests are handled at once, any more are turned away with 503
+// rather than queueing up on the store. The health checks are never limited so a busy server isn't restarted, and
+// streams only hold a slot until they are set up, see releaseConcurrencySlot.
+func limitConcurrency(limit int, next http.Handler) http.Handler {
+	slots := make(chan struct{}, limit)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimRight(r.URL.Path, "/") {
+		case "/live", "/ready":
+			next.ServeHTTP(w, r)
+			return
+		}
+		select {
+		case slots <- struct{}{}:
+			var once sync.Once
+			release := func() {
+				once.Do(func() { <-slots })
+			}
+			defer release()
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), concurrencySlotKey{}, release)))
+		default:
+			w.Header().Set("Retry-After", "1")
+			err := errorResponse(w, CodeServerBusy, ServerBusy, http.StatusServiceUnavailable)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+		}
+	})
+}
+
+// rejectWritesWhenReadOnly wraps a handler so requests that could change anything are turned away with 503 while the
+// server is in read-only mode, reads carry on as normal. The `/admin` routes are let through so read-only mode can be
+// turned off again, as is `/bookings/validate` which only checks a booking without making it.
+func (server *Server) rejectWritesWhenReadOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if server.readOnly.Load() && !strings.HasPrefix(r.URL.Path, "/admin/") && r.URL.Path != "/bookings/validate" {
+				err := errorResponse(w, CodeReadOnlyMode, ReadOnlyMode, http.StatusServiceUnavailable)
+				if err != nil {
+					logger.Error("failed to write response", "err", err)
+				}
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bufferedResponse holds a handler's response so it can be rewritten before being sent. Streaming handlers can't be
+// buffered, a Flush sends what is held and passes every later write straight through, and a Hijack hands over the
+// connection, either way the response is left as the handler wrote it.
+type bufferedResponse struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+	streaming  bool
+}
+
+func (b *bufferedResponse) WriteHeader(statusCode int) {
+	if b.streaming {
+		b.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	b.statusCode = statusCode
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	if b.streaming {
+		return b.ResponseWriter.Write(data)
+	}
+	return b.body.Write(data)
+}
+
+func (b *bufferedResponse) Flush() {
+	if !b.streaming {
+		b.streaming = true
+		b.ResponseWriter.WriteHeader(b.statusCode)
+		_, err := b.ResponseWriter.Write(b.body.Bytes())
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		b.body.Reset()
+	}
+	if flusher, ok := b.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (b *bufferedResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := b.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response can't be hijacked")
+	}
+	b.streaming = true
+	return hijacker.Hijack()
+}
+
+// requireKnownNaming is middleware rejecting a `naming` query parameter other than snake or camel with a 400, so
+// handlers can format their responses with namedResponse without checking it themselves
+func requireKnownNaming(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := parseNaming(r.URL.Query())
+		if err != nil {
+			err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// prettyJSON wraps a handler so GET requests with `pretty=true` get their JSON response indented for reading in a
+// terminal, responses are compact otherwise
+func prettyJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.URL.Query().Get("pretty")
+		if r.Method != http.MethodGet || value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		pretty, err := strconv.ParseBool(value)
+		if err != nil {
+			err = errorResponse(w, CodeInvalidBoolean, InvalidBoolean+"pretty", http.StatusBadRequest)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+		if !pretty {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		buffered := &bufferedResponse{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(buffered, r)
+		if buffered.streaming {
+			return
+		}
+		body := buffered.body.Bytes()
+		var indented bytes.Buffer
+		if json.Indent(&indented, body, "", "  ") == nil {
+			body = indented.Bytes()
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(buffered.statusCode)
+		_, err = w.Write(body)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+	})
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_requireJSON(t *testing.T) {
+	t.Run("accept a JSON content type with a charset", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-01", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json; charset=utf-8")
+		w := httptest.NewRecorder()
+
+		requireJSON(testServer.createClass)(w, r)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 1, len(testServer.DBClasses))
+	})
+	t.Run("try create a class with a text content type", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-01", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "text/plain")
+		w := httptest.NewRecorder()
+
+		requireJSON(testServer.createClass)(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, UnsupportedContentType+"application/json", errorResponse.Err)
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses))
+	})
+	t.Run("reads are not checked", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/classes", nil)
+		w := httptest.NewRecorder()
+
+		requireJSON(testServer.getClasses)(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func Test_trimTrailingSlash(t *testing.T) {
+	testServer.config.IDStrategy = "sequential"
+	defer func() { testServer.config.IDStrategy = "" }()
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "kayak", Date: time.Date(2006, 1, 1, 0, 0, 0, 0, time.UTC), Capacity: 20},
+	}
+	testServer.markClassesChanged()
+	router := testServer.newRouter()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("/classes and /classes/ are served the same without a redirect", func(t *testing.T) {
+		withoutSlash := get("/classes")
+		withSlash := get("/classes/")
+
+		assert.Equal(t, http.StatusOK, withoutSlash.Code)
+		assert.Equal(t, withoutSlash.Code, withSlash.Code)
+		assert.Equal(t, withoutSlash.Body.String(), withSlash.Body.String())
+	})
+	t.Run("/classes/{id} and /classes/{id}/ are served the same without a redirect", func(t *testing.T) {
+		withoutSlash := get("/classes/1")
+		withSlash := get("/classes/1/")
+
+		assert.Equal(t, http.StatusOK, withoutSlash.Code)
+		assert.Equal(t, withoutSlash.Code, withSlash.Code)
+		assert.Equal(t, withoutSlash.Body.String(), withSlash.Body.String())
+	})
+}
+
+func Test_prettyJSON(t *testing.T) {
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "kayak", Date: time.Date(2006, 1, 1, 0, 0, 0, 0, time.UTC), Capacity: 20},
+	}
+	testServer.markClassesChanged()
+	get := func(query string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/classes"+query, nil)
+		w := httptest.NewRecorder()
+		prettyJSON(http.HandlerFunc(testServer.getClasses)).ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("pretty output is indented and holds the same data", func(t *testing.T) {
+		compact := get("")
+		pretty := get("?pretty=true")
+
+		assert.Equal(t, http.StatusOK, pretty.Code)
+		assert.Equal(t, "application/json", pretty.Header().Get("Content-Type"))
+		assert.Contains(t, pretty.Body.String(), "\n  ")
+		assert.NotContains(t, compact.Body.String(), "\n  ")
+		assert.Equal(t, "20", pretty.Header().Get("X-Total-Capacity"))
+
+		var compactClasses, prettyClasses []Class
+		json.Unmarshal(compact.Body.Bytes(), &compactClasses)
+		json.Unmarshal(pretty.Body.Bytes(), &prettyClasses)
+		assert.Equal(t, compactClasses, prettyClasses)
+	})
+	t.Run("try pretty with something other than a boolean", func(t *testing.T) {
+		w := get("?pretty=very")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func Test_cors(t *testing.T) {
+	testServer.config.CORSAllowedOrigins = []string{"https://app.example.com"}
+	testServer.config.CORSAllowCredentials = true
+	defer func() {
+		testServer.config.CORSAllowedOrigins = nil
+		testServer.config.CORSAllowCredentials = false
+	}()
+	testServer.DBClasses = []Class{}
+	testServer.markClassesChanged()
+
+	t.Run("allow a credentialed request from an allowed origin", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/classes", nil)
+		r.Header.Set("Origin", "https://app.example.com")
+		w := httptest.NewRecorder()
+
+		testServer.newRouter().ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "Origin", w.Header().Get("Vary"))
+	})
+	t.Run("answer a preflight request from an allowed origin", func(t *testing.T) {
+		r, _ := http.NewRequest("OPTIONS", "/bookings", nil)
+		r.Header.Set("Origin", "https://app.example.com")
+		r.Header.Set("Access-Control-Request-Method", "POST")
+		r.Header.Set("Access-Control-Request-Headers", "Content-Type")
+		w := httptest.NewRecorder()
+
+		testServer.newRouter().ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "GET, POST, PUT, PATCH", w.Header().Get("Access-Control-Allow-Methods"))
+		assert.Equal(t, "Content-Type", w.Header().Get("Access-Control-Allow-Headers"))
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	})
+	t.Run("leave out CORS headers for other origins", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/classes", nil)
+		r.Header.Set("Origin", "https://evil.example.com")
+		w := httptest.NewRecorder()
+
+		testServer.newRouter().ServeHTTP(w, r)
+
+		assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Credentials"))
+	})
+}
+
+func Test_loadConfigCORS(t *testing.T) {
+	t.Run("load a credentialed CORS config", func(t *testing.T) {
+		t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com, https://admin.example.com")
+		t.Setenv("CORS_ALLOWED_METHODS", "GET,POST")
+		t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+
+		loaded, err := loadConfig()
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"https://app.example.com", "https://admin.example.com"}, loaded.CORSAllowedOrigins)
+		assert.Equal(t, []string{"GET", "POST"}, loaded.CORSAllowedMethods)
+		assert.True(t, loaded.CORSAllowCredentials)
+	})
+	t.Run("try load credentials with the wildcard origin", func(t *testing.T) {
+		t.Setenv("CORS_ALLOWED_ORIGINS", "*")
+		t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+
+		_, err := loadConfig()
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "CORS_ALLOW_CREDENTIALS")
+	})
+}
+
+func Test_versionedRoutes(t *testing.T) {
+	testServer.config.IDStrategy = "sequential"
+	defer func() { testServer.config.IDStrategy = "" }()
+	testServer.DBClasses = []Class{
+		{Id: "1", Name: "kayak", Date: time.Date(2006, 1, 1, 0, 0, 0, 0, time.UTC), Capacity: 20},
+	}
+	testServer.markClassesChanged()
+	defer func() { testServer.config.APIPrefix = "" }()
+	get := func(path string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		testServer.newRouter().ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("serve the routes under /v1 by default", func(t *testing.T) {
+		for _, path := range []string{"/v1/classes", "/v1/classes/", "/v1/classes/1"} {
+			w := get(path)
+
+			assert.Equal(t, http.StatusOK, w.Code, path)
+			assert.Equal(t, "", w.Header().Get("Deprecation"), path)
+		}
+	})
+	t.Run("still serve unversioned routes but mark them deprecated", func(t *testing.T) {
+		versioned := get("/v1/classes/1")
+		w := get("/classes/1")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, versioned.Body.String(), w.Body.String())
+		assert.Equal(t, "true", w.Header().Get("Deprecation"))
+		assert.Equal(t, `</v1/classes/1>; rel="successor-version"`, w.Header().Get("Link"))
+	})
+	t.Run("serve the health checks at the root without deprecating them", func(t *testing.T) {
+		w := get("/live")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "", w.Header().Get("Deprecation"))
+	})
+	t.Run("only strip the prefix as a whole path segment", func(t *testing.T) {
+		w := get("/v1classes")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+	t.Run("serve the routes under a configured prefix", func(t *testing.T) {
+		testServer.config.APIPrefix = "/api/v2/"
+
+		assert.Equal(t, http.StatusOK, get("/api/v2/classes").Code)
+		assert.Equal(t, http.StatusNotFound, get("/v1/classes").Code)
+		assert.Equal(t, `</api/v2/classes>; rel="successor-version"`, get("/classes").Header().Get("Link"))
+	})
+	t.Run("serve the routes at the root with a / prefix", func(t *testing.T) {
+		testServer.config.APIPrefix = "/"
+
+		w := get("/classes")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "", w.Header().Get("Deprecation"))
+	})
+}
+
+func Test_loadConfigAPIPrefix(t *testing.T) {
+	t.Run("load an API prefix", func(t *testing.T) {
+		t.Setenv("API_PREFIX", "/api/v2")
+
+		loaded, err := loadConfig()
+
+		assert.NoError(t, err)
+		assert.Equal(t, "/api/v2", loaded.APIPrefix)
+	})
+	t.Run("try load an API prefix without a leading slash", func(t *testing.T) {
+		t.Setenv("API_PREFIX", "v2")
+
+		_, err := loadConfig()
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "API_PREFIX")
+	})
+}
+
+func Test_limitConcurrency(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	blocking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+	handler := limitConcurrency(2, blocking)
+	send := func(path string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	done := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			send("/classes")
+			done <- struct{}{}
+		}()
+		<-started
+	}
+
+	t.Run("turn a request away while the limit is reached", func(t *testing.T) {
+		w := send("/classes")
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		assert.Equal(t, CodeServerBusy, errorResponse.Code)
+	})
+	t.Run("health checks aren't limited", func(t *testing.T) {
+		go send("/live")
+		<-started
+	})
+
+	close(release)
+	<-done
+	<-done
+	t.Run("accept requests again once the limit isn't reached", func(t *testing.T) {
+		go send("/classes")
+		<-started
+	})
+}
+
+func Test_prettyJSONStreams(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	testServer.config.IDStrategy = "sequential"
+	defer func() { testServer.config.IDStrategy = "" }()
+	testServer.DBClasses = []Class{
+		{Id: "7", Name: "kayak", Date: time.Date(2006, 1, 1, 0, 0, 0, 0, time.UTC), Capacity: 2},
+	}
+	testServer.markClassesChanged()
+	server := httptest.NewServer(testServer.newRouter())
+	defer server.Close()
+
+	t.Run("stream class events with pretty=true", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		r, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/v1/classes/7/events?pretty=true", nil)
+		response, err := http.DefaultClient.Do(r)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+		assert.Equal(t, OccupancyEvent{ClassId: "7", Capacity: 2, SpotsAvailable: 2}, readOccupancyEvent(t, bufio.NewReader(response.Body)))
+	})
+	t.Run("upgrade to a websocket with pretty=true", func(t *testing.T) {
+		conn, reader := dialWebSocket(t, server, "/v1/ws/classes?pretty=true")
+		defer conn.Close()
+
+		opcode, _ := readServerFrame(t, reader)
+		assert.Equal(t, byte(wsOpText), opcode)
+	})
+}
+
+func Test_limitConcurrencyStreams(t *testing.T) {
+	server := NewServer(Config{MaxConcurrentRequests: 2, IDStrategy: "sequential"}, fixedID("1"))
+	server.now = testClock
+	server.DBClasses = []Class{
+		{Id: "7", Name: "kayak", Date: time.Date(2006, 1, 1, 0, 0, 0, 0, time.UTC), Capacity: 2},
+	}
+	httpServer := httptest.NewServer(server.newRouter())
+	defer httpServer.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("open streams don't hold a slot once they are set up", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			r, _ := http.NewRequestWithContext(ctx, "GET", httpServer.URL+"/v1/classes/7/events", nil)
+			response, err := http.DefaultClient.Do(r)
+			if !assert.Nil(t, err) {
+				t.FailNow()
+			}
+			defer response.Body.Close()
+			assert.Equal(t, http.StatusOK, response.StatusCode)
+			readOccupancyEvent(t, bufio.NewReader(response.Body))
+		}
+		for i := 0; i < 3; i++ {
+			conn, reader := dialWebSocket(t, httpServer, "/v1/ws/classes")
+			defer conn.Close()
+			readServerFrame(t, reader)
+		}
+
+		response, err := http.Get(httpServer.URL + "/v1/classes")
+
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		response.Body.Close()
+	})
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// the field naming styles responses can be written in, snake_case is the default
+const (
+	namingSnake = "snake"
+	namingCamel = "camel"
+)
+
+// parseNaming reads the `naming` query parameter, defaulting to snake_case
+func parseNaming(query url.Values) (string, error) {
+	switch naming := query.Get("naming"); naming {
+	case "", namingSnake:
+		return namingSnake, nil
+	case namingCamel:
+		return namingCamel, nil
+	default:
+		return "", newValidationError(CodeInvalidNaming, InvalidNaming)
+	}
+}
+
+// the date formats responses can be written in, rfc3339 timestamps are the default
+const (
+	dateFormatRFC3339 = "rfc3339"
+	dateFormatDate    = "date"
+)
+
+// parseDateFormat reads the `date_format` query parameter, reporting whether dates should be written as YYYY-MM-DD
+func parseDateFormat(query url.Values) (bool, error) {
+	switch query.Get("date_format") {
+	case "", dateFormatRFC3339:
+		return false, nil
+	case dateFormatDate:
+		return true, nil
+	default:
+		return false, newValidationError(CodeInvalidDateFormat, InvalidDateFormat)
+	}
+}
+
+// CivilDate is a calendar day, it is written to JSON as YYYY-MM-DD rather than as a timestamp
+type CivilDate time.Time
+
+func (date CivilDate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Time(date).Format(layoutISO))
+}
+
+// dateOnlyClass is a Class with its date written as a CivilDate, the outer Date hides the Class's one
+type dateOnlyClass struct {
+	Class
+	Date CivilDate `json:"date"`
+}
+
+func newDateOnlyClasses(classes []Class) []dateOnlyClass {
+	dateOnly := make([]dateOnlyClass, 0, len(classes))
+	for _, class := range classes {
+		dateOnly = append(dateOnly, dateOnlyClass{Class: class, Date: CivilDate(class.Date)})
+	}
+	return dateOnly
+}
+
+// dateOnlyCamelClass is a CamelClass with its date written as a CivilDate
+type dateOnlyCamelClass struct {
+	CamelClass
+	Date CivilDate `json:"date"`
+}
+
+// formattedPageResponse is a PageResponse holding a page formatted by formatClasses, the envelope's own fields are
+// named the same in snake_case and camelCase
+type formattedPageResponse struct {
+	PageResponse
+	Data interface{} `json:"data"`
+}
+
+// formatClasses returns the classes as they are written, with camelCase field names for namingCamel and YYYY-MM-DD
+// dates when dateOnly is set
+func formatClasses(classes []Class, naming string, dateOnly bool) interface{} {
+	switch {
+	case naming == namingCamel && dateOnly:
+		formatted := make([]dateOnlyCamelClass, 0, len(classes))
+		for _, class := range classes {
+			formatted = append(formatted, dateOnlyCamelClass{CamelClass: CamelClass(class), Date: CivilDate(class.Date)})
+		}
+		return formatted
+	case naming == namingCamel:
+		return newCamelClasses(classes)
+	case dateOnly:
+		return newDateOnlyClasses(classes)
+	}
+	return classes
+}
+
+// dateOnlyClassDetail is a ClassDetail with its date written as a CivilDate
+type dateOnlyClassDetail struct {
+	ClassDetail
+	Date CivilDate `json:"date"`
+}
+
+// dateOnlyCamelClassDetail is a CamelClassDetail with its date written as a CivilDate
+type dateOnlyCamelClassDetail struct {
+	CamelClassDetail
+	Date CivilDate `json:"date"`
+}
+
+// formatClassDetail returns the detail as it is written, see formatClasses
+func formatClassDetail(detail ClassDetail, naming string, dateOnly bool) interface{} {
+	switch {
+	case naming == namingCamel && dateOnly:
+		return dateOnlyCamelClassDetail{CamelClassDetail: newCamelClassDetail(detail), Date: CivilDate(detail.Date)}
+	case naming == namingCamel:
+		return newCamelClassDetail(detail)
+	case dateOnly:
+		return dateOnlyClassDetail{ClassDetail: detail, Date: CivilDate(detail.Date)}
+	}
+	return detail
+}
+
+// CamelClass is Class with camelCase field names. It has exactly Class's fields, only the tags differ, so a Class
+// converts straight to it and a field added to Class without being added here stops CamelClass(class) compiling.
+type CamelClass struct {
+	Id              string       `json:"id"`
+	Name            string       `json:"name"`
+	Date            time.Time    `json:"date"`
+	Capacity        int          `json:"capacity"`
+	Bookings        []Booking    `json:"-"`
+	Version         int          `json:"-"`
+	MaxWaitlist     *int         `json:"maxWaitlist,omitempty"`
+	Location        string       `json:"location,omitempty"`
+	Audit           []AuditEntry `json:"-"`
+	Cancelled       bool         `json:"cancelled,omitempty"`
+	Credits         int          `json:"credits,omitempty"`
+	Holds           []Hold       `json:"-"`
+	StartTime       string       `json:"startTime,omitempty"`
+	DurationMinutes int          `json:"durationMinutes,omitempty"`
+	Deleted         bool         `json:"-"`
+	ChangeSeq       uint64       `json:"-"`
+	CreationKey     string       `json:"-"`
+}
+
+func newCamelClasses(classes []Class) []CamelClass {
+	camel := make([]CamelClass, 0, len(classes))
+	for _, class := range classes {
+		camel = append(camel, CamelClass(class))
+	}
+	return camel
+}
+
+// CamelClassDetail is ClassDetail with camelCase field names
+type CamelClassDetail struct {
+	CamelClass
+	Booked         int `json:"booked"`
+	Waitlisted     int `json:"waitlisted"`
+	Held           int `json:"held"`
+	SpotsAvailable int `json:"spotsAvailable"`
+}
+
+func newCamelClassDetail(detail ClassDetail) CamelClassDetail {
+	return CamelClassDetail{
+		CamelClass:     CamelClass(detail.Class),
+		Booked:         detail.Booked,
+		Waitlisted:     detail.Waitlisted,
+		Held:           detail.Held,
+		SpotsAvailable: detail.SpotsAvailable,
+	}
+}
+
+// CamelBooking is Booking with camelCase field names, like CamelClass it has exactly Booking's fields
+type CamelBooking struct {
+	MemberName  string    `json:"memberName"`
+	MemberEmail string    `json:"memberEmail,omitempty"`
+	Id          string    `json:"id"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+func newCamelBookings(bookings []Booking) []CamelBooking {
+	camel := make([]CamelBooking, 0, len(bookings))
+	for _, booking := range bookings {
+		camel = append(camel, CamelBooking(booking))
+	}
+	return camel
+}
+
+// CamelClassChanges is ClassChanges with camelCase field names
+type CamelClassChanges struct {
+	Classes    []CamelClass `json:"classes"`
+	DeletedIds []string     `json:"deletedIds"`
+	ChangeSeq  uint64       `json:"changeSeq"`
+}
+
+// namedResponse returns value as it is written for the request's naming. With `naming=camel` classes, class details,
+// bookings and class changes are converted to their camelCase forms, anything else is written as it is. Unknown
+// namings never get this far, requireKnownNaming rejects them.
+func namedResponse(r *http.Request, value interface{}) interface{} {
+	if naming, err := parseNaming(r.URL.Query()); err != nil || naming != namingCamel {
+		return value
+	}
+	switch value := value.(type) {
+	case Class:
+		return CamelClass(value)
+	case *Class:
+		return CamelClass(*value)
+	case []Class:
+		return newCamelClasses(value)
+	case ClassDetail:
+		return newCamelClassDetail(value)
+	case Booking:
+		return CamelBooking(value)
+	case *Booking:
+		return CamelBooking(*value)
+	case []Booking:
+		return newCamelBookings(value)
+	case ClassChanges:
+		return CamelClassChanges{Classes: newCamelClasses(value.Classes), DeletedIds: value.DeletedIds, ChangeSeq: value.ChangeSeq}
+	}
+	return value
+}
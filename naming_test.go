@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_getClassNaming(t *testing.T) {
+	maxWaitlist := 2
+	testServer.DBClasses = []Class{
+		{
+			Id:          "1",
+			Name:        "kayak",
+			Date:        time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC),
+			Capacity:    10,
+			MaxWaitlist: &maxWaitlist,
+			Bookings:    []Booking{{MemberName: "David", Id: "a", Status: BookingConfirmed}},
+		},
+	}
+	getClassKeys := func(query string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		r, _ := http.NewRequest("GET", "/classes/1"+query, nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+		testServer.getClass(w, r)
+
+		var response map[string]interface{}
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+		return w, response
+	}
+
+	t.Run("fields are snake_case by default", func(t *testing.T) {
+		w, response := getClassKeys("")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, float64(9), response["spots_available"])
+		assert.Equal(t, float64(2), response["max_waitlist"])
+		assert.NotContains(t, response, "spotsAvailable")
+	})
+	t.Run("fields are camelCase with naming=camel", func(t *testing.T) {
+		w, response := getClassKeys("?naming=camel")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, float64(9), response["spotsAvailable"])
+		assert.Equal(t, float64(2), response["maxWaitlist"])
+		assert.NotContains(t, response, "spots_available")
+	})
+	t.Run("try get a class with an unknown naming", func(t *testing.T) {
+		w, response := getClassKeys("?naming=kebab")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, InvalidNaming, response["error"])
+	})
+	t.Run("booking fields are camelCase with naming=camel", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/classes/1/bookings?naming=camel", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+		testServer.getClassBookings(w, r)
+
+		var response []map[string]interface{}
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, "David", response[0]["memberName"])
+		assert.NotContains(t, response[0], "member_name")
+	})
+}
+
+// camelTag is the camelCase form of a snake_case json tag, options like omitempty are kept
+func camelTag(tag string) string {
+	parts := strings.Split(tag, ",")
+	words := strings.Split(parts[0], "_")
+	for index := 1; index < len(words); index++ {
+		words[index] = strings.ToUpper(words[index][:1]) + words[index][1:]
+	}
+	parts[0] = strings.Join(words, "")
+	return strings.Join(parts, ",")
+}
+
+func Test_camelFieldsMatch(t *testing.T) {
+	for _, types := range [][2]reflect.Type{
+		{reflect.TypeOf(Class{}), reflect.TypeOf(CamelClass{})},
+		{reflect.TypeOf(Booking{}), reflect.TypeOf(CamelBooking{})},
+	} {
+		snake, camel := types[0], types[1]
+		t.Run(camel.Name()+" has every field of "+snake.Name()+" in camelCase", func(t *testing.T) {
+			assert.Equal(t, snake.NumField(), camel.NumField())
+			for index := 0; index < snake.NumField(); index++ {
+				field := snake.Field(index)
+				camelField, ok := camel.FieldByName(field.Name)
+				if assert.True(t, ok, field.Name) {
+					assert.Equal(t, camelTag(field.Tag.Get("json")), camelField.Tag.Get("json"), field.Name)
+				}
+			}
+		})
+	}
+}
+
+func Test_classesNaming(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	testServer.DBClasses = []Class{
+		{
+			Id: "1", Name: "kayak", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10,
+			StartTime: "09:00", DurationMinutes: 60, Cancelled: true,
+		},
+	}
+	testServer.markClassesChanged()
+	router := testServer.newRouter()
+	get := func(path string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("list classes in camelCase", func(t *testing.T) {
+		w := get("/v1/classes?naming=camel")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"startTime":"09:00","durationMinutes":60`)
+		assert.Contains(t, w.Body.String(), `"cancelled":true`)
+		assert.NotContains(t, w.Body.String(), "start_time")
+	})
+	t.Run("list a page of classes in camelCase with date only dates", func(t *testing.T) {
+		w := get("/v1/classes?naming=camel&date_format=date&limit=1")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"date":"2021-01-04"`)
+		assert.Contains(t, w.Body.String(), `"durationMinutes":60`)
+		assert.Contains(t, w.Body.String(), `"total":1`)
+	})
+	t.Run("the snake_case list is still served from the cache", func(t *testing.T) {
+		w := get("/v1/classes")
+
+		assert.Contains(t, w.Body.String(), `"start_time":"09:00"`)
+	})
+	t.Run("look up a class in camelCase", func(t *testing.T) {
+		w := get("/v1/classes/lookup?name=kayak&date=2021-01-04&naming=camel")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"spotsAvailable":10`)
+		assert.Contains(t, w.Body.String(), `"startTime":"09:00"`)
+	})
+	t.Run("try any endpoint with an unknown naming", func(t *testing.T) {
+		w := get("/v1/classes/lookup?name=kayak&date=2021-01-04&naming=kebab")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), CodeInvalidNaming)
+	})
+}
@@ -0,0 +1,13 @@
+package main
+
+// Notifier lets members know about changes to their bookings
+type Notifier interface {
+	Notify(memberName, message string)
+}
+
+// logNotifier only logs notifications, it stands in until members can be contacted directly
+type logNotifier struct{}
+
+func (logNotifier) Notify(memberName, message string) {
+	logger.Info("notified member", "member", memberName, "message", message)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// persistedClass is how a class is saved to the data file, unlike the API it keeps the bookings, version, audit log,
+// holds and whether it is deleted
+type persistedClass struct {
+	Class
+	Bookings []Booking    `json:"bookings"`
+	Version  int          `json:"version"`
+	Audit    []AuditEntry `json:"audit,omitempty"`
+	Holds    []Hold       `json:"holds,omitempty"`
+	Deleted  bool         `json:"deleted,omitempty"`
+	// ChangeSeq is kept so clients syncing from getClassChanges don't miss changes made before a restart
+	ChangeSeq uint64 `json:"change_seq,omitempty"`
+	// CreationKey is kept so a create repeated after a restart still finds the classes it made
+	CreationKey string `json:"creation_key,omitempty"`
+}
+
+// saveClasses writes the classes to path, going through a temporary file so a failed write never leaves a partly
+// written data file behind
+func saveClasses(path string, classes []Class) error {
+	persisted := make([]persistedClass, 0, len(classes))
+	for _, class := range classes {
+		persisted = append(persisted, persistedClass{
+			Class:       class,
+			Bookings:    class.Bookings,
+			Version:     class.Version,
+			Audit:       class.Audit,
+			Holds:       class.Holds,
+			Deleted:     class.Deleted,
+			ChangeSeq:   class.ChangeSeq,
+			CreationKey: class.CreationKey,
+		})
+	}
+	data, err := json.Marshal(persisted)
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// quarantinedClass is an entry of the data file that was invalid when loaded, kept with the reason so it can be fixed
+// by hand
+type quarantinedClass struct {
+	Reason string          `json:"reason"`
+	Class  json.RawMessage `json:"class"`
+}
+
+// loadClasses reads the classes saved at path, a missing file is an empty store. Entries that can't be parsed, reuse
+// an id or have more confirmed bookings than capacity are invalid, with STRICT_LOAD they fail the load otherwise they
+// are left out and written to path.quarantine.
+func loadClasses(path string, strict bool) ([]Class, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []Class{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []json.RawMessage
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse data file %s: %w", path, err)
+	}
+	classes := make([]Class, 0, len(entries))
+	seen := make(map[string]bool)
+	var quarantined []quarantinedClass
+	for index, entry := range entries {
+		var saved persistedClass
+		reason := invalidPersistedClass(entry, &saved, seen)
+		if reason != "" && strict {
+			return nil, fmt.Errorf("data file %s class %d is invalid: %s", path, index+1, reason)
+		}
+		if reason != "" {
+			quarantined = append(quarantined, quarantinedClass{Reason: reason, Class: entry})
+			continue
+		}
+		seen[saved.Id] = true
+
+		class := saved.Class
+		class.Bookings = saved.Bookings
+		class.Version = saved.Version
+		class.Audit = saved.Audit
+		class.Holds = saved.Holds
+		class.Deleted = saved.Deleted
+		class.ChangeSeq = saved.ChangeSeq
+		class.CreationKey = saved.CreationKey
+		classes = append(classes, class)
+	}
+
+	if len(quarantined) > 0 {
+		data, err = json.Marshal(quarantined)
+		if err == nil {
+			err = os.WriteFile(path+".quarantine", data, 0o644)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not quarantine invalid classes from %s: %w", path, err)
+		}
+		logger.Warn("quarantined invalid classes", "path", path+".quarantine", "count", len(quarantined))
+	}
+	return classes, nil
+}
+
+// invalidPersistedClass parses entry into saved, returning why it is invalid or "" when it is fine. seen holds the
+// ids of the classes already loaded.
+func invalidPersistedClass(entry json.RawMessage, saved *persistedClass, seen map[string]bool) string {
+	err := json.Unmarshal(entry, saved)
+	if err != nil {
+		return fmt.Sprintf("could not parse: %v", err)
+	}
+	if saved.Id == "" {
+		return "missing id"
+	}
+	if seen[saved.Id] {
+		return fmt.Sprintf("duplicate id %s", saved.Id)
+	}
+	confirmed := 0
+	for _, booking := range saved.Bookings {
+		if booking.Status == BookingConfirmed {
+			confirmed++
+		}
+	}
+	if confirmed > saved.Capacity {
+		return fmt.Sprintf("%d confirmed bookings is more than the capacity of %d", confirmed, saved.Capacity)
+	}
+	return ""
+}
+
+// probeDataFile checks that saveClasses would be able to write path by creating and removing a file next to it
+func probeDataFile(path string) error {
+	probe, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".probe-*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// highestChangeSeq returns the largest change sequence of the classes, so the Server's sequence can carry on after it
+func highestChangeSeq(classes []Class) uint64 {
+	var highest uint64
+	for _, class := range classes {
+		if class.ChangeSeq > highest {
+			highest = class.ChangeSeq
+		}
+	}
+	return highest
+}
+
+// highestSequentialID returns the largest numeric class or booking id, so sequential ids can carry on after it
+func highestSequentialID(classes []Class) uint64 {
+	var highest uint64
+	consider := func(id string) {
+		if number, err := strconv.ParseUint(id, 10, 64); err == nil && number > highest {
+			highest = number
+		}
+	}
+	for _, class := range classes {
+		consider(class.Id)
+		for _, booking := range class.Bookings {
+			consider(booking.Id)
+		}
+		for _, hold := range class.Holds {
+			consider(hold.Id)
+		}
+	}
+	return highest
+}
+
+var (
+	// errNotSaved is returned by commitChanges when changes couldn't be saved and PERSIST_FAILURE_POLICY rolled them
+	// back
+	errNotSaved = errors.New(NotSaved)
+	// errMemoryOnly is returned by commitChanges when changes couldn't be saved but are kept in memory
+	errMemoryOnly = errors.New("changes are kept in memory only")
+)
+
+// rollbackPoint copies DBClasses, with dbLock held for writing, before a change so commitChanges can put them back if
+// the change can't be saved. It's nil unless persistence is enabled with the rollback PERSIST_FAILURE_POLICY.
+func (server *Server) rollbackPoint() []Class {
+	if server.config.DataFile == "" || server.config.PersistFailurePolicy != persistRollback {
+		return nil
+	}
+	classes := make([]Class, 0, len(server.DBClasses))
+	for index := range server.DBClasses {
+		classes = append(classes, snapshotClass(&server.DBClasses[index]))
+	}
+	return classes
+}
+
+// commitChanges calls markClassesChanged for the changed classes and applies PERSIST_FAILURE_POLICY when they can't be
+// saved. With a snapshot from rollbackPoint DBClasses is put back as it was and errNotSaved returned, otherwise the
+// changes are kept and errMemoryOnly returned.
+func (server *Server) commitChanges(snapshot []Class, changed ...*Class) error {
+	err := server.markClassesChanged(changed...)
+	if err == nil {
+		return nil
+	}
+	if snapshot == nil {
+		return errMemoryOnly
+	}
+	server.DBClasses = snapshot
+	server.classesCache = nil
+	return errNotSaved
+}
+
+// changesKept writes the outcome of commitChanges to the response, changes kept in memory only are marked with
+// `X-Durability: memory-only` and rolled back ones are answered with a 500. It reports whether the changes were kept so
+// the handler can go on to write its response.
+func changesKept(w http.ResponseWriter, err error) bool {
+	if err == errMemoryOnly {
+		w.Header().Set("X-Durability", "memory-only")
+	}
+	if err != errNotSaved {
+		return true
+	}
+	err = errorResponse(w, CodeNotSaved, NotSaved, http.StatusInternalServerError)
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_saveAndLoadClasses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "classes.json")
+	maxWaitlist := 2
+	classes := []Class{
+		{
+			Id:          "1",
+			Name:        "kayak",
+			Date:        time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC),
+			Capacity:    10,
+			Version:     3,
+			MaxWaitlist: &maxWaitlist,
+			Bookings:    []Booking{{MemberName: "David", Id: "7", Status: BookingConfirmed, CreatedAt: time.Date(2021, 1, 1, 9, 0, 0, 0, time.UTC)}},
+			Audit:       []AuditEntry{{Timestamp: time.Date(2021, 1, 1, 9, 0, 0, 0, time.UTC), Action: AuditBooked, MemberName: "David", BookingId: "7"}},
+		},
+	}
+
+	t.Run("saved classes load back the same", func(t *testing.T) {
+		err := saveClasses(path, classes)
+		assert.Nil(t, err)
+
+		loaded, err := loadClasses(path, false)
+
+		assert.Nil(t, err)
+		assert.Equal(t, classes, loaded)
+		assert.Equal(t, uint64(7), highestSequentialID(loaded))
+	})
+	t.Run("a missing data file is an empty store", func(t *testing.T) {
+		loaded, err := loadClasses(filepath.Join(t.TempDir(), "missing.json"), false)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []Class{}, loaded)
+	})
+	t.Run("try load a corrupt data file", func(t *testing.T) {
+		os.WriteFile(path, []byte("not json"), 0o644)
+
+		_, err := loadClasses(path, false)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func Test_loadClassesValidation(t *testing.T) {
+	duplicated := `[` +
+		`{"id":"1","name":"kayak","date":"2021-01-04T00:00:00Z","capacity":10,"bookings":[],"version":1},` +
+		`{"id":"1","name":"yoga","date":"2021-01-05T00:00:00Z","capacity":10,"bookings":[],"version":1},` +
+		`{"id":"2","name":"lifting","date":"2021-01-06T00:00:00Z","capacity":10,"bookings":[],"version":1}]`
+
+	t.Run("strict loading fails on a duplicate id", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "classes.json")
+		os.WriteFile(path, []byte(duplicated), 0o644)
+
+		_, err := loadClasses(path, true)
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "duplicate id 1")
+		_, err = os.Stat(path + ".quarantine")
+		assert.True(t, os.IsNotExist(err))
+	})
+	t.Run("lenient loading quarantines a duplicate id", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "classes.json")
+		os.WriteFile(path, []byte(duplicated), 0o644)
+
+		loaded, err := loadClasses(path, false)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"1", "2"}, classIDs(loaded))
+		assert.Equal(t, "kayak", loaded[0].Name)
+
+		var quarantined []quarantinedClass
+		data, _ := os.ReadFile(path + ".quarantine")
+		json.Unmarshal(data, &quarantined)
+		assert.Equal(t, 1, len(quarantined))
+		assert.Equal(t, "duplicate id 1", quarantined[0].Reason)
+		assert.Contains(t, string(quarantined[0].Class), "yoga")
+	})
+	t.Run("lenient loading quarantines overbooked classes and unparseable dates", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "classes.json")
+		os.WriteFile(path, []byte(`[`+
+			`{"id":"1","name":"kayak","date":"2021-01-04T00:00:00Z","capacity":1,"bookings":[`+
+			`{"member_name":"David","id":"7","status":"confirmed"},{"member_name":"Sarah","id":"8","status":"confirmed"}]},`+
+			`{"id":"2","name":"yoga","date":"04/01/2021","capacity":10},`+
+			`{"id":"3","name":"lifting","date":"2021-01-06T00:00:00Z","capacity":10}]`), 0o644)
+
+		loaded, err := loadClasses(path, false)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"3"}, classIDs(loaded))
+	})
+}
+
+func Test_persistFailurePolicy(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	// the data file's directory doesn't exist so every save fails
+	testServer.config.DataFile = filepath.Join(t.TempDir(), "missing", "classes.json")
+	defer func() { testServer.config = Config{} }()
+	book := func() *httptest.ResponseRecorder {
+		testServer.DBClasses = []Class{
+			{Id: "1", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 10},
+		}
+		body := []byte(`{"member_name": "David","class_name": "lifting","date": "2020-12-12"}`)
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createBooking(w, r)
+		return w
+	}
+
+	t.Run("keep a booking that can't be saved in memory only", func(t *testing.T) {
+		testServer.config.PersistFailurePolicy = persistMemoryOnly
+
+		w := book()
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "memory-only", w.Header().Get("X-Durability"))
+		assert.Equal(t, 1, len(testServer.DBClasses[0].Bookings))
+	})
+	t.Run("roll back a booking that can't be saved", func(t *testing.T) {
+		testServer.config.PersistFailurePolicy = persistRollback
+
+		w := book()
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, CodeNotSaved, errorResponse.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses[0].Bookings))
+		assert.Equal(t, 0, len(testServer.DBClasses[0].Audit))
+	})
+	t.Run("roll back a cancellation that can't be saved", func(t *testing.T) {
+		testServer.config.PersistFailurePolicy = persistRollback
+		testServer.DBClasses = []Class{{
+			Id: "1", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 10,
+			Bookings: []Booking{{MemberName: "David", Id: "a", Status: BookingConfirmed}},
+		}}
+		r, _ := http.NewRequest("POST", "/bookings/a/cancel", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "a"})
+		w := httptest.NewRecorder()
+		testServer.cancelBooking(w, r)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, BookingConfirmed, testServer.DBClasses[0].Bookings[0].Status)
+		assert.Equal(t, 0, len(testServer.DBClasses[0].Audit))
+	})
+	t.Run("roll back a class that can't be saved", func(t *testing.T) {
+		testServer.config.PersistFailurePolicy = persistRollback
+		testServer.DBClasses = []Class{}
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-01-02", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createClass(w, r)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses))
+	})
+	t.Run("keep a transfer that can't be saved in memory only", func(t *testing.T) {
+		testServer.config.PersistFailurePolicy = persistMemoryOnly
+		testServer.DBClasses = []Class{{
+			Id: "1", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 10,
+			Bookings: []Booking{{MemberName: "David", Id: "a", Status: BookingConfirmed}},
+		}}
+		r, _ := http.NewRequest("POST", "/bookings/a/transfer", bytes.NewReader([]byte(`{"member_name": "Sarah"}`)))
+		r = mux.SetURLVars(r, map[string]string{"id": "a"})
+		w := httptest.NewRecorder()
+		testServer.transferBooking(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "memory-only", w.Header().Get("X-Durability"))
+		assert.Equal(t, "Sarah", testServer.DBClasses[0].Bookings[0].MemberName)
+	})
+	t.Run("keep expired holds that can't be swept away", func(t *testing.T) {
+		testServer.config.PersistFailurePolicy = persistRollback
+		testServer.DBClasses = []Class{{
+			Id: "1", Name: "lifting", Date: time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC), Capacity: 10,
+			Holds: []Hold{{Id: "h1", MemberName: "Tom", ExpiresAt: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		}}
+
+		assert.Equal(t, 0, testServer.sweepExpiredHolds())
+		assert.Equal(t, 1, len(testServer.DBClasses[0].Holds))
+	})
+	t.Run("a booking that is saved isn't marked memory-only", func(t *testing.T) {
+		testServer.config.DataFile = filepath.Join(t.TempDir(), "classes.json")
+
+		w := book()
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "", w.Header().Get("X-Durability"))
+	})
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recurrence is the subset of an RFC 5545 RRULE classes can be created from: FREQ of DAILY, WEEKLY or MONTHLY with
+// optional INTERVAL, BYDAY (weekly only), COUNT and UNTIL. Rules using any other part of RFC 5545 are rejected with
+// an error naming the part rather than being misread, see rruleUnsupportedParts.
+type recurrence struct {
+	frequency string
+	interval  int
+	weekdays  []time.Weekday
+	count     int
+	until     time.Time
+}
+
+// rruleWeekdays maps the two letter RRULE day names to weekdays
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// rruleUnsupportedParts are the RFC 5545 rule parts recurrence doesn't implement
+var rruleUnsupportedParts = map[string]bool{
+	"BYSECOND": true, "BYMINUTE": true, "BYHOUR": true, "BYMONTHDAY": true, "BYYEARDAY": true, "BYWEEKNO": true,
+	"BYMONTH": true, "BYSETPOS": true, "WKST": true,
+}
+
+// parseRRule parses a rule such as `FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10`, an optional `RRULE:` prefix is allowed. A rule
+// that isn't RFC 5545 fails with CodeInvalidRRule, one using a part of RFC 5545 that isn't supported fails with
+// CodeUnsupportedRRule and the part in the message.
+func parseRRule(rule string) (recurrence, error) {
+	invalid := newValidationError(CodeInvalidRRule, InvalidRRule)
+	unsupported := func(part string) error {
+		return newValidationError(CodeUnsupportedRRule, UnsupportedRRule+part)
+	}
+	rec := recurrence{interval: 1}
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+	for _, part := range strings.Split(rule, ";") {
+		key, value, found := strings.Cut(part, "=")
+		if !found || value == "" {
+			return recurrence{}, invalid
+		}
+		var err error
+		key = strings.ToUpper(key)
+		if rruleUnsupportedParts[key] {
+			return recurrence{}, unsupported(key)
+		}
+		switch key {
+		case "FREQ":
+			rec.frequency = strings.ToUpper(value)
+			switch rec.frequency {
+			case "DAILY", "WEEKLY", "MONTHLY":
+			case "SECONDLY", "MINUTELY", "HOURLY", "YEARLY":
+				return recurrence{}, unsupported("FREQ=" + rec.frequency)
+			default:
+				return recurrence{}, invalid
+			}
+		case "INTERVAL":
+			rec.interval, err = strconv.Atoi(value)
+			if err != nil || rec.interval < 1 {
+				return recurrence{}, invalid
+			}
+		case "COUNT":
+			rec.count, err = strconv.Atoi(value)
+			if err != nil || rec.count < 1 {
+				return recurrence{}, invalid
+			}
+		case "UNTIL":
+			// only the date of an UNTIL such as 20210131T000000Z matters as classes are whole days
+			if len(value) < 8 {
+				return recurrence{}, invalid
+			}
+			rec.until, err = time.Parse("20060102", value[:8])
+			if err != nil {
+				return recurrence{}, invalid
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				day = strings.ToUpper(day)
+				weekday, ok := rruleWeekdays[day]
+				if !ok && len(day) > 2 {
+					// days with an ordinal, like 1MO for the first Monday, are valid but not supported
+					_, isDay := rruleWeekdays[day[len(day)-2:]]
+					if _, err = strconv.Atoi(day[:len(day)-2]); err == nil && isDay {
+						return recurrence{}, unsupported("BYDAY=" + day)
+					}
+				}
+				if !ok {
+					return recurrence{}, invalid
+				}
+				rec.weekdays = append(rec.weekdays, weekday)
+			}
+		default:
+			return recurrence{}, invalid
+		}
+	}
+	if rec.frequency == "" {
+		return recurrence{}, invalid
+	}
+	if rec.weekdays != nil && rec.frequency != "WEEKLY" {
+		return recurrence{}, unsupported("BYDAY with FREQ=" + rec.frequency)
+	}
+	return rec, nil
+}
+
+// dates returns the days the rule falls on from startDate up to endDate, both inclusive, stopping early at the rule's
+// COUNT or UNTIL. More than maxClassesPerRequest days is errTooManyClasses.
+func (rec recurrence) dates(startDate, endDate time.Time) ([]time.Time, error) {
+	if !rec.until.IsZero() && rec.until.Before(endDate) {
+		endDate = rec.until
+	}
+	var dates []time.Time
+	add := func(date time.Time) bool {
+		if date.Before(startDate) {
+			return true
+		}
+		if date.After(endDate) || (rec.count > 0 && len(dates) == rec.count) {
+			return false
+		}
+		dates = append(dates, date)
+		return len(dates) <= maxClassesPerRequest
+	}
+
+	switch rec.frequency {
+	case "DAILY":
+		for date := startDate; ; date = date.AddDate(0, 0, rec.interval) {
+			if !add(date) {
+				break
+			}
+		}
+	case "WEEKLY":
+		weekdays := rec.weekdays
+		if weekdays == nil {
+			weekdays = []time.Weekday{startDate.Weekday()}
+		}
+		// weeks start on Monday as RRULE's default WKST
+		weekStart := startDate.AddDate(0, 0, -((int(startDate.Weekday()) + 6) % 7))
+	weeks:
+		for ; ; weekStart = weekStart.AddDate(0, 0, 7*rec.interval) {
+			for offset := 0; offset < 7; offset++ {
+				date := weekStart.AddDate(0, 0, offset)
+				if containsWeekday(weekdays, date.Weekday()) && !add(date) {
+					break weeks
+				}
+			}
+		}
+	case "MONTHLY":
+		for months := 0; ; months += rec.interval {
+			date := startDate.AddDate(0, months, 0)
+			// months without the start's day of the month are skipped, as RFC 5545 requires
+			if date.Day() != startDate.Day() {
+				if date.After(endDate) {
+					break
+				}
+				continue
+			}
+			if !add(date) {
+				break
+			}
+		}
+	}
+
+	if len(dates) > maxClassesPerRequest {
+		return nil, errTooManyClasses
+	}
+	return dates, nil
+}
+
+func containsWeekday(weekdays []time.Weekday, weekday time.Weekday) bool {
+	for _, day := range weekdays {
+		if day == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// newClassesOnDates makes a copy of template for each date, each with a new id and no bookings
+func (server *Server) newClassesOnDates(ctx context.Context, template Class, dates []time.Time) ([]Class, error) {
+	var classes []Class
+	for _, date := range dates {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		class := template
+		class.Id = server.ids.NewID()
+		class.Date = date
+		class.Bookings = nil
+		class.Audit = nil
+		class.Holds = nil
+		class.Cancelled = false
+		class.Version = 1
+		classes = append(classes, class)
+	}
+	return classes, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_createClassRRule(t *testing.T) {
+	t.Cleanup(resetTestServer)
+	create := func(body string) *httptest.ResponseRecorder {
+		testServer.DBClasses = []Class{}
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader([]byte(body)))
+		w := httptest.NewRecorder()
+		testServer.createClass(w, r)
+		return w
+	}
+	dates := func(classes []Class) []string {
+		var dates []string
+		for _, class := range classes {
+			dates = append(dates, class.Date.Format(layoutISO))
+		}
+		return dates
+	}
+
+	t.Run("create classes from a weekly rule", func(t *testing.T) {
+		// 2021-01-04 is a Monday
+		w := create(`{"name": "kayak","start_date": "2021-01-04","end_date": "2021-01-31", "capacity": 20,
+			"rrule": "FREQ=WEEKLY;BYDAY=MO,TH"}`)
+
+		var response []Class
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, []string{
+			"2021-01-04", "2021-01-07", "2021-01-11", "2021-01-14",
+			"2021-01-18", "2021-01-21", "2021-01-25", "2021-01-28",
+		}, dates(response))
+	})
+	t.Run("create classes from a fortnightly rule with a count", func(t *testing.T) {
+		w := create(`{"name": "kayak","start_date": "2021-01-06","end_date": "2021-12-31", "capacity": 20,
+			"rrule": "RRULE:FREQ=WEEKLY;INTERVAL=2;COUNT=3"}`)
+
+		var response []Class
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, []string{"2021-01-06", "2021-01-20", "2021-02-03"}, dates(response))
+	})
+	t.Run("try create classes from an invalid rule", func(t *testing.T) {
+		w := create(`{"name": "kayak","start_date": "2021-01-04","end_date": "2021-01-31", "capacity": 20,
+			"rrule": "FREQ=FORTNIGHTLY"}`)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, InvalidRRule, errorResponse.Err)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses))
+	})
+	for rule, part := range map[string]string{
+		"FREQ=MONTHLY;BYMONTHDAY=15":           "BYMONTHDAY",
+		"FREQ=MONTHLY;BYDAY=MO,TU;BYSETPOS=-1": "BYSETPOS",
+		"FREQ=YEARLY":                          "FREQ=YEARLY",
+		"FREQ=WEEKLY;BYDAY=1MO":                "BYDAY=1MO",
+		"FREQ=MONTHLY;BYDAY=SU":                "BYDAY with FREQ=MONTHLY",
+	} {
+		t.Run("try create classes from a valid rule using "+part, func(t *testing.T) {
+			w := create(`{"name": "kayak","start_date": "2021-01-04","end_date": "2021-01-31", "capacity": 20,
+				"rrule": "` + rule + `"}`)
+
+			var errorResponse ErrorResponse
+			respBody, _ := ioutil.ReadAll(w.Body)
+			json.Unmarshal(respBody, &errorResponse)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, ErrorResponse{Err: UnsupportedRRule + part, Code: CodeUnsupportedRRule}, errorResponse)
+			assert.Equal(t, 0, len(testServer.DBClasses))
+		})
+	}
+	t.Run("try create more classes from a rule than allowed", func(t *testing.T) {
+		w := create(`{"name": "kayak","start_date": "2021-01-01","end_date": "2022-12-31", "capacity": 20,
+			"rrule": "FREQ=DAILY"}`)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, TooManyClasses, errorResponse.Err)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	t.Run("try create more classes from a date range than allowed", func(t *testing.T) {
+		w := create(`{"name": "kayak","start_date": "2021-01-01","end_date": "2022-12-31", "capacity": 20}`)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, TooManyClasses, errorResponse.Err)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, 0, len(testServer.DBClasses))
+	})
+}
+
+func Test_recurrenceDates(t *testing.T) {
+	start := time.Date(2021, 1, 31, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2021, 6, 30, 0, 0, 0, 0, time.UTC)
+
+	t.Run("monthly rule skips months without the day", func(t *testing.T) {
+		rule, err := parseRRule("FREQ=MONTHLY;UNTIL=20210531T000000Z")
+		assert.Nil(t, err)
+
+		dates, err := rule.dates(start, end)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []time.Time{
+			start,
+			time.Date(2021, 3, 31, 0, 0, 0, 0, time.UTC),
+			time.Date(2021, 5, 31, 0, 0, 0, 0, time.UTC),
+		}, dates)
+	})
+	t.Run("try parse rules with unsupported parts", func(t *testing.T) {
+		for _, rule := range []string{"", "FREQ=WEEKLY;BYDAY=XX", "FREQ=DAILY;BYDAY=MO", "FREQ=DAILY;BYHOUR=9", "COUNT=2"} {
+			_, err := parseRRule(rule)
+			assert.NotNil(t, err, rule)
+		}
+	})
+}
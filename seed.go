@@ -0,0 +1,51 @@
+package main
+
+// demoClasses are the sample classes seedDemoData creates, each runs on the given number of days from today
+var demoClasses = []struct {
+	name     string
+	days     int
+	capacity int
+	location string
+	members  []string
+}{
+	{name: "yoga", days: 1, capacity: 10, location: "Studio 1", members: []string{"David", "Sarah"}},
+	{name: "spin", days: 1, capacity: 2, location: "Studio 2", members: []string{"Tom", "Priya", "Alex"}},
+	{name: "pilates", days: 2, capacity: 8, location: "Studio 1"},
+	{name: "kayak", days: 3, capacity: 6, location: "Lake", members: []string{"Sarah"}},
+}
+
+// seedDemoData fills DBClasses with a few sample classes and bookings so there is something to look at when developing,
+// it does nothing when the store already holds classes. Ids come from the server's IDGenerator and bookings beyond a class's capacity
+// are waitlisted. It reports whether any classes were added.
+func (server *Server) seedDemoData() bool {
+	server.dbLock.Lock()
+	defer server.dbLock.Unlock()
+	if len(server.DBClasses) > 0 {
+		return false
+	}
+
+	snapshot := server.rollbackPoint()
+	for _, demo := range demoClasses {
+		class := Class{
+			Id:       server.ids.NewID(),
+			Name:     demo.name,
+			Date:     server.today().AddDate(0, 0, demo.days),
+			Capacity: demo.capacity,
+			Version:  1,
+			Location: demo.location,
+		}
+		for _, member := range demo.members {
+			status := BookingConfirmed
+			if class.isFull(server.now()) {
+				status = BookingWaitlisted
+			}
+			class.addBooking(Booking{MemberName: member, Id: server.ids.NewID(), Status: status, CreatedAt: server.now()})
+		}
+		server.DBClasses = append(server.DBClasses, class)
+	}
+	if server.commitChanges(snapshot, server.lastClasses(len(demoClasses))...) == errNotSaved {
+		return false
+	}
+	logger.Info("seeded demo data", "classes", len(demoClasses))
+	return true
+}
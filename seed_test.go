@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_seedDemoData(t *testing.T) {
+	t.Run("seed an empty store", func(t *testing.T) {
+		server := NewServer(Config{}, sequentialIDsAfter(0))
+		server.now = func() time.Time { return time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC) }
+
+		assert.True(t, server.seedDemoData())
+
+		assert.Equal(t, []string{"1", "4", "8", "9"}, classIDs(server.DBClasses))
+		assert.Equal(t, "yoga", server.DBClasses[0].Name)
+		assert.Equal(t, time.Date(2021, 3, 2, 0, 0, 0, 0, time.UTC), server.DBClasses[0].Date)
+		assert.Equal(t, []Booking{
+			{MemberName: "Tom", Id: "5", Status: BookingConfirmed, CreatedAt: server.now()},
+			{MemberName: "Priya", Id: "6", Status: BookingConfirmed, CreatedAt: server.now()},
+			{MemberName: "Alex", Id: "7", Status: BookingWaitlisted, CreatedAt: server.now()},
+		}, server.DBClasses[1].Bookings)
+		assert.Equal(t, 0, len(server.DBClasses[2].Bookings))
+	})
+	t.Run("don't seed a store that already has classes", func(t *testing.T) {
+		testServer.DBClasses = []Class{{Id: "existing", Name: "lifting"}}
+
+		assert.False(t, testServer.seedDemoData())
+
+		assert.Equal(t, []string{"existing"}, classIDs(testServer.DBClasses))
+	})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IDGenerator creates the ids of new classes, bookings and holds. Handlers call NewID from concurrent requests so
+// implementations must be safe for concurrent use.
+type IDGenerator interface {
+	NewID() string
+}
+
+// uuidIDs generates random UUIDs, it is the default IDGenerator
+type uuidIDs struct{}
+
+func (uuidIDs) NewID() string {
+	return uuid.New().String()
+}
+
+// sequentialIDs generates increasing numbers, each one after the last it returned
+type sequentialIDs struct {
+	last uint64
+}
+
+func (ids *sequentialIDs) NewID() string {
+	return strconv.FormatUint(atomic.AddUint64(&ids.last, 1), 10)
+}
+
+// newIDGenerator returns the IDGenerator for the strategy, uuid generates random UUIDs and sequential generates
+// increasing numbers starting from 1
+func newIDGenerator(strategy string) (IDGenerator, error) {
+	switch strategy {
+	case "", "uuid":
+		return uuidIDs{}, nil
+	case "sequential":
+		return sequentialIDsAfter(0), nil
+	default:
+		return nil, fmt.Errorf("unknown id strategy %q, should be one of uuid or sequential", strategy)
+	}
+}
+
+// sequentialIDsAfter returns a generator of increasing numbers starting after last, so ids carry on from those loaded
+// from the data file
+func sequentialIDsAfter(last uint64) IDGenerator {
+	return &sequentialIDs{last: last}
+}
+
+// Server holds the classes, configuration, clock and id generator the handlers share. Each Server is independent of
+// any other so tests can run against their own, main builds one and serves its routes.
+type Server struct {
+	// config is the configuration the handlers read from
+	config Config
+	// ids creates the ids of new classes, bookings and holds
+	ids IDGenerator
+	// now returns the current time, handlers read the clock through it so tests can freeze it, see withFrozenTime
+	now func() time.Time
+	// store is the ClassStore classes are listed and created through, by default a memoryStore backed by DBClasses
+	store ClassStore
+
+	// instead of reading and writing to a database im just going to keep track of classes in this slice
+	DBClasses []Class
+	// dbLock guards DBClasses, the bookings inside it and classesCache. Handlers hold it for as long as they use a
+	// pointer returned by one of the find functions.
+	dbLock sync.RWMutex
+	// classesCache holds the serialized list of all of DBClasses so getClasses doesn't re-encode an unchanged list,
+	// it's nil whenever DBClasses has changed since it was last built
+	classesCache *classList
+	// events are the subscribers to each class's occupancy, see getClassEvents
+	events classEvents
+	// classListChanges are the subscribers to changes to DBClasses, see getClassesWebSocket
+	classListChanges classListSubscribers
+	// changeSeq is bumped, under dbLock, every time a class or its bookings change, see markClassesChanged
+	changeSeq uint64
+	// readOnly is set while the server is in read-only mode, see rejectWritesWhenReadOnly
+	readOnly atomic.Bool
+	// ready is set once main has finished starting up, until then the readiness check fails
+	ready atomic.Bool
+	// notifier is how handlers contact members, tests can replace it to see what was sent
+	notifier Notifier
+}
+
+// NewServer returns a Server with no classes reading the config and creating ids with ids, nil uses random UUIDs
+func NewServer(config Config, ids IDGenerator) *Server {
+	if ids == nil {
+		ids = uuidIDs{}
+	}
+	server := &Server{config: config, ids: ids, now: time.Now, DBClasses: make([]Class, 0), notifier: logNotifier{}}
+	server.store = memoryStore{server: server}
+	server.readOnly.Store(config.ReadOnly)
+	return server
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// prefixedIDs is an IDGenerator numbering ids after a prefix
+type prefixedIDs struct {
+	prefix string
+	mu     sync.Mutex
+	next   int
+}
+
+func (ids *prefixedIDs) NewID() string {
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+	ids.next++
+	return fmt.Sprintf("%s-%d", ids.prefix, ids.next)
+}
+
+func Test_serverIDGenerator(t *testing.T) {
+	t.Run("create classes, bookings and holds with an injected generator", func(t *testing.T) {
+		server := NewServer(Config{}, &prefixedIDs{prefix: "gym"})
+		server.now = testClock
+
+		body := []byte(`{"name": "kayak", "start_date": "2006-01-01", "end_date": "2006-01-02", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		server.createClass(w, r)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		body, _ = json.Marshal(BookingRequest{MemberName: "David", ClassName: "kayak", Date: "2006-01-01"})
+		r, _ = http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w = httptest.NewRecorder()
+		server.createBooking(w, r)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		r, _ = http.NewRequest("POST", "/classes/gym-2/holds", bytes.NewReader([]byte(`{"member_name": "Sarah"}`)))
+		r = mux.SetURLVars(r, map[string]string{"id": "gym-2"})
+		w = httptest.NewRecorder()
+		server.createHold(w, r)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		assert.Equal(t, []string{"gym-1", "gym-2"}, classIDs(server.DBClasses))
+		assert.Equal(t, "gym-3", server.DBClasses[0].Bookings[0].Id)
+		assert.Equal(t, "gym-4", server.DBClasses[1].Holds[0].Id)
+	})
+	t.Run("servers without a generator create uuids", func(t *testing.T) {
+		server := NewServer(Config{}, nil)
+		server.DBClasses = []Class{{Id: "1", Name: "kayak", Date: time.Date(2006, 1, 1, 0, 0, 0, 0, time.UTC), Capacity: 20}}
+
+		body, _ := json.Marshal(BookingRequest{MemberName: "David", ClassName: "kayak", Date: "2006-01-01"})
+		r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		server.createBooking(w, r)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		_, err := uuid.Parse(server.DBClasses[0].Bookings[0].Id)
+		assert.Nil(t, err)
+	})
+	t.Run("sequential ids are unique across goroutines", func(t *testing.T) {
+		ids := sequentialIDsAfter(0)
+		created := make(chan string, 100)
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				created <- ids.NewID()
+			}()
+		}
+		wg.Wait()
+		close(created)
+
+		seen := map[string]bool{}
+		for id := range created {
+			seen[id] = true
+		}
+		assert.Equal(t, 100, len(seen))
+		assert.Equal(t, "101", ids.NewID())
+	})
+}
+
+func Test_serversAreIndependent(t *testing.T) {
+	first := NewServer(Config{}, &prefixedIDs{prefix: "first"})
+	second := NewServer(Config{CancelCutoffHours: 2}, &prefixedIDs{prefix: "second"})
+	first.now = testClock
+	second.now = func() time.Time { return time.Date(2006, 1, 1, 23, 0, 0, 0, time.UTC) }
+
+	var wg sync.WaitGroup
+	for _, server := range []*Server{first, second} {
+		wg.Add(1)
+		go func(server *Server) {
+			defer wg.Done()
+			body := []byte(`{"name": "kayak", "start_date": "2006-01-01", "end_date": "2006-01-01", "capacity": 1}`)
+			r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			server.createClass(w, r)
+			assert.Equal(t, http.StatusCreated, w.Code)
+		}(server)
+	}
+	wg.Wait()
+
+	body, _ := json.Marshal(BookingRequest{MemberName: "David", ClassName: "kayak", Date: "2006-01-01"})
+	r, _ := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	first.createBooking(w, r)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	assert.Equal(t, []string{"first-1"}, classIDs(first.DBClasses))
+	assert.Equal(t, []string{"second-1"}, classIDs(second.DBClasses))
+	assert.Equal(t, 1, len(first.DBClasses[0].Bookings))
+	assert.Equal(t, 0, len(second.DBClasses[0].Bookings))
+	assert.Equal(t, time.Date(2006, 1, 1, 0, 0, 0, 0, time.UTC), second.today())
+	assert.Equal(t, 0, first.config.CancelCutoffHours)
+
+	second.readOnly.Store(true)
+	r, _ = http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	first.newRouter().ServeHTTP(w, r)
+	assert.NotEqual(t, http.StatusServiceUnavailable, w.Code)
+	assert.False(t, first.readOnly.Load())
+	r, _ = http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	second.newRouter().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
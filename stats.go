@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClassStats is the bookings and capacity of every class sharing a name, CreditsBooked is the credits the confirmed
+// bookings cost
+type ClassStats struct {
+	Name          string `json:"name"`
+	Classes       int    `json:"classes"`
+	TotalBookings int    `json:"total_bookings"`
+	TotalCapacity int    `json:"total_capacity"`
+	CreditsBooked int    `json:"credits_booked"`
+}
+
+// parseStatsRange reads the optional `from` and `to` dates bounding a stats query, a zero time leaves that end open
+func parseStatsRange(query url.Values) (from, to time.Time, err error) {
+	if value := query.Get("from"); value != "" {
+		from, err = time.Parse(layoutISO, value)
+		if err != nil {
+			return from, to, newValidationError(CodeInvalidDate, InvalidDate)
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		to, err = time.Parse(layoutISO, value)
+		if err != nil {
+			return from, to, newValidationError(CodeInvalidDate, InvalidDate)
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && from.After(to) {
+		return from, to, newValidationError(CodeInvalidDateRange, InvalidDateRange)
+	}
+	return from, to, nil
+}
+
+// getClassStats is the handler function for GET requests to `/classes/stats`, it will write to ResponseWriter the
+// number of classes, confirmed bookings and capacity for each class name, sorted by name. Only classes between the
+// optional `from` and `to` dates, inclusive, are counted and names are grouped case-insensitively.
+func (server *Server) getClassStats(w http.ResponseWriter, r *http.Request) {
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy != "" && groupBy != "name" {
+		err := errorResponse(w, CodeInvalidGroupBy, InvalidGroupBy, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	from, to, err := parseStatsRange(r.URL.Query())
+	if err != nil {
+		err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	server.dbLock.RLock()
+	byName := make(map[string]*ClassStats)
+	stats := make([]*ClassStats, 0)
+	for index := range server.DBClasses {
+		class := &server.DBClasses[index]
+		if class.Deleted {
+			continue
+		}
+		if (!from.IsZero() && class.Date.Before(from)) || (!to.IsZero() && class.Date.After(to)) {
+			continue
+		}
+		key := strings.ToLower(class.Name)
+		if byName[key] == nil {
+			byName[key] = &ClassStats{Name: class.Name}
+			stats = append(stats, byName[key])
+		}
+		byName[key].Classes++
+		byName[key].TotalBookings += class.countBookings(BookingConfirmed)
+		byName[key].TotalCapacity += class.Capacity
+		byName[key].CreditsBooked += class.countBookings(BookingConfirmed) * class.Credits
+	}
+	server.dbLock.RUnlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		return strings.ToLower(stats[i].Name) < strings.ToLower(stats[j].Name)
+	})
+
+	logger.Debug("listed class stats", "count", len(stats))
+	err = json.NewEncoder(w).Encode(stats)
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// maxReportDays is the most days apart the from and to dates of a report can be
+const maxReportDays = 366
+
+// WeeklyReport is the classes, capacity and confirmed bookings of an ISO week such as 2021-W01. FillRate is the
+// bookings as a fraction of the capacity, the average fill rate of the week's classes weighted by their capacity.
+type WeeklyReport struct {
+	Week          string  `json:"week"`
+	Classes       int     `json:"classes"`
+	TotalCapacity int     `json:"total_capacity"`
+	TotalBookings int     `json:"total_bookings"`
+	FillRate      float64 `json:"fill_rate"`
+}
+
+// getWeeklyReport is the handler function for GET requests to `/reports/weekly`, it will write to ResponseWriter a
+// WeeklyReport for each ISO week with classes between the `from` and `to` dates, inclusive, in date order. Cancelled
+// classes are left out as they can't be booked.
+func (server *Server) getWeeklyReport(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseStatsRange(r.URL.Query())
+	if err == nil && (from.IsZero() || to.IsZero() || to.Sub(from) > maxReportDays*24*time.Hour) {
+		err = newValidationError(CodeInvalidReportRange, InvalidReportRange)
+	}
+	if err != nil {
+		err = errorResponse(w, errorCode(err), err.Error(), http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+
+	server.dbLock.RLock()
+	byWeek := make(map[string]*WeeklyReport)
+	reports := make([]*WeeklyReport, 0)
+	for index := range server.DBClasses {
+		class := &server.DBClasses[index]
+		if class.Deleted || class.Cancelled || class.Date.Before(from) || class.Date.After(to) {
+			continue
+		}
+		year, week := class.Date.ISOWeek()
+		key := fmt.Sprintf("%d-W%02d", year, week)
+		if byWeek[key] == nil {
+			byWeek[key] = &WeeklyReport{Week: key}
+			reports = append(reports, byWeek[key])
+		}
+		byWeek[key].Classes++
+		byWeek[key].TotalCapacity += class.Capacity
+		byWeek[key].TotalBookings += class.countBookings(BookingConfirmed)
+	}
+	server.dbLock.RUnlock()
+
+	// ISO week keys sort in date order
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Week < reports[j].Week
+	})
+	for _, report := range reports {
+		if report.TotalCapacity > 0 {
+			report.FillRate = float64(report.TotalBookings) / float64(report.TotalCapacity)
+		}
+	}
+
+	logger.Debug("built weekly report", "weeks", len(reports))
+	err = json.NewEncoder(w).Encode(reports)
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// defaultAlertThreshold is the fill rate at which getClassAlerts reports a class when no threshold is given
+const defaultAlertThreshold = 0.8
+
+// ClassAlert is an upcoming class that is nearly full, FillRate is its confirmed bookings as a fraction of its
+// capacity
+type ClassAlert struct {
+	Id       string    `json:"id"`
+	Name     string    `json:"name"`
+	Date     time.Time `json:"date"`
+	Capacity int       `json:"capacity"`
+	Booked   int       `json:"booked"`
+	FillRate float64   `json:"fill_rate"`
+}
+
+// getClassAlerts is the handler function for GET requests to `/classes/alerts`, it will write to ResponseWriter the
+// upcoming classes whose fill rate is at least the `threshold`, 0.8 by default, fullest first. Cancelled classes and
+// classes with no capacity are left out.
+func (server *Server) getClassAlerts(w http.ResponseWriter, r *http.Request) {
+	threshold := defaultAlertThreshold
+	if value := r.URL.Query().Get("threshold"); value != "" {
+		var err error
+		threshold, err = strconv.ParseFloat(value, 64)
+		// written so NaN is rejected too
+		if err != nil || !(threshold >= 0 && threshold <= 1) {
+			err = errorResponse(w, CodeInvalidThreshold, InvalidThreshold, http.StatusBadRequest)
+			if err != nil {
+				logger.Error("failed to write response", "err", err)
+			}
+			return
+		}
+	}
+
+	startOfToday := server.today()
+	server.dbLock.RLock()
+	alerts := make([]ClassAlert, 0)
+	for _, class := range applyClassFilters(server.DBClasses, nil) {
+		if class.Cancelled || class.Capacity <= 0 || class.Date.Before(startOfToday) {
+			continue
+		}
+		booked := class.countBookings(BookingConfirmed)
+		fillRate := float64(booked) / float64(class.Capacity)
+		if fillRate >= threshold {
+			alerts = append(alerts, ClassAlert{
+				Id:       class.Id,
+				Name:     class.Name,
+				Date:     class.Date,
+				Capacity: class.Capacity,
+				Booked:   booked,
+				FillRate: fillRate,
+			})
+		}
+	}
+	server.dbLock.RUnlock()
+
+	// classes equally full are listed in date order
+	sort.SliceStable(alerts, func(i, j int) bool {
+		if alerts[i].FillRate != alerts[j].FillRate {
+			return alerts[i].FillRate > alerts[j].FillRate
+		}
+		return alerts[i].Date.Before(alerts[j].Date)
+	})
+
+	logger.Debug("found class alerts", "threshold", threshold, "count", len(alerts))
+	err := json.NewEncoder(w).Encode(alerts)
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// unspecifiedReason is the reason cancellations without one are counted under
+const unspecifiedReason = "unspecified"
+
+// CancellationReason is how many bookings were cancelled for a reason
+type CancellationReason struct {
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+}
+
+// getCancellationReport is the handler function for GET requests to `/reports/cancellations`, it will write to
+// ResponseWriter how many bookings were cancelled for each reason in the audit logs, most common first. Reasons are
+// grouped case-insensitively, bookings cancelled along with their class are counted as "class cancelled" and those
+// cancelled without a reason as "unspecified".
+func (server *Server) getCancellationReport(w http.ResponseWriter, r *http.Request) {
+	server.dbLock.RLock()
+	byReason := make(map[string]*CancellationReason)
+	reasons := make([]*CancellationReason, 0)
+	for index := range server.DBClasses {
+		class := &server.DBClasses[index]
+		if class.Deleted {
+			continue
+		}
+		for _, entry := range class.Audit {
+			if entry.Action != AuditCancelled {
+				continue
+			}
+			reason := entry.Reason
+			if reason == "" {
+				reason = unspecifiedReason
+			}
+			key := strings.ToLower(reason)
+			if byReason[key] == nil {
+				byReason[key] = &CancellationReason{Reason: reason}
+				reasons = append(reasons, byReason[key])
+			}
+			byReason[key].Count++
+		}
+	}
+	server.dbLock.RUnlock()
+
+	sort.SliceStable(reasons, func(i, j int) bool {
+		if reasons[i].Count != reasons[j].Count {
+			return reasons[i].Count > reasons[j].Count
+		}
+		return reasons[i].Reason < reasons[j].Reason
+	})
+
+	logger.Debug("built cancellation report", "reasons", len(reasons))
+	err := json.NewEncoder(w).Encode(reasons)
+	if err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_getClassStats(t *testing.T) {
+	testServer.DBClasses = []Class{
+		{
+			Id: "1", Name: "kayak", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10,
+			Bookings: []Booking{
+				{MemberName: "David", Id: "a", Status: BookingConfirmed},
+				{MemberName: "Sarah", Id: "b", Status: BookingCancelled},
+			},
+		},
+		{
+			Id: "2", Name: "yoga", Date: time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC), Capacity: 5,
+			Bookings: []Booking{{MemberName: "Tom", Id: "c", Status: BookingConfirmed}},
+		},
+		{
+			Id: "3", Name: "Kayak", Date: time.Date(2021, 1, 6, 0, 0, 0, 0, time.UTC), Capacity: 8,
+			Bookings: []Booking{
+				{MemberName: "David", Id: "d", Status: BookingConfirmed},
+				{MemberName: "Priya", Id: "e", Status: BookingConfirmed},
+			},
+		},
+		{Id: "4", Name: "kayak", Date: time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), Capacity: 10},
+	}
+	getStats := func(query string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/classes/stats"+query, nil)
+		w := httptest.NewRecorder()
+		testServer.getClassStats(w, r)
+		return w
+	}
+
+	t.Run("aggregate classes by name over a date range", func(t *testing.T) {
+		w := getStats("?group_by=name&from=2021-01-01&to=2021-01-31")
+
+		var response []ClassStats
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &response)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []ClassStats{
+			{Name: "kayak", Classes: 2, TotalBookings: 3, TotalCapacity: 18},
+			{Name: "yoga", Classes: 1, TotalBookings: 1, TotalCapacity: 5},
+		}, response)
+	})
+	t.Run("try get stats with a malformed date", func(t *testing.T) {
+		w := getStats("?from=2021-13-01")
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, InvalidDate, errorResponse.Err)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	t.Run("try get stats with from after to", func(t *testing.T) {
+		w := getStats("?from=2021-02-01&to=2021-01-01")
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, InvalidDateRange, errorResponse.Err)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	t.Run("try get stats grouped by something other than name", func(t *testing.T) {
+		w := getStats("?group_by=location")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func Test_getClassStatsCredits(t *testing.T) {
+	testServer.DBClasses = []Class{
+		{
+			Id: "1", Name: "kayak", Date: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Capacity: 10, Credits: 3,
+			Bookings: []Booking{
+				{MemberName: "David", Id: "a", Status: BookingConfirmed},
+				{MemberName: "Sarah", Id: "b", Status: BookingConfirmed},
+				{MemberName: "Tom", Id: "c", Status: BookingCancelled},
+				{MemberName: "Priya", Id: "d", Status: BookingWaitlisted},
+			},
+		},
+		{
+			Id: "2", Name: "kayak", Date: time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC), Capacity: 10, Credits: 2,
+			Bookings: []Booking{{MemberName: "David", Id: "e", Status: BookingConfirmed}},
+		},
+		{
+			Id: "3", Name: "yoga", Date: time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC), Capacity: 5,
+			Bookings: []Booking{{MemberName: "Tom", Id: "f", Status: BookingConfirmed}},
+		},
+	}
+
+	t.Run("sum the credits of confirmed bookings", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/classes/stats", nil)
+		w := httptest.NewRecorder()
+		testServer.getClassStats(w, r)
+
+		var response []ClassStats
+		json.Unmarshal(w.Body.Bytes(), &response)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []ClassStats{
+			{Name: "kayak", Classes: 2, TotalBookings: 3, TotalCapacity: 20, CreditsBooked: 8},
+			{Name: "yoga", Classes: 1, TotalBookings: 1, TotalCapacity: 5, CreditsBooked: 0},
+		}, response)
+	})
+}
+
+func Test_getWeeklyReport(t *testing.T) {
+	booked := func(count int) []Booking {
+		bookings := make([]Booking, 0, count)
+		for i := 0; i < count; i++ {
+			bookings = append(bookings, Booking{MemberName: "member", Id: strconv.Itoa(i), Status: BookingConfirmed})
+		}
+		return bookings
+	}
+	testServer.DBClasses = []Class{
+		// Sunday 2021-01-10 ends ISO week 1, Monday 2021-01-11 starts week 2
+		{Id: "1", Name: "kayak", Date: time.Date(2021, 1, 8, 0, 0, 0, 0, time.UTC), Capacity: 10, Bookings: booked(5)},
+		{Id: "2", Name: "yoga", Date: time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC), Capacity: 10, Bookings: booked(10)},
+		{Id: "3", Name: "kayak", Date: time.Date(2021, 1, 11, 0, 0, 0, 0, time.UTC), Capacity: 8, Bookings: booked(2)},
+		{Id: "4", Name: "kayak", Date: time.Date(2021, 1, 12, 0, 0, 0, 0, time.UTC), Capacity: 5, Cancelled: true},
+		{Id: "5", Name: "kayak", Date: time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), Capacity: 10},
+	}
+	getReport := func(query string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/reports/weekly"+query, nil)
+		w := httptest.NewRecorder()
+		testServer.getWeeklyReport(w, r)
+		return w
+	}
+
+	t.Run("bucket classes spanning two ISO weeks", func(t *testing.T) {
+		w := getReport("?from=2021-01-04&to=2021-01-17")
+
+		var response []WeeklyReport
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []WeeklyReport{
+			{Week: "2021-W01", Classes: 2, TotalCapacity: 20, TotalBookings: 15, FillRate: 0.75},
+			{Week: "2021-W02", Classes: 1, TotalCapacity: 8, TotalBookings: 2, FillRate: 0.25},
+		}, response)
+	})
+	t.Run("try get a report without a to date", func(t *testing.T) {
+		w := getReport("?from=2021-01-04")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	t.Run("try get a report over too long a range", func(t *testing.T) {
+		w := getReport("?from=2021-01-01&to=2022-01-03")
+
+		var errorResponse ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, InvalidReportRange, errorResponse.Err)
+	})
+}
+
+func Test_getClassAlerts(t *testing.T) {
+	withFrozenTime(t, time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC), func() {
+		day := func(d int) time.Time { return time.Date(2021, 1, d, 0, 0, 0, 0, time.UTC) }
+		booked := func(count int) []Booking {
+			bookings := make([]Booking, 0, count)
+			for i := 0; i < count; i++ {
+				bookings = append(bookings, Booking{MemberName: "member" + strconv.Itoa(i), Status: BookingConfirmed})
+			}
+			return bookings
+		}
+		testServer.DBClasses = []Class{
+			{Id: "1", Name: "yoga", Date: day(5), Capacity: 10, Bookings: booked(8)},
+			{Id: "2", Name: "kayak", Date: day(6), Capacity: 10, Bookings: booked(5)},
+			{Id: "3", Name: "spin", Date: day(7), Capacity: 4, Bookings: booked(4)},
+			{Id: "4", Name: "pilates", Date: day(8), Capacity: 10, Bookings: booked(7)},
+			{Id: "5", Name: "lifting", Date: day(3), Capacity: 2, Bookings: booked(2)},
+			{Id: "6", Name: "boxing", Date: day(9), Capacity: 2, Bookings: booked(2), Cancelled: true},
+			{Id: "7", Name: "yoga", Date: day(4), Capacity: 10, Bookings: booked(8)},
+		}
+		alerts := func(query string) (*httptest.ResponseRecorder, []ClassAlert) {
+			r, _ := http.NewRequest("GET", "/classes/alerts"+query, nil)
+			w := httptest.NewRecorder()
+			testServer.getClassAlerts(w, r)
+
+			var response []ClassAlert
+			json.Unmarshal(w.Body.Bytes(), &response)
+			return w, response
+		}
+		alertIDs := func(alerts []ClassAlert) []string {
+			ids := make([]string, 0, len(alerts))
+			for _, alert := range alerts {
+				ids = append(ids, alert.Id)
+			}
+			return ids
+		}
+
+		t.Run("list upcoming classes at or above the threshold fullest first", func(t *testing.T) {
+			w, response := alerts("?threshold=0.8")
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, []string{"3", "7", "1"}, alertIDs(response))
+			assert.Equal(t, 1.0, response[0].FillRate)
+			assert.Equal(t, 8, response[1].Booked)
+		})
+		t.Run("list with the default threshold", func(t *testing.T) {
+			_, response := alerts("")
+
+			assert.Equal(t, []string{"3", "7", "1"}, alertIDs(response))
+		})
+		t.Run("list with a lower threshold", func(t *testing.T) {
+			_, response := alerts("?threshold=0.5")
+
+			assert.Equal(t, []string{"3", "7", "1", "4", "2"}, alertIDs(response))
+		})
+		for _, threshold := range []string{"1.5", "-0.1", "high", "NaN"} {
+			t.Run("try list with a threshold of "+threshold, func(t *testing.T) {
+				w, _ := alerts("?threshold=" + threshold)
+
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+			})
+		}
+	})
+}
+
+func Test_getCancellationReport(t *testing.T) {
+	testServer.DBClasses = []Class{
+		{
+			Id:       "1",
+			Name:     "lifting",
+			Date:     time.Date(2020, 12, 12, 0, 0, 0, 0, time.UTC),
+			Capacity: 10,
+			Bookings: []Booking{
+				{MemberName: "David", Id: "a", Status: BookingConfirmed},
+				{MemberName: "Sarah", Id: "b", Status: BookingConfirmed},
+				{MemberName: "Tom", Id: "c", Status: BookingConfirmed},
+				{MemberName: "Priya", Id: "d", Status: BookingConfirmed},
+			},
+		},
+		{
+			Id:       "2",
+			Name:     "yoga",
+			Date:     time.Date(2020, 12, 13, 0, 0, 0, 0, time.UTC),
+			Capacity: 10,
+			Bookings: []Booking{{MemberName: "Alex", Id: "e", Status: BookingConfirmed}},
+		},
+	}
+	cancel := func(id, body string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("POST", "/bookings/"+id+"/cancel", strings.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"id": id})
+		w := httptest.NewRecorder()
+		testServer.cancelBooking(w, r)
+		return w
+	}
+
+	t.Run("record the reason a booking was cancelled", func(t *testing.T) {
+		w := cancel("a", `{"reason": " Injured "}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		entry := testServer.DBClasses[0].Audit[len(testServer.DBClasses[0].Audit)-1]
+		assert.Equal(t, AuditCancelled, entry.Action)
+		assert.Equal(t, "Injured", entry.Reason)
+	})
+	t.Run("cancel a booking without a reason", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, cancel("b", "").Code)
+		assert.Equal(t, http.StatusOK, cancel("c", `{}`).Code)
+		assert.Equal(t, "", testServer.DBClasses[0].Audit[len(testServer.DBClasses[0].Audit)-1].Reason)
+	})
+	t.Run("try cancel a booking with too long a reason", func(t *testing.T) {
+		w := cancel("d", `{"reason": "`+strings.Repeat("a", maxCancelReasonLength+1)+`"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), CodeInvalidCancelReason)
+		assert.Equal(t, BookingConfirmed, testServer.DBClasses[0].Bookings[3].Status)
+	})
+	t.Run("report cancellations by reason", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, cancel("d", `{"reason": "injured"}`).Code)
+		r, _ := http.NewRequest("POST", "/classes/2/cancel", nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "2"})
+		testServer.cancelClass(httptest.NewRecorder(), r)
+
+		r, _ = http.NewRequest("GET", "/reports/cancellations", nil)
+		w := httptest.NewRecorder()
+		testServer.getCancellationReport(w, r)
+
+		var response []CancellationReason
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []CancellationReason{
+			{Reason: "Injured", Count: 2},
+			{Reason: unspecifiedReason, Count: 2},
+			{Reason: classCancelledReason, Count: 1},
+		}, response)
+	})
+}
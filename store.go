@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// ClassStore is the storage used to list and create classes. Every method takes the request's context so that work for
+// a cancelled or timed out request is abandoned rather than run to completion. Only listing and creating go through it,
+// bookings, updates, cancellations and deletes still work on the Server's DBClasses directly under dbLock, so they
+// would have to move onto ClassStore before a store other than memoryStore could be plugged in.
+type ClassStore interface {
+	// ListClasses returns the classes matching every filter
+	ListClasses(ctx context.Context, filters []classFilter) ([]Class, error)
+	// AddClasses stores the classes and returns the ones stored. A class whose name already exists on its date fails
+	// the whole call with errClassExists, unless skipExisting is set in which case it is left out. A class on a date that
+	// already has MAX_SESSIONS_PER_DAY classes with its name fails the whole call with errTooManySessions, and one
+	// too close to another class in its location fails it with the error from roomConflict. Classes that can't be saved
+	// fail it with errNotSaved, or are returned along with errMemoryOnly, see commitChanges.
+	AddClasses(ctx context.Context, classes []Class, skipExisting bool) ([]Class, error)
+}
+
+// errClassExists is returned by AddClasses when a class already exists with the same name on the same date
+var errClassExists = errors.New(ClassAlreadyExists)
+
+// errTooManySessions is returned by AddClasses when a date already has as many classes with the name as are allowed
+var errTooManySessions = errors.New(TooManySessions)
+
+// memoryStore is the ClassStore backed by a Server's DBClasses
+type memoryStore struct {
+	server *Server
+}
+
+func (store memoryStore) ListClasses(ctx context.Context, filters []classFilter) ([]Class, error) {
+	store.server.dbLock.RLock()
+	defer store.server.dbLock.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	classes := applyClassFilters(store.server.DBClasses, filters)
+	// the bookings and holds are copied so callers can read them after the lock is released
+	for index := range classes {
+		classes[index].Bookings = append([]Booking(nil), classes[index].Bookings...)
+		classes[index].Holds = append([]Hold(nil), classes[index].Holds...)
+	}
+	return classes, nil
+}
+
+func (store memoryStore) AddClasses(ctx context.Context, classes []Class, skipExisting bool) ([]Class, error) {
+	store.server.dbLock.Lock()
+	defer store.server.dbLock.Unlock()
+
+	added := make([]Class, 0, len(classes))
+	for _, class := range classes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if store.server.classExists(class.Name, class.Date) {
+			if skipExisting {
+				continue
+			}
+			return nil, errClassExists
+		}
+		if store.server.sessionsFull(class.Name, class.Date) {
+			return nil, errTooManySessions
+		}
+		err := store.server.roomConflict(class, store.server.DBClasses)
+		if err == nil {
+			// classes in the same call can't clash with each other either
+			err = store.server.roomConflict(class, added)
+		}
+		if err != nil {
+			return nil, err
+		}
+		added = append(added, class)
+	}
+	snapshot := store.server.rollbackPoint()
+	store.server.DBClasses = append(store.server.DBClasses, added...)
+	err := store.server.commitChanges(snapshot, store.server.lastClasses(len(added))...)
+	if err == errNotSaved {
+		return nil, err
+	}
+	return added, err
+}
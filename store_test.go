@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// cancelAfterContext reports itself as cancelled once Err has been called more than `after` times
+type cancelAfterContext struct {
+	context.Context
+	calls int
+	after int
+}
+
+func (ctx *cancelAfterContext) Err() error {
+	ctx.calls++
+	if ctx.calls > ctx.after {
+		return context.Canceled
+	}
+	return nil
+}
+
+func Test_createClassCancelled(t *testing.T) {
+	t.Run("cancelling the request stops a long range part way through", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+		ctx := &cancelAfterContext{Context: context.Background(), after: 10}
+
+		// a year, as long as a range can be, see maxClassesPerRequest
+		body := []byte(`{"name": "kayak","start_date": "2006-01-01","end_date": "2006-12-31", "capacity": 20}`)
+		r, _ := http.NewRequestWithContext(ctx, "POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		testServer.createClass(w, r)
+
+		var errorResponse ErrorResponse
+		respBody, _ := ioutil.ReadAll(w.Body)
+		json.Unmarshal(respBody, &errorResponse)
+
+		assert.Equal(t, RequestCancelled, errorResponse.Err)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		// the loop gave up on the first check after cancellation rather than generating the whole year
+		assert.Equal(t, 11, ctx.calls)
+		assert.Equal(t, 0, len(testServer.DBClasses))
+	})
+	t.Run("an already cancelled context stores nothing", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := testServer.store.AddClasses(ctx, []Class{{Id: "1", Name: "kayak"}}, false)
+
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, 0, len(testServer.DBClasses))
+	})
+}
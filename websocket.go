@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// the WebSocket opcodes the server sends and understands, see RFC 6455 section 5.2
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// the close status codes sent to a client that breaks the protocol, see RFC 6455 section 7.4.1
+const (
+	wsCloseProtocolError = 1002
+	wsCloseMessageTooBig = 1009
+)
+
+// wsAcceptGUID is appended to the client's key to work out the handshake's accept value
+const wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxWebSocketMessage is the largest message read from a client, however many frames it is split over. The server only
+// expects control frames from them.
+const maxWebSocketMessage = 1 << 16
+
+// maxControlPayload is the most a ping, pong or close frame can carry
+const maxControlPayload = 125
+
+var (
+	errWebSocketFrameTooLarge = errors.New("websocket frame too large")
+	// errWebSocketProtocol is returned for a frame RFC 6455 doesn't allow a client to send
+	errWebSocketProtocol = errors.New("websocket protocol error")
+)
+
+// wsConn is the server side of a WebSocket connection. Writes hold writeMu so the frames of concurrent writers, such
+// as a pong and a pushed update, can't interleave.
+type wsConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+}
+
+// isWebSocketUpgrade reports whether the request asks to be upgraded to a version 13 WebSocket
+func isWebSocketUpgrade(r *http.Request) bool {
+	return r.Method == http.MethodGet &&
+		headerHasToken(r.Header, "Connection", "upgrade") &&
+		headerHasToken(r.Header, "Upgrade", "websocket") &&
+		r.Header.Get("Sec-WebSocket-Version") == "13" &&
+		r.Header.Get("Sec-WebSocket-Key") != ""
+}
+
+// webSocketOriginAllowed is the CheckOrigin for WebSocket upgrades. Browsers always send an Origin, a request without
+// one doesn't come from a page and is let through. Otherwise the origin has to be the server's own host or one of
+// CORS_ALLOWED_ORIGINS, so a page on another site can't open a socket with the visitor's credentials.
+func (server *Server) webSocketOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if containsString(server.config.CORSAllowedOrigins, origin) || containsString(server.config.CORSAllowedOrigins, "*") {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(parsed.Host, r.Host)
+}
+
+// headerHasToken reports whether the comma separated header lists token, ignoring case
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeWebSocket completes the WebSocket handshake for a request isWebSocketUpgrade accepts and takes over its
+// connection
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("response writer can't be hijacked")
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	accept := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + wsAcceptGUID))
+	_, err = fmt.Fprintf(buffered, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(accept[:]))
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, reader: buffered.Reader}, nil
+}
+
+// writeFrame sends payload as a single unmasked frame
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	header := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		header = append(header, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(len(payload)))
+	}
+	_, err := ws.conn.Write(append(header, payload...))
+	return err
+}
+
+// readFrame reads the next frame from the client, unmasking its payload. fin is set on the last frame of a message.
+// Frames a client can't send, unmasked ones, ones with reserved bits or opcodes and fragmented or oversized control
+// frames, fail with errWebSocketProtocol.
+func (ws *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	_, err = io.ReadFull(ws.reader, header[:])
+	if err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0F
+	length := uint64(header[1] & 0x7F)
+	control := opcode&0x8 != 0
+	switch {
+	case header[0]&0x70 != 0, header[1]&0x80 == 0:
+		return false, 0, nil, errWebSocketProtocol
+	case control && (!fin || length > maxControlPayload):
+		return false, 0, nil, errWebSocketProtocol
+	case opcode > wsOpBinary && opcode < wsOpClose, opcode > wsOpPong:
+		return false, 0, nil, errWebSocketProtocol
+	}
+	switch length {
+	case 126:
+		var extended [2]byte
+		_, err = io.ReadFull(ws.reader, extended[:])
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		_, err = io.ReadFull(ws.reader, extended[:])
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if err != nil {
+		return false, 0, nil, err
+	}
+	if length > maxWebSocketMessage {
+		return false, 0, nil, errWebSocketFrameTooLarge
+	}
+	var mask [4]byte
+	_, err = io.ReadFull(ws.reader, mask[:])
+	if err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	_, err = io.ReadFull(ws.reader, payload)
+	if err != nil {
+		return false, 0, nil, err
+	}
+	for index := range payload {
+		payload[index] ^= mask[index%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// readUntilClosed reads frames from the client until it closes the connection or goes away, answering pings and
+// ignoring the messages it sends. Control frames can come between the fragments of a message. A client that breaks the
+// protocol or sends a message over maxWebSocketMessage is sent a close frame saying why.
+func (ws *wsConn) readUntilClosed() {
+	// inMessage is set between the first and last frames of a fragmented message, messageSize counts what has arrived
+	inMessage, messageSize := false, 0
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		switch {
+		case err != nil:
+		case opcode == wsOpPing:
+			err = ws.writeFrame(wsOpPong, payload)
+		case opcode == wsOpPong:
+		case opcode == wsOpClose:
+			ws.writeFrame(wsOpClose, nil)
+			return
+		case (opcode == wsOpContinuation) != inMessage:
+			// a continuation has to follow the start of a message, and a new message can't start until it has ended
+			err = errWebSocketProtocol
+		default:
+			messageSize += len(payload)
+			if messageSize > maxWebSocketMessage {
+				err = errWebSocketFrameTooLarge
+			}
+			inMessage = !fin
+			if fin {
+				messageSize = 0
+			}
+		}
+		if err != nil {
+			ws.closeWithError(err)
+			return
+		}
+	}
+}
+
+// closeWithError sends the close frame for a protocol error or oversized message from readFrame, other errors mean
+// the connection has gone so nothing is sent
+func (ws *wsConn) closeWithError(err error) {
+	var status uint16
+	switch err {
+	case errWebSocketProtocol:
+		status = wsCloseProtocolError
+	case errWebSocketFrameTooLarge:
+		status = wsCloseMessageTooBig
+	default:
+		return
+	}
+	ws.writeFrame(wsOpClose, binary.BigEndian.AppendUint16(nil, status))
+}
+
+// close closes the underlying connection
+func (ws *wsConn) close() error {
+	return ws.conn.Close()
+}
+
+// classListSubscribers is the registry of who wants to know when DBClasses changes, it is safe for concurrent use.
+// Each subscriber's channel holds at most one pending change so a burst of changes is pushed as a single update.
+type classListSubscribers struct {
+	mu          sync.Mutex
+	subscribers map[chan struct{}]struct{}
+}
+
+// subscribe returns a channel that receives whenever DBClasses changes until it is unsubscribed
+func (changes *classListSubscribers) subscribe() chan struct{} {
+	changes.mu.Lock()
+	defer changes.mu.Unlock()
+	if changes.subscribers == nil {
+		changes.subscribers = make(map[chan struct{}]struct{})
+	}
+	subscriber := make(chan struct{}, 1)
+	changes.subscribers[subscriber] = struct{}{}
+	return subscriber
+}
+
+// unsubscribe stops telling subscriber about changes
+func (changes *classListSubscribers) unsubscribe(subscriber chan struct{}) {
+	changes.mu.Lock()
+	defer changes.mu.Unlock()
+	delete(changes.subscribers, subscriber)
+}
+
+// subscriberCount returns how many subscribers there are
+func (changes *classListSubscribers) subscriberCount() int {
+	changes.mu.Lock()
+	defer changes.mu.Unlock()
+	return len(changes.subscribers)
+}
+
+// notify tells every subscriber DBClasses has changed without waiting on any of them
+func (changes *classListSubscribers) notify() {
+	changes.mu.Lock()
+	defer changes.mu.Unlock()
+	for subscriber := range changes.subscribers {
+		select {
+		case subscriber <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// getClassesWebSocket is the handler function for WebSocket upgrade requests to `/ws/classes`. It sends the list of
+// classes as getClasses writes it, as a text message, straight away and again whenever DBClasses changes until the
+// client closes the connection. Upgrades from an Origin webSocketOriginAllowed turns down get 403.
+func (server *Server) getClassesWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !isWebSocketUpgrade(r) {
+		err := errorResponse(w, CodeWebSocketRequired, WebSocketRequired, http.StatusBadRequest)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	if !server.webSocketOriginAllowed(r) {
+		err := errorResponse(w, CodeOriginNotAllowed, OriginNotAllowed, http.StatusForbidden)
+		if err != nil {
+			logger.Error("failed to write response", "err", err)
+		}
+		return
+	}
+	subscriber := server.classListChanges.subscribe()
+	defer server.classListChanges.unsubscribe(subscriber)
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		logger.Error("failed to upgrade to a websocket", "err", err)
+		return
+	}
+	defer ws.close()
+	releaseConcurrencySlot(r)
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		ws.readUntilClosed()
+	}()
+	logger.Debug("opened classes websocket")
+	for {
+		list, err := server.cachedClassList()
+		if err == nil {
+			err = ws.writeFrame(wsOpText, list.body)
+		}
+		if err != nil {
+			logger.Error("failed to write to websocket", "err", err)
+			return
+		}
+
+		select {
+		case <-closed:
+			logger.Debug("closed classes websocket")
+			return
+		case <-subscriber:
+		}
+	}
+}
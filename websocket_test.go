@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// dialWebSocket opens a WebSocket to path on server, returning the connection and a reader of the frames it's sent
+func dialWebSocket(t *testing.T, server *httptest.Server, path string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r, _ := http.NewRequest("GET", server.URL+path, nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Version", "13")
+	r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	r.Write(conn)
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, r)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, http.StatusSwitchingProtocols, response.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", response.Header.Get("Sec-WebSocket-Accept"))
+	return conn, reader
+}
+
+// readServerFrame reads an unmasked frame sent by the server
+func readServerFrame(t *testing.T, reader *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var header [2]byte
+	_, err := io.ReadFull(reader, header[:])
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	length := int(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		io.ReadFull(reader, extended[:])
+		length = int(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		io.ReadFull(reader, extended[:])
+		length = int(binary.BigEndian.Uint64(extended[:]))
+	}
+	payload := make([]byte, length)
+	io.ReadFull(reader, payload)
+	return header[0] & 0x0F, payload
+}
+
+// writeClientFrame sends a masked frame as a client must
+func writeClientFrame(conn net.Conn, opcode byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for index, b := range payload {
+		frame = append(frame, b^mask[index%4])
+	}
+	conn.Write(frame)
+}
+
+func Test_getClassesWebSocket(t *testing.T) {
+	server := httptest.NewServer(testServer.newRouter())
+	defer server.Close()
+
+	t.Run("push the class list when a class is created", func(t *testing.T) {
+		testServer.DBClasses = []Class{}
+		testServer.markClassesChanged()
+		conn, reader := dialWebSocket(t, server, "/v1/ws/classes")
+		defer conn.Close()
+
+		opcode, payload := readServerFrame(t, reader)
+		assert.Equal(t, byte(wsOpText), opcode)
+		assert.Equal(t, "[]\n", string(payload))
+
+		body := []byte(`{"name": "kayak", "start_date": "2006-01-01", "end_date": "2006-01-01", "capacity": 20}`)
+		r, _ := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.createClass(w, r)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		opcode, payload = readServerFrame(t, reader)
+		var classes []Class
+		json.Unmarshal(payload, &classes)
+		assert.Equal(t, byte(wsOpText), opcode)
+		assert.Equal(t, 1, len(classes))
+		assert.Equal(t, "kayak", classes[0].Name)
+	})
+	t.Run("answer a ping and clean up when the client closes", func(t *testing.T) {
+		conn, reader := dialWebSocket(t, server, "/v1/ws/classes")
+		defer conn.Close()
+		readServerFrame(t, reader)
+
+		writeClientFrame(conn, wsOpPing, []byte("hi"))
+		opcode, payload := readServerFrame(t, reader)
+		assert.Equal(t, byte(wsOpPong), opcode)
+		assert.Equal(t, "hi", string(payload))
+
+		writeClientFrame(conn, wsOpClose, nil)
+		opcode, _ = readServerFrame(t, reader)
+		assert.Equal(t, byte(wsOpClose), opcode)
+		assert.Eventually(t, func() bool {
+			return testServer.classListChanges.subscriberCount() == 0
+		}, time.Second, 10*time.Millisecond)
+	})
+	t.Run("answer a ping between the fragments of a message", func(t *testing.T) {
+		conn, reader := dialWebSocket(t, server, "/v1/ws/classes")
+		defer conn.Close()
+		readServerFrame(t, reader)
+
+		// a masked text frame without FIN, with an empty payload, then its continuation
+		conn.Write([]byte{wsOpText, 0x80, 1, 2, 3, 4})
+		writeClientFrame(conn, wsOpPing, []byte("hi"))
+		opcode, _ := readServerFrame(t, reader)
+		assert.Equal(t, byte(wsOpPong), opcode)
+		writeClientFrame(conn, wsOpContinuation, []byte("end"))
+
+		writeClientFrame(conn, wsOpPing, []byte("again"))
+		opcode, payload := readServerFrame(t, reader)
+		assert.Equal(t, byte(wsOpPong), opcode)
+		assert.Equal(t, "again", string(payload))
+	})
+	for _, test := range []struct {
+		name  string
+		frame []byte
+	}{
+		{name: "an unmasked frame", frame: []byte{0x80 | wsOpPing, 2, 'h', 'i'}},
+		{name: "a continuation without a message to continue", frame: []byte{0x80 | wsOpContinuation, 0x80, 1, 2, 3, 4}},
+		{name: "a fragmented control frame", frame: []byte{wsOpPing, 0x80, 1, 2, 3, 4}},
+		{name: "a control frame over 125 bytes", frame: append([]byte{0x80 | wsOpPing, 0x80 | 126, 0, 126, 1, 2, 3, 4}, make([]byte, 126)...)},
+	} {
+		t.Run("close the connection on "+test.name, func(t *testing.T) {
+			conn, reader := dialWebSocket(t, server, "/v1/ws/classes")
+			defer conn.Close()
+			readServerFrame(t, reader)
+
+			conn.Write(test.frame)
+			opcode, payload := readServerFrame(t, reader)
+			assert.Equal(t, byte(wsOpClose), opcode)
+			assert.Equal(t, []byte{0x03, 0xEA}, payload)
+		})
+	}
+	t.Run("try open a websocket from another site", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", server.URL+"/v1/ws/classes", nil)
+		r.Header.Set("Connection", "Upgrade")
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Sec-WebSocket-Version", "13")
+		r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		r.Header.Set("Origin", "https://elsewhere.example")
+		response, err := http.DefaultClient.Do(r)
+
+		assert.Nil(t, err)
+		respBody, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		assert.Equal(t, http.StatusForbidden, response.StatusCode)
+		assert.True(t, strings.Contains(string(respBody), CodeOriginNotAllowed))
+	})
+	t.Run("try a request that isn't a websocket upgrade", func(t *testing.T) {
+		response, err := http.Get(server.URL + "/v1/ws/classes")
+
+		assert.Nil(t, err)
+		respBody, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		assert.True(t, strings.Contains(string(respBody), CodeWebSocketRequired))
+	})
+}
+
+func Test_webSocketOriginAllowed(t *testing.T) {
+	server := NewServer(Config{CORSAllowedOrigins: []string{"https://app.example"}}, nil)
+	for _, test := range []struct {
+		origin  string
+		allowed bool
+	}{
+		{origin: "", allowed: true},
+		{origin: "http://classes.example", allowed: true},
+		{origin: "https://app.example", allowed: true},
+		{origin: "https://elsewhere.example", allowed: false},
+		{origin: "http://classes.example.elsewhere.example", allowed: false},
+	} {
+		r, _ := http.NewRequest("GET", "http://classes.example/ws/classes", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+
+		assert.Equal(t, test.allowed, server.webSocketOriginAllowed(r), test.origin)
+	}
+}
+
+func Test_classListSubscribersCoalesce(t *testing.T) {
+	var changes classListSubscribers
+	subscriber := changes.subscribe()
+
+	changes.notify()
+	changes.notify()
+
+	assert.Equal(t, 1, len(subscriber))
+	changes.unsubscribe(subscriber)
+	assert.Equal(t, 0, changes.subscriberCount())
+}